@@ -606,11 +606,8 @@ func (b *broker) reapConnections(idleTimeout time.Duration) (total int) {
 		// - produce can write but never read
 		// - fetch can hang for a while reading (infrequent writes)
 
-		lastWrite := time.Unix(0, cxn.lastWrite.Load())
-		lastRead := time.Unix(0, cxn.lastRead.Load())
-
-		writeIdle := time.Since(lastWrite) > idleTimeout && !cxn.writing.Load()
-		readIdle := time.Since(lastRead) > idleTimeout && !cxn.reading.Load()
+		writeIdle := monoSince(cxn.lastWrite.Load()) > idleTimeout && !cxn.writing.Load()
+		readIdle := monoSince(cxn.lastRead.Load()) > idleTimeout && !cxn.reading.Load()
 
 		if writeIdle && readIdle {
 			cxn.die()
@@ -620,6 +617,25 @@ func (b *broker) reapConnections(idleTimeout time.Duration) (total int) {
 	return total
 }
 
+// killConnections closes all of the broker's connections; new connections are
+// opened on the next request.
+func (b *broker) killConnections() {
+	b.reapMu.Lock()
+	defer b.reapMu.Unlock()
+
+	for _, cxn := range []*brokerCxn{
+		b.cxnNormal,
+		b.cxnProduce,
+		b.cxnFetch,
+		b.cxnGroup,
+		b.cxnSlow,
+	} {
+		if cxn != nil {
+			cxn.die()
+		}
+	}
+}
+
 // connect connects to the broker's addr, returning the new connection.
 func (b *broker) connect(ctx context.Context) (net.Conn, error) {
 	b.cl.cfg.logger.Log(LogLevelDebug, "opening connection to broker", "addr", b.addr, "broker", logID(b.meta.NodeID))
@@ -648,7 +664,7 @@ func (b *broker) connect(ctx context.Context) (net.Conn, error) {
 // brokerCxn manages an actual connection to a Kafka broker. This is separate
 // the broker struct to allow lazy connection (re)creation.
 type brokerCxn struct {
-	throttleUntil atomicI64 // atomic nanosec
+	throttleUntil atomicI64 // atomic monoNow nanosec
 
 	conn net.Conn
 
@@ -665,8 +681,8 @@ type brokerCxn struct {
 	// The following four fields are used for connection reaping.
 	// Write is only updated in one location; read is updated in three
 	// due to readConn, readConnAsync, and discard.
-	lastWrite atomicI64
-	lastRead  atomicI64
+	lastWrite atomicI64 // monoNow
+	lastRead  atomicI64 // monoNow
 	writing   atomicBool
 	reading   atomicBool
 
@@ -998,8 +1014,7 @@ func maybeUpdateCtxErr(clientCtx, reqCtx context.Context, err *error) {
 func (cxn *brokerCxn) writeRequest(ctx context.Context, enqueuedForWritingAt time.Time, req kmsg.Request) (corrID int32, bytesWritten int, writeWait, timeToWrite time.Duration, readEnqueue time.Time, writeErr error) {
 	// A nil ctx means we cannot be throttled.
 	if ctx != nil {
-		throttleUntil := time.Unix(0, cxn.throttleUntil.Load())
-		if sleep := time.Until(throttleUntil); sleep > 0 {
+		if sleep := monoUntil(cxn.throttleUntil.Load()); sleep > 0 {
 			after := time.NewTimer(sleep)
 			select {
 			case <-after.C:
@@ -1058,7 +1073,7 @@ func (cxn *brokerCxn) writeConn(
 ) (bytesWritten int, writeWait, timeToWrite time.Duration, readEnqueue time.Time, writeErr error) {
 	cxn.writing.Store(true)
 	defer func() {
-		cxn.lastWrite.Store(time.Now().UnixNano())
+		cxn.lastWrite.Store(monoNow())
 		cxn.writing.Store(false)
 	}()
 
@@ -1106,7 +1121,7 @@ func (cxn *brokerCxn) readConn(
 ) (nread int, buf []byte, readWait, timeToRead time.Duration, err error) {
 	cxn.reading.Store(true)
 	defer func() {
-		cxn.lastRead.Store(time.Now().UnixNano())
+		cxn.lastRead.Store(monoNow())
 		cxn.reading.Store(false)
 	}()
 
@@ -1385,7 +1400,7 @@ func (cxn *brokerCxn) discard() {
 
 			cxn.reading.Store(true)
 			defer func() {
-				cxn.lastRead.Store(time.Now().UnixNano())
+				cxn.lastRead.Store(monoNow())
 				cxn.reading.Store(false)
 			}()
 
@@ -1489,7 +1504,7 @@ func (cxn *brokerCxn) handleResp(pr promisedResp) {
 			if millis > 0 {
 				cxn.b.cl.cfg.logger.Log(LogLevelInfo, "broker is throttling us in response", "broker", logID(cxn.b.meta.NodeID), "req", kmsg.Key(pr.resp.Key()).Name(), "throttle_millis", millis, "throttles_after_resp", throttlesAfterResp)
 				if throttlesAfterResp {
-					throttleUntil := time.Now().Add(time.Millisecond * time.Duration(millis)).UnixNano()
+					throttleUntil := monoNow() + int64(time.Millisecond*time.Duration(millis))
 					if throttleUntil > cxn.throttleUntil.Load() {
 						cxn.throttleUntil.Store(throttleUntil)
 					}
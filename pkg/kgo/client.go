@@ -245,6 +245,8 @@ func (cl *Client) OptValues(opt any) []any {
 		return []any{cfg.requestTimeoutOverhead}
 	case namefn(ConnIdleTimeout):
 		return []any{cfg.connIdleTimeout}
+	case namefn(DialTimeout):
+		return []any{cfg.dialTimeout}
 	case namefn(Dialer):
 		return []any{cfg.dialFn}
 	case namefn(DialTLSConfig):
@@ -253,6 +255,10 @@ func (cl *Client) OptValues(opt any) []any {
 		return []any{cfg.dialTLS != nil}
 	case namefn(SeedBrokers):
 		return []any{cfg.seedBrokers}
+	case namefn(ProducerOnly):
+		return []any{cfg.producerOnly}
+	case namefn(ConsumerOnly):
+		return []any{cfg.consumerOnly}
 	case namefn(MaxVersions):
 		return []any{cfg.maxVersions}
 	case namefn(MinVersions):
@@ -265,6 +271,8 @@ func (cl *Client) OptValues(opt any) []any {
 		return []any{cfg.retryTimeout(0)}
 	case namefn(RetryTimeoutFn):
 		return []any{cfg.retryTimeout}
+	case namefn(RetriableErrorBudget):
+		return []any{cfg.retryBudget}
 	case namefn(AllowAutoTopicCreation):
 		return []any{cfg.allowAutoTopicCreation}
 	case namefn(BrokerMaxWriteBytes):
@@ -312,6 +320,8 @@ func (cl *Client) OptValues(opt any) []any {
 		return []any{cfg.stopOnDataLoss}
 	case namefn(ProducerOnDataLossDetected):
 		return []any{cfg.onDataLoss}
+	case namefn(ProducerOnOffsetAdvanced):
+		return []any{cfg.onOffsetAdvanced}
 	case namefn(ProducerLinger):
 		return []any{cfg.linger}
 	case namefn(ManualFlushing):
@@ -332,6 +342,10 @@ func (cl *Client) OptValues(opt any) []any {
 		return []any{cfg.preferLagFn}
 	case namefn(ConsumeRegex):
 		return []any{cfg.regex}
+	case namefn(ConsumeRegexExclude):
+		return []any{cfg.regexExclude}
+	case namefn(ConsumeRegexExpiry):
+		return []any{cfg.regexExpiry}
 	case namefn(ConsumeResetOffset):
 		return []any{cfg.resetOffset}
 	case namefn(ConsumeTopics):
@@ -350,8 +364,12 @@ func (cl *Client) OptValues(opt any) []any {
 		return []any{cfg.minBytes}
 	case namefn(KeepControlRecords):
 		return []any{cfg.keepControl}
+	case namefn(ConsumeRawBatches):
+		return []any{cfg.rawBatches}
 	case namefn(MaxConcurrentFetches):
 		return []any{cfg.maxConcurrentFetches}
+	case namefn(MaxPollRecords):
+		return []any{cfg.maxPollRecords}
 	case namefn(Rack):
 		return []any{cfg.rack}
 	case namefn(KeepRetryableFetchErrors):
@@ -361,14 +379,30 @@ func (cl *Client) OptValues(opt any) []any {
 		return []any{cfg.adjustOffsetsBeforeAssign}
 	case namefn(AutoCommitCallback):
 		return []any{cfg.commitCallback}
+	case namefn(CommitMetadata):
+		return []any{cfg.commitMetadata}
 	case namefn(AutoCommitInterval):
 		return []any{cfg.autocommitInterval}
+	case namefn(AutoCommitOnClose):
+		return []any{cfg.autocommitOnClose}
 	case namefn(AutoCommitMarks):
 		return []any{cfg.autocommitMarks}
+	case namefn(AutoCommitPauseWait):
+		return []any{cfg.autocommitPauseWait}
 	case namefn(Balancers):
 		return []any{cfg.balancers}
+	case namefn(EagerRebalancing):
+		return []any{cfg.balancers}
 	case namefn(BlockRebalanceOnPoll):
 		return []any{cfg.blockRebalanceOnPoll}
+	case namefn(StrictGroupValidation):
+		return []any{cfg.strictGroupValidation}
+	case namefn(CheckInstanceIDConflict):
+		return []any{cfg.instanceIDCheck}
+	case namefn(StopOnUnrecoverableGroupErrors):
+		return []any{cfg.stopOnGroupAuth}
+	case namefn(ResumeUnassignedPartitions):
+		return []any{cfg.resumeUnassigned}
 	case namefn(ConsumerGroup):
 		return []any{cfg.group}
 	case namefn(DisableAutoCommit):
@@ -379,23 +413,39 @@ func (cl *Client) OptValues(opt any) []any {
 		return []any{cfg.protocol}
 	case namefn(HeartbeatInterval):
 		return []any{cfg.heartbeatInterval}
+	case namefn(HeartbeatJitter):
+		return []any{cfg.heartbeatJitter}
+	case namefn(OffsetRequestChunkSize):
+		return []any{cfg.offsetChunkPartitions}
+	case namefn(OnHeartbeat):
+		return []any{cfg.onHeartbeat}
 	case namefn(InstanceID):
 		if cfg.instanceID != nil {
 			return []any{*cfg.instanceID, true}
 		}
 		return []any{"", false}
+	case namefn(RegexRefreshInterval):
+		return []any{cfg.regexRefresh}
 	case namefn(OnOffsetsFetched):
 		return []any{cfg.onFetched}
+	case namefn(ResetOffsetFunc):
+		return []any{cfg.resetOffsetFn}
 	case namefn(OnPartitionsAssigned):
 		return []any{cfg.onAssigned}
 	case namefn(OnPartitionsLost):
 		return []any{cfg.onLost}
 	case namefn(OnPartitionsRevoked):
 		return []any{cfg.onRevoked}
+	case namefn(OnPartitionsRevokedDrain):
+		return []any{cfg.onRevokedDrain}
 	case namefn(RebalanceTimeout):
 		return []any{cfg.rebalanceTimeout}
 	case namefn(RequireStableFetchOffsets):
 		return []any{cfg.requireStable}
+	case namefn(GroupErrorBackoff):
+		return []any{cfg.groupErrBackoff}
+	case namefn(GroupErrorMetadataWait):
+		return []any{cfg.groupErrMetaWait}
 	case namefn(SessionTimeout):
 		return []any{cfg.sessionTimeout}
 	default:
@@ -590,6 +640,12 @@ func (cl *Client) Ping(ctx context.Context) error {
 // MetadataMinAge anyway, but the map is not cleaned up one the metadata
 // expires. This function ensures the map is purged.
 func (cl *Client) PurgeTopicsFromClient(topics ...string) {
+	cl.purgeTopicsFromClient(topics, false)
+}
+
+// purgeTopicsFromClient is PurgeTopicsFromClient, but if the topics are known
+// to be deleted, we also drop any uncommitted group offsets for them.
+func (cl *Client) purgeTopicsFromClient(topics []string, deleted bool) {
 	if len(topics) == 0 {
 		return
 	}
@@ -603,7 +659,7 @@ func (cl *Client) PurgeTopicsFromClient(topics ...string) {
 		}()
 		go func() {
 			defer wg.Done()
-			cl.consumer.purgeTopics(topics)
+			cl.consumer.purgeTopics(topics, deleted)
 		}()
 		wg.Wait()
 	})
@@ -638,7 +694,7 @@ func (cl *Client) PurgeTopicsFromConsuming(topics ...string) {
 	}
 	sort.Strings(topics)
 	cl.blockingMetadataFn(func() {
-		cl.consumer.purgeTopics(topics)
+		cl.consumer.purgeTopics(topics, false)
 	})
 }
 
@@ -1499,6 +1555,32 @@ type coordinatorLoad struct {
 	err      error
 }
 
+// cachedCoordinator returns the metadata of the cached coordinator for key,
+// if one is cached and loaded successfully. This does not issue requests.
+func (cl *Client) cachedCoordinator(typ int8, key string) (BrokerMetadata, bool) {
+	cl.coordinatorsMu.Lock()
+	c, ok := cl.coordinators[coordinatorKey{key, typ}]
+	cl.coordinatorsMu.Unlock()
+	if !ok {
+		return BrokerMetadata{}, false
+	}
+	select {
+	case <-c.loadWait:
+	default:
+		return BrokerMetadata{}, false // still loading
+	}
+	if c.err != nil {
+		return BrokerMetadata{}, false
+	}
+	cl.brokersMu.RLock()
+	b := findBroker(cl.brokers, c.node)
+	cl.brokersMu.RUnlock()
+	if b == nil {
+		return BrokerMetadata{}, false
+	}
+	return b.meta, true
+}
+
 func (cl *Client) loadCoordinator(ctx context.Context, typ int8, key string) (*broker, error) {
 	berr := cl.loadCoordinators(ctx, typ, key)[key]
 	return berr.b, berr.err
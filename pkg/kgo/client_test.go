@@ -2,11 +2,16 @@ package kgo
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"reflect"
 	"strconv"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/twmb/franz-go/pkg/kerr"
 	"github.com/twmb/franz-go/pkg/kmsg"
 )
 
@@ -199,6 +204,117 @@ func TestProcessHooksErrors(t *testing.T) {
 	}
 }
 
+func TestValidateGroupOptsErrors(t *testing.T) {
+	tests := []struct {
+		name   string
+		opts   []Opt
+		strict bool // only an error with StrictGroupValidation
+	}{
+		{
+			name:   "heartbeat larger than session",
+			strict: true,
+			opts:   []Opt{ConsumerGroup("g"), SessionTimeout(time.Second), HeartbeatInterval(2 * time.Second)},
+		},
+		{
+			name:   "instance id without group",
+			strict: true,
+			opts:   []Opt{InstanceID("i")},
+		},
+		{
+			name:   "empty instance id",
+			strict: true,
+			opts:   []Opt{ConsumerGroup("g"), InstanceID("")},
+		},
+		{
+			name:   "transactional marked autocommit",
+			strict: true,
+			opts:   []Opt{ConsumerGroup("g"), TransactionalID("t"), AutoCommitMarks()},
+		},
+		{
+			name: "producer only and consumer only",
+			opts: []Opt{ProducerOnly(), ConsumerOnly()},
+		},
+		{
+			name: "producer only with a group",
+			opts: []Opt{ProducerOnly(), ConsumerGroup("g"), ConsumeTopics("t")},
+		},
+		{
+			name: "consumer only transactional",
+			opts: []Opt{ConsumerOnly(), TransactionalID("t")},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			opts := test.opts
+			if test.strict {
+				// Without strict validation, this is only a warning.
+				if _, _, _, err := validateCfg(opts...); err != nil {
+					t.Fatalf("unexpected error without strict validation: %v", err)
+				}
+				opts = append(opts, StrictGroupValidation())
+			}
+			if _, _, _, err := validateCfg(opts...); err == nil {
+				t.Fatal("expected error")
+			}
+		})
+	}
+
+	// Group options are not validated for a client that is not consuming
+	// in a group.
+	if _, _, _, err := validateCfg(SessionTimeout(time.Second), HeartbeatInterval(2*time.Second), StrictGroupValidation()); err != nil {
+		t.Errorf("unexpected error for a client not in a group: %v", err)
+	}
+}
+
+func TestConsumeRegexCompile(t *testing.T) {
+	if _, _, _, err := validateCfg(ConsumeTopics("foo", "bar["), ConsumeRegex()); err == nil {
+		t.Fatal("expected invalid regex error")
+	}
+
+	cfg, _, _, err := validateCfg(ConsumeTopics("foo", "^bar$"), ConsumeRegex())
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	for _, test := range []struct {
+		re    string
+		topic string
+		exp   bool
+	}{
+		{"foo", "foo", true},
+		{"foo", "foobar", true}, // unanchored
+		{"foo", "afoo", true},
+		{"^bar$", "bar", true},
+		{"^bar$", "barbar", false},
+	} {
+		if got := cfg.topics[test.re].MatchString(test.topic); got != test.exp {
+			t.Errorf("%q matching %q: got %v != exp %v", test.re, test.topic, got, test.exp)
+		}
+	}
+}
+
+func TestClientOnlyModes(t *testing.T) {
+	p, err := NewClient(ProducerOnly())
+	if err != nil {
+		t.Fatalf("unable to create producer only client: %v", err)
+	}
+	defer p.Close()
+	if p.consumer.g != nil || p.consumer.d != nil {
+		t.Error("producer only client unexpectedly initialized consumer state")
+	}
+	if err := p.PollFetches(context.Background()).Err(); !errors.Is(err, ErrConsumingDisabled) {
+		t.Errorf("got poll err %v, exp %v", err, ErrConsumingDisabled)
+	}
+
+	c, err := NewClient(ConsumerOnly())
+	if err != nil {
+		t.Fatalf("unable to create consumer only client: %v", err)
+	}
+	defer c.Close()
+	if err := c.ProduceSync(context.Background(), StringRecord("v")).FirstErr(); !errors.Is(err, ErrProducingDisabled) {
+		t.Errorf("got produce err %v, exp %v", err, ErrProducingDisabled)
+	}
+}
+
 type notAHook struct{}
 
 type someHook struct {
@@ -214,3 +330,103 @@ type intSliceHook []int
 func (*intSliceHook) OnNewClient(*Client) {
 	// ignore
 }
+
+func TestMonoNow(t *testing.T) {
+	// We cannot step the system clock in a test; we only check that
+	// monotonic timestamps behave like durations.
+	a := monoNow()
+	if a <= 0 {
+		t.Fatalf("monoNow: got %d <= 0", a)
+	}
+	time.Sleep(5 * time.Millisecond)
+	if since := monoSince(a); since < 5*time.Millisecond || since > time.Minute {
+		t.Errorf("monoSince: got %v, expected ~5ms", since)
+	}
+	until := monoNow() + int64(time.Second)
+	if d := monoUntil(until); d <= 0 || d > time.Second {
+		t.Errorf("monoUntil: got %v, expected (0, 1s]", d)
+	}
+}
+
+type tpUpdatedHook struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+func (h *tpUpdatedHook) OnTopicPartitionsUpdated(topic string, isProduce bool, prior, current int32) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.calls = append(h.calls, fmt.Sprintf("%s %v %d=>%d", topic, isProduce, prior, current))
+}
+
+func TestHookTopicPartitionsUpdated(t *testing.T) {
+	var (
+		b     *fakeBroker
+		stage atomic.Int32
+	)
+	b = newFakeBroker(t, func(req kmsg.Request) kmsg.Response {
+		meta, ok := req.(*kmsg.MetadataRequest)
+		if !ok {
+			return nil // fetches are left in flight
+		}
+		resp := b.metadata(meta)
+		rt := kmsg.NewMetadataResponseTopic()
+		rt.Topic = kmsg.StringPtr("t")
+		partitions := int32(2)
+		switch stage.Load() {
+		case 1:
+			rt.ErrorCode = kerr.UnknownTopicOrPartition.Code
+			partitions = 0
+		case 3:
+			partitions = 3
+		}
+		for p := int32(0); p < partitions; p++ {
+			rp := kmsg.NewMetadataResponseTopicPartition()
+			rp.Partition = p
+			rp.Replicas = []int32{0}
+			rp.ISR = []int32{0}
+			rt.Partitions = append(rt.Partitions, rp)
+		}
+		resp.Topics = append(resp.Topics, rt)
+		return resp
+	})
+	h := new(tpUpdatedHook)
+	cl, err := NewClient(
+		SeedBrokers(b.addr()),
+		ConsumeTopics("t"),
+		MetadataMinAge(10*time.Millisecond),
+		WithHooks(h),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+	defer b.close()
+
+	// Each stage waits for the update to be stored before moving on.
+	waitFor := func(what string, fn func(*topicPartitionsData) bool) {
+		t.Helper()
+		for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+			if tp, ok := cl.consumer.d.tps.load()["t"]; ok && fn(tp.load()) {
+				return
+			}
+			cl.ForceMetadataRefresh()
+		}
+		t.Fatalf("timed out waiting for %s", what)
+	}
+	waitFor("initial load", func(d *topicPartitionsData) bool { return d.loadErr == nil && d.livePartitions() == 2 })
+	stage.Store(1)
+	waitFor("topic load error", func(d *topicPartitionsData) bool { return errors.Is(d.loadErr, kerr.UnknownTopicOrPartition) })
+	stage.Store(2)
+	waitFor("topic reload", func(d *topicPartitionsData) bool { return d.loadErr == nil })
+	stage.Store(3)
+	waitFor("added partition", func(d *topicPartitionsData) bool { return d.livePartitions() == 3 })
+
+	// The hook runs just after the store; give it a moment.
+	time.Sleep(50 * time.Millisecond)
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if exp := []string{"t false 2=>3"}; !reflect.DeepEqual(h.calls, exp) {
+		t.Errorf("got hook calls %q != exp %q", h.calls, exp)
+	}
+}
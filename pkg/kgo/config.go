@@ -87,12 +87,16 @@ type cfg struct {
 	retryBackoff func(int) time.Duration
 	retries      int64
 	retryTimeout func(int16) time.Duration
+	retryBudget  time.Duration
 
 	maxBrokerWriteBytes int32
 	maxBrokerReadBytes  int32
 
 	allowAutoTopicCreation bool
 
+	producerOnly bool // the consumer half of the client is disabled
+	consumerOnly bool // the producer half of the client is disabled
+
 	metadataMaxAge time.Duration
 	metadataMinAge time.Duration
 
@@ -129,6 +133,8 @@ type cfg struct {
 	stopOnDataLoss bool
 	onDataLoss     func(string, int32)
 
+	onOffsetAdvanced func(string, int32, int64)
+
 	//////////////////////
 	// CONSUMER SECTION //
 	//////////////////////
@@ -140,16 +146,21 @@ type cfg struct {
 	resetOffset    Offset
 	isolationLevel int8
 	keepControl    bool
+	rawBatches     bool
 	rack           string
 	preferLagFn    PreferLagFn
 
 	maxConcurrentFetches     int
+	maxPollRecords           int
 	disableFetchSessions     bool
 	keepRetryableFetchErrors bool
 
-	topics     map[string]*regexp.Regexp   // topics to consume; if regex is true, values are compiled regular expressions
-	partitions map[string]map[int32]Offset // partitions to directly consume from
-	regex      bool
+	topics      map[string]*regexp.Regexp   // topics to consume; if regex is true, values are compiled regular expressions
+	partitions  map[string]map[int32]Offset // partitions to directly consume from
+	regex       bool
+	regexExpiry time.Duration
+
+	regexExclude map[string]*regexp.Regexp // if consuming regex, topics matching any of these are never consumed
 
 	////////////////////////////
 	// CONSUMER GROUP SECTION //
@@ -160,16 +171,35 @@ type cfg struct {
 	balancers  []GroupBalancer // balancers we can use
 	protocol   string          // "consumer" by default, expected to never be overridden
 
+	instanceIDCheck bool // if true, DescribeGroups after the first join to detect a duplicate instance ID
+	stopOnGroupAuth bool // if true, group max size and authorization errors stop group management
+
+	strictGroupValidation bool // if true, contradictory group options are errors rather than warnings
+
 	sessionTimeout    time.Duration
 	rebalanceTimeout  time.Duration
 	heartbeatInterval time.Duration
+	heartbeatJitter   float64
 	requireStable     bool
+	resumeUnassigned  bool // if true, paused partitions are resumed once no longer assigned
+
+	offsetChunkPartitions int // max partitions per OffsetFetch or OffsetCommit request
+
+	resetOffsetFn func(string, int32) Offset // if non-nil, per-partition reset for partitions without a commit
+
+	groupErrBackoff  func(int) time.Duration // if nil, retryBackoff is used
+	groupErrMetaWait time.Duration           // if zero, the backoff is used
+
+	regexRefresh time.Duration // if non-zero and consuming regex, how often to force a metadata refresh
 
 	onAssigned func(context.Context, *Client, map[string][]int32)
 	onRevoked  func(context.Context, *Client, map[string][]int32)
 	onLost     func(context.Context, *Client, map[string][]int32)
 	onFetched  func(context.Context, *Client, *kmsg.OffsetFetchResponse) error
 
+	onRevokedDrain func(context.Context, *Client, map[string][]int32, func())
+	onHeartbeat    func(error)
+
 	adjustOffsetsBeforeAssign func(ctx context.Context, offsets map[string]map[int32]Offset) (map[string]map[int32]Offset, error)
 
 	blockRebalanceOnPoll bool
@@ -179,11 +209,14 @@ type cfg struct {
 	setLost           bool
 	setCommitCallback bool
 
-	autocommitDisable  bool // true if autocommit was disabled or we are transactional
-	autocommitGreedy   bool
-	autocommitMarks    bool
-	autocommitInterval time.Duration
-	commitCallback     func(*Client, *kmsg.OffsetCommitRequest, *kmsg.OffsetCommitResponse, error)
+	autocommitDisable   bool // true if autocommit was disabled or we are transactional
+	autocommitGreedy    bool
+	autocommitMarks     bool
+	autocommitInterval  time.Duration
+	autocommitPauseWait time.Duration
+	autocommitOnClose   time.Duration // if non-zero, bound for the final commit when leaving the group
+	commitCallback      func(*Client, *kmsg.OffsetCommitRequest, *kmsg.OffsetCommitResponse, error)
+	commitMetadata      func(string, int32, EpochOffset) string
 }
 
 func (cfg *cfg) validate() error {
@@ -278,6 +311,7 @@ func (cfg *cfg) validate() error {
 
 		// 0 <= allowed concurrency
 		{name: "max concurrent fetches", v: int64(cfg.maxConcurrentFetches), allowed: 0, badcmp: i64lt},
+		{name: "max poll records", v: int64(cfg.maxPollRecords), allowed: 0, badcmp: i64lt},
 
 		// 1s <= request timeout overhead <= 15m
 		{name: "request timeout max overhead", v: int64(cfg.requestTimeoutOverhead), allowed: int64(15 * time.Minute), badcmp: i64gt, durs: true},
@@ -316,8 +350,9 @@ func (cfg *cfg) validate() error {
 		{name: "session timeout", v: int64(cfg.sessionTimeout), allowed: int64(100 * time.Millisecond), badcmp: i64lt, durs: true},
 		{name: "rebalance timeout", v: int64(cfg.rebalanceTimeout), allowed: int64(100 * time.Millisecond), badcmp: i64lt, durs: true},
 		{name: "autocommit interval", v: int64(cfg.autocommitInterval), allowed: int64(100 * time.Millisecond), badcmp: i64lt, durs: true},
-
-		{v: int64(cfg.heartbeatInterval), allowed: int64(cfg.rebalanceTimeout) * int64(time.Millisecond), badcmp: i64gt, durs: true, fmt: "heartbeat interval %v is erroneously larger than the session timeout %v"},
+		{name: "autocommit pause wait", v: int64(cfg.autocommitPauseWait), allowed: 0, badcmp: i64lt, durs: true},
+		{name: "autocommit on close timeout", v: int64(cfg.autocommitOnClose), allowed: 0, badcmp: i64lt, durs: true},
+		{name: "regex refresh interval", v: int64(cfg.regexRefresh), allowed: 0, badcmp: i64lt, durs: true},
 	} {
 		bad, cmp := limit.badcmp(limit.v, limit.allowed)
 		if bad {
@@ -353,10 +388,19 @@ func (cfg *cfg) validate() error {
 		for re := range cfg.topics {
 			compiled, err := regexp.Compile(re)
 			if err != nil {
-				return fmt.Errorf("invalid regular expression %q", re)
+				return fmt.Errorf("invalid regular expression %q: %w", re, err)
 			}
 			cfg.topics[re] = compiled
 		}
+		for re := range cfg.regexExclude {
+			compiled, err := regexp.Compile(re)
+			if err != nil {
+				return fmt.Errorf("invalid exclude regular expression %q: %w", re, err)
+			}
+			cfg.regexExclude[re] = compiled
+		}
+	} else if len(cfg.regexExclude) > 0 {
+		return errors.New("invalid regex exclusion when not consuming as regex")
 	}
 
 	if cfg.topics != nil && cfg.partitions != nil {
@@ -379,9 +423,36 @@ func (cfg *cfg) validate() error {
 	if (cfg.autocommitGreedy || cfg.autocommitDisable || cfg.autocommitMarks || cfg.setCommitCallback) && len(cfg.group) == 0 {
 		return errors.New("invalid autocommit options specified when a group was not specified")
 	}
-	if (cfg.setLost || cfg.setRevoked || cfg.setAssigned) && len(cfg.group) == 0 {
+	if cfg.onRevokedDrain != nil && cfg.setRevoked {
+		return errors.New("cannot set both OnPartitionsRevoked and OnPartitionsRevokedDrain")
+	}
+	if (cfg.setLost || cfg.setRevoked || cfg.setAssigned || cfg.onRevokedDrain != nil) && len(cfg.group) == 0 {
 		return errors.New("invalid group partition assigned/revoked/lost functions set when a group was not specified")
 	}
+	if cfg.offsetChunkPartitions <= 0 {
+		return fmt.Errorf("invalid offset request chunk size %d, must be positive", cfg.offsetChunkPartitions)
+	}
+	if cfg.heartbeatJitter < 0 || cfg.heartbeatJitter > 0.5 {
+		return fmt.Errorf("invalid heartbeat jitter %v, must be between 0 and 0.5", cfg.heartbeatJitter)
+	}
+	if cfg.regexRefresh != 0 && (len(cfg.group) == 0 || !cfg.regex) {
+		return errors.New("invalid regex refresh interval specified when not consuming a group via regex")
+	}
+	if cfg.producerOnly && cfg.consumerOnly {
+		return errors.New("invalid client that is both producer only and consumer only")
+	}
+	if cfg.producerOnly && (len(cfg.topics) > 0 || len(cfg.partitions) > 0 || len(cfg.group) > 0) {
+		return errors.New("invalid consumer options specified for a producer only client")
+	}
+	if cfg.consumerOnly && cfg.txnID != nil {
+		return errors.New("invalid transactional id specified for a consumer only client")
+	}
+	if cfg.instanceIDCheck && cfg.instanceID == nil {
+		return errors.New("invalid instance id conflict check specified when an instance id was not specified")
+	}
+	if err := cfg.validateStrictGroup(); err != nil {
+		return err
+	}
 
 	processedHooks, err := processHooks(cfg.hooks)
 	if err != nil {
@@ -392,6 +463,43 @@ func (cfg *cfg) validate() error {
 	return nil
 }
 
+// validateStrictGroup checks for group option combinations that are
+// contradictory but that we historically accepted. With StrictGroupValidation,
+// these are errors; otherwise, they are logged as warnings. Only an instance
+// ID is checked if we are not consuming in a group, since the other options
+// are unused.
+func (cfg *cfg) validateStrictGroup() error {
+	violation := func(msg string) error {
+		if cfg.strictGroupValidation {
+			return errors.New(msg)
+		}
+		cfg.logger.Log(LogLevelWarn, msg+"; this will be an error with StrictGroupValidation")
+		return nil
+	}
+
+	if len(cfg.group) == 0 {
+		if cfg.instanceID != nil {
+			return violation("invalid group instance id specified when a group was not specified")
+		}
+		return nil
+	}
+
+	if cfg.heartbeatInterval > cfg.sessionTimeout {
+		if err := violation(fmt.Sprintf("heartbeat interval %v is erroneously larger than the session timeout %v", cfg.heartbeatInterval, cfg.sessionTimeout)); err != nil {
+			return err
+		}
+	}
+	if cfg.instanceID != nil && *cfg.instanceID == "" {
+		if err := violation("invalid empty group instance id"); err != nil {
+			return err
+		}
+	}
+	if cfg.txnID != nil && (cfg.autocommitGreedy || cfg.autocommitMarks) {
+		return violation("cannot enable greedy or marked autocommitting with a transactional id; transactional clients commit offsets when ending transactions")
+	}
+	return nil
+}
+
 // processHooks will inspect and recursively unpack slices of hooks stopping
 // if the instance implements any hook interface. It will return an error on
 // the first instance that implements no hook interface
@@ -529,7 +637,10 @@ func defaultCfg() cfg {
 		rebalanceTimeout:  60000 * time.Millisecond,
 		heartbeatInterval: 3000 * time.Millisecond,
 
-		autocommitInterval: 5 * time.Second,
+		offsetChunkPartitions: 5000,
+
+		autocommitInterval:  5 * time.Second,
+		autocommitPauseWait: 10 * time.Second,
 	}
 }
 
@@ -660,6 +771,21 @@ func SeedBrokers(seeds ...string) Opt {
 	return clientOpt{func(cfg *cfg) { cfg.seedBrokers = append(cfg.seedBrokers[:0], seeds...) }}
 }
 
+// ProducerOnly disables the consuming half of the client. No consumer state
+// is initialized, consumer options are rejected when creating the client, and
+// polling immediately returns a fetch containing ErrConsumingDisabled. This
+// is useful if you create many short lived clients that only produce.
+func ProducerOnly() Opt {
+	return clientOpt{func(cfg *cfg) { cfg.producerOnly = true }}
+}
+
+// ConsumerOnly disables the producing half of the client. A transactional ID
+// is rejected when creating the client, and every produced record is failed
+// with ErrProducingDisabled.
+func ConsumerOnly() Opt {
+	return clientOpt{func(cfg *cfg) { cfg.consumerOnly = true }}
+}
+
 // MaxVersions sets the maximum Kafka version to try, overriding the
 // internal unbounded (latest stable) versions.
 //
@@ -756,6 +882,25 @@ func RetryTimeoutFn(t func(int16) time.Duration) Opt {
 	return clientOpt{func(cfg *cfg) { cfg.retryTimeout = t }}
 }
 
+// RetriableErrorBudget sets how long a single partition is allowed to fail
+// producing or fetching with only retriable errors before the client
+// escalates, overriding the default of no budget (retrying forever, or up to
+// RecordRetries / RecordDeliveryTimeout for produced records).
+//
+// Some broker bugs result in retriable errors being returned indefinitely for
+// one partition even though the rest of the connection is healthy. Once a
+// partition has failed with only retriable errors for longer than the budget,
+// the client closes its connections to the broker, forces a metadata refresh,
+// and calls HookRetriableErrorBudget. If the partition is still failing after
+// another budget duration, the client stops retrying internally: buffered
+// records for the partition are failed, and fetches for the partition return
+// the error. In both cases, the error is an *ErrRetriableErrorBudget.
+//
+// Any successful produce or fetch for the partition resets the budget.
+func RetriableErrorBudget(budget time.Duration) Opt {
+	return clientOpt{func(cfg *cfg) { cfg.retryBudget = budget }}
+}
+
 // AllowAutoTopicCreation enables topics to be auto created if they do
 // not exist when fetching their metadata.
 func AllowAutoTopicCreation() Opt {
@@ -1053,6 +1198,20 @@ func ProducerOnDataLossDetected(fn func(string, int32)) ProducerOpt {
 	return producerOpt{func(cfg *cfg) { cfg.onDataLoss = fn }}
 }
 
+// ProducerOnOffsetAdvanced sets a function to call whenever a partition's
+// produced offset frontier advances, that is, whenever a batch is successfully
+// acked. The function is called with the topic, partition, and the offset one
+// past the last acked record: every record this client produced to the
+// partition before that offset is durable. See ProducedOffsets.
+//
+// The function is called serially, after the promises for all records in the
+// acked batch have been called, and must not block for long. Batches whose
+// offsets are unknown (old brokers replying to a duplicate batch with offset
+// -1) do not advance the frontier.
+func ProducerOnOffsetAdvanced(fn func(topic string, partition int32, offset int64)) ProducerOpt {
+	return producerOpt{func(cfg *cfg) { cfg.onOffsetAdvanced = fn }}
+}
+
 // ProducerLinger sets how long individual topic partitions will linger waiting
 // for more records before triggering a request to be built.
 //
@@ -1229,6 +1388,22 @@ func MaxConcurrentFetches(n int) ConsumerOpt {
 	return consumerOpt{func(cfg *cfg) { cfg.maxConcurrentFetches = n }}
 }
 
+// MaxPollRecords sets the maximum number of records PollFetches and
+// PollFetchesInto return in one call, overriding the default of returning
+// everything that is buffered. This can be used to bound how long it takes to
+// process a single poll, such as to keep processing within the rebalance
+// timeout.
+//
+// Records beyond the limit stay buffered in the client and are returned in
+// the next poll; they are not fetched again. Only records that are returned
+// from a poll are considered for autocommitting. PollRecords is not affected
+// by this option and always uses the limit it is passed.
+//
+// A value of 0 implies no limit, which is the default.
+func MaxPollRecords(n int) ConsumerOpt {
+	return consumerOpt{func(cfg *cfg) { cfg.maxPollRecords = n }}
+}
+
 // ConsumeResetOffset sets the offset to start consuming from, or if
 // OffsetOutOfRange is seen while fetching, to restart consuming from. The
 // default is NewOffset().AtStart(), i.e., the earliest offset.
@@ -1276,6 +1451,15 @@ func ConsumeResetOffset(offset Offset) ConsumerOpt {
 //
 // Consuming from a preferred replica can increase latency but can decrease
 // cross datacenter costs. See KIP-392 for more information.
+//
+// If consuming as part of a group with the "consumer" protocol, the rack is
+// also sent in the member metadata when joining the group (KIP-881). Rack
+// aware balancers can read it from kmsg.ConsumerMemberMetadata's Rack field
+// to prefer assigning partitions that have a replica in the member's rack;
+// the balancers in this package currently ignore it. Brokers older than
+// Kafka 2.4 do not support consuming from a follower and always reply from
+// the leader; the rack in group metadata is opaque to the broker and is only
+// interpreted by the group leader's balancer.
 func Rack(rack string) ConsumerOpt {
 	return consumerOpt{func(cfg *cfg) { cfg.rack = rack }}
 }
@@ -1307,6 +1491,24 @@ func KeepControlRecords() ConsumerOpt {
 	return consumerOpt{func(cfg *cfg) { cfg.keepControl = true }}
 }
 
+// ConsumeRawBatches opts into the unsafe raw batch mode: fetched record
+// batches are not decompressed or decoded, and are instead returned whole in
+// FetchPartition.RawBatches with their batch metadata. This is meant for
+// mirroring, where decoding records only to re-encode them wastes CPU; pair it
+// with Client.ProduceRawBatch.
+//
+// In this mode, offsets advance per batch rather than per record. If you
+// begin consuming in the middle of a batch, the whole batch is returned, so
+// the first batch may contain records before the offset you asked for.
+// Aborted transactional batches are still dropped with the
+// ReadCommitted isolation level, and control batches are only returned with
+// KeepControlRecords. Old message sets (Kafka < 0.11) are still decoded into
+// Records. Hooks and functions that count buffered records do not count
+// records in raw batches, and PollRecords returns whole partitions.
+func ConsumeRawBatches() ConsumerOpt {
+	return consumerOpt{func(cfg *cfg) { cfg.rawBatches = true }}
+}
+
 // ConsumeTopics adds topics to use for consuming.
 //
 // By default, consuming will start at the beginning of partitions. To change
@@ -1343,10 +1545,52 @@ func ConsumePartitions(partitions map[string]map[int32]Offset) ConsumerOpt {
 // all topics can be passed to any regular expressions. Every topic is
 // evaluated only once ever across all regular expressions; either it
 // permanently is known to match, or is permanently known to not match.
+//
+// The expressions are compiled once when the client is created, and
+// NewClient returns an error if any fail to compile. Expressions use Go's
+// regexp syntax and are NOT anchored: "foo" matches any topic containing foo,
+// such as "foobar". This differs from the Java client, which requires the
+// entire topic to match. Use "^foo$" to match only the topic "foo".
 func ConsumeRegex() ConsumerOpt {
 	return consumerOpt{func(cfg *cfg) { cfg.regex = true }}
 }
 
+// ConsumeRegexExclude sets regular expressions for topics to never consume
+// when consuming with ConsumeRegex: a topic is consumed if it matches any
+// ConsumeTopics expression and does not match any of these. This allows, for
+// example, consuming "^events\\." while excluding "\\.dlq$".
+//
+// Like the consume expressions, these are compiled once when the client is
+// created, are not anchored, and each topic is evaluated only once; the final
+// decision is what is remembered. Internal topics are still never consumed
+// via regex. NewClient returns an error if this is used without ConsumeRegex.
+func ConsumeRegexExclude(patterns ...string) ConsumerOpt {
+	return consumerOpt{func(cfg *cfg) {
+		cfg.regexExclude = make(map[string]*regexp.Regexp, len(patterns))
+		for _, re := range patterns {
+			cfg.regexExclude[re] = nil
+		}
+	}}
+}
+
+// ConsumeRegexExpiry sets how long a topic must be missing from metadata
+// before the client forgets whether it matched the consume regular
+// expressions, default 0 (never).
+//
+// When consuming with ConsumeRegex, the client remembers every topic it has
+// evaluated against the regular expressions, including topics that did not
+// match, so that each topic is only evaluated once. In clusters that create
+// and delete many short lived topics, this grows for the life of the client.
+// Setting this drops topics that have been missing from every metadata
+// response for at least this long. If a dropped topic is created again, it is
+// simply evaluated again.
+//
+// Topics that were being consumed and are deleted are always dropped from the
+// group's interests (and the group rebalances) regardless of this option.
+func ConsumeRegexExpiry(expiry time.Duration) ConsumerOpt {
+	return consumerOpt{func(cfg *cfg) { cfg.regexExpiry = expiry }}
+}
+
 // DisableFetchSessions sets the client to not use fetch sessions (Kafka 1.0+).
 //
 // A "fetch session" is is a way to reduce bandwidth for fetch requests &
@@ -1444,6 +1688,24 @@ func Balancers(balancers ...GroupBalancer) GroupOpt {
 	return groupOpt{func(cfg *cfg) { cfg.balancers = balancers }}
 }
 
+// EagerRebalancing opts into eager (classical) rebalancing with the range and
+// roundrobin balancers, in that order, and is shorthand for
+// Balancers(RangeBalancer(), RoundRobinBalancer()). This is the strategy
+// used by Kafka clients before cooperative rebalancing, and is what you want
+// if the group is shared with clients that only support eager balancing.
+//
+// With eager rebalancing, every rebalance revokes every partition: fetching
+// stops, all buffered fetches are dropped, OnPartitionsRevoked is called with
+// the member's entire assignment, and the member resumes consuming whatever
+// it is assigned once the group is synced again.
+//
+// As with Balancers, a group cannot switch from cooperative to eager
+// rebalancing with a rolling restart (see KIP-429). This option overrides
+// any prior Balancers option, and a later Balancers option overrides this.
+func EagerRebalancing() GroupOpt {
+	return groupOpt{func(cfg *cfg) { cfg.balancers = []GroupBalancer{RangeBalancer(), RoundRobinBalancer()} }}
+}
+
 // SessionTimeout sets how long a member in the group can go between
 // heartbeats, overriding the default 45,000ms. If a member does not heartbeat
 // in this timeout, the broker will remove the member from the group and
@@ -1489,6 +1751,45 @@ func HeartbeatInterval(interval time.Duration) GroupOpt {
 	return groupOpt{func(cfg *cfg) { cfg.heartbeatInterval = interval }}
 }
 
+// HeartbeatJitter randomizes every heartbeat interval and autocommit interval
+// by up to +/- frac of the configured interval, overriding the default of no
+// jitter. frac must be between 0 and 0.5; 0.1 is a reasonable value.
+//
+// Without jitter, a large fleet of consumers that started at the same time
+// heartbeats and autocommits at the same instants, which spikes load on group
+// coordinators. Jitter never pushes a heartbeat interval above half of the
+// session timeout (or above the configured interval, if that is already
+// larger).
+func HeartbeatJitter(frac float64) GroupOpt {
+	return groupOpt{func(cfg *cfg) { cfg.heartbeatJitter = frac }}
+}
+
+// OffsetRequestChunkSize sets the maximum number of partitions the group
+// consumer includes in a single OffsetFetch or OffsetCommit request,
+// overriding the default of 5000.
+//
+// Members with very large assignments split their offset fetches and commits
+// into requests of at most this many partitions and issue a few of them
+// concurrently. Lower this if brokers reject requests for exceeding
+// message.max.bytes or time out on them. Each chunk is retried independently: a chunk that fails
+// does not cause chunks that succeeded to be re-sent.
+func OffsetRequestChunkSize(n int) GroupOpt {
+	return groupOpt{func(cfg *cfg) { cfg.offsetChunkPartitions = n }}
+}
+
+// OnHeartbeat sets a function to be called after every heartbeat request
+// completes, with nil if the heartbeat succeeded or the heartbeat's error
+// otherwise (including RebalanceInProgress when a rebalance begins). This can
+// be used to feed liveness or readiness probes, such as by recording the time
+// of the last successful heartbeat.
+//
+// The function is called synchronously from the heartbeat goroutine: the next
+// heartbeat is not sent until it returns. Do not do heavy work or block in this
+// function, otherwise the group's session can time out. See also GroupStatus.
+func OnHeartbeat(fn func(error)) GroupOpt {
+	return groupOpt{func(cfg *cfg) { cfg.onHeartbeat = fn }}
+}
+
 // RequireStableFetchOffsets sets the group consumer to require "stable" fetch
 // offsets before consuming from the group. Proposed in KIP-447 and introduced
 // in Kafka 2.5, stable offsets are important when consuming from partitions
@@ -1503,10 +1804,41 @@ func HeartbeatInterval(interval time.Duration) GroupOpt {
 // transactional timeouts to a small value (10s) rather than the default 60s.
 // Lowering the transactional timeout will reduce the chance that consumers are
 // entirely blocked.
+//
+// While offsets are unstable, the client retries fetching them every second
+// (only for the unstable partitions' requests) rather than failing the group
+// session. If the group coordinator does not support OffsetFetch v7 (Kafka
+// older than 2.5), the broker cannot honor this and the option is ignored.
 func RequireStableFetchOffsets() GroupOpt {
 	return groupOpt{func(cfg *cfg) { cfg.requireStable = true }}
 }
 
+// GroupErrorBackoff sets the backoff used in between attempts to rejoin the
+// group after the group management loop errors, overriding the default of
+// using the client's RetryBackoffFn (which is jittered). The function is
+// passed the number of consecutive group errors, starting at 1. The count is
+// only reset once a group session is stable enough to heartbeat successfully,
+// so a coordinator that accepts joins but then immediately errors continues to
+// be backed off from increasingly.
+//
+// While backing off, the client also refreshes metadata in case the error was
+// due to stale metadata; see GroupErrorMetadataWait. This option allows group
+// recovery latency to be tuned independently of the general request retry
+// backoff.
+func GroupErrorBackoff(backoff func(int) time.Duration) GroupOpt {
+	return groupOpt{func(cfg *cfg) { cfg.groupErrBackoff = backoff }}
+}
+
+// GroupErrorMetadataWait sets how long to wait for the metadata refresh that
+// is triggered after the group management loop errors, overriding the default
+// of waiting for up to the group error backoff. The client rejoins once both
+// the metadata wait and the backoff have elapsed (measured from the error), so
+// a short wait with a short GroupErrorBackoff allows a group to recover
+// quickly while metadata is slow.
+func GroupErrorMetadataWait(wait time.Duration) GroupOpt {
+	return groupOpt{func(cfg *cfg) { cfg.groupErrMetaWait = wait }}
+}
+
 // BlockRebalanceOnPoll switches the client to block rebalances whenever you
 // poll until you explicitly call AllowRebalance. This option also ensures that
 // any OnPartitions{Assigned,Revoked,Lost} callbacks are only called when you
@@ -1533,7 +1865,9 @@ func RequireStableFetchOffsets() GroupOpt {
 // quickly, and that your OnPartitions{Assigned,Revoked,Lost} callbacks are
 // fast. It is recommended you also use PollRecords rather than PollFetches so
 // that you can bound how many records you process at once. You must always
-// AllowRebalances when you are done processing the records you received. Only
+// AllowRebalances when you are done processing the records you received. If
+// you do not allow rebalancing within the RebalanceTimeout, the client logs an
+// error and proceeds with the rebalance as if you did. Only
 // rebalances that lose partitions are blocked; rebalances that are strictly
 // net additions or non-modifications do not block (the On callbacks are always
 // blocked so that you can ensure their serialization).
@@ -1564,6 +1898,10 @@ func BlockRebalanceOnPoll() GroupOpt {
 // "epoch" with WithEpoch(-1). If the epoch is non-negative, the client performs
 // data loss detection, which may result in errors and unexpected behavior.
 //
+// Each offset's CommitMetadata returns the metadata that was committed with it,
+// which can be used to restore external state that was checkpointed in the
+// commit.
+//
 // This function is called after OnPartitionsAssigned and may be called before
 // or after OnPartitionsRevoked.
 func AdjustFetchOffsetsFn(adjustOffsetsBeforeAssign func(context.Context, map[string]map[int32]Offset) (map[string]map[int32]Offset, error)) GroupOpt {
@@ -1607,6 +1945,15 @@ func OnPartitionsAssigned(onAssigned func(context.Context, *Client, map[string][
 // autocommitting), it is highly recommended to do a proper blocking commit in
 // OnPartitionsRevoked.
 //
+// This function is called without any of the client's consumer or group locks
+// held, and never while the group is joining or syncing, so a blocking commit
+// (CommitOffsetsSync, CommitUncommittedOffsets, CommitRecords) from within it
+// cannot deadlock against the client. A blocking commit here waits for any
+// in-flight asynchronous commit to finish first. If you use
+// BlockRebalanceOnPoll, the client waits for AllowRebalance before calling
+// this function, so do not wait in this function for your poll loop to call
+// AllowRebalance.
+//
 // This function is not called concurrent with any other OnPartitions callback,
 // and this function is given a new map that the user is free to modify.
 //
@@ -1620,6 +1967,30 @@ func OnPartitionsRevoked(onRevoked func(context.Context, *Client, map[string][]i
 	return groupOpt{func(cfg *cfg) { cfg.onRevoked, cfg.setRevoked = onRevoked, true }}
 }
 
+// OnPartitionsRevokedDrain is an alternative to OnPartitionsRevoked for
+// consumers that need to finish in-flight work (for example, a batched
+// database write) and commit before revoked partitions are given to another
+// member. It is called wherever OnPartitionsRevoked would be, but the client
+// does not continue the rebalance until the passed drained function is called
+// or the context's deadline passes, whichever is first. The function itself
+// may return before calling drained; drained may be called from any
+// goroutine, and calls after the first are ignored.
+//
+// The context has a deadline of 90% of the RebalanceTimeout, leaving a margin
+// for the client to rejoin before the group evicts this member. The client
+// keeps heartbeating while waiting, so the session does not expire while
+// draining. If the deadline passes, the client logs a warning and continues
+// the rebalance; anything not yet committed will be reprocessed by the new
+// owner.
+//
+// This option cannot be used with OnPartitionsRevoked, and unlike
+// OnPartitionsRevoked, there is no default commit: you must commit within
+// fn. Everything documented for OnPartitionsRevoked about locks and
+// BlockRebalanceOnPoll applies here as well.
+func OnPartitionsRevokedDrain(fn func(ctx context.Context, cl *Client, revoked map[string][]int32, drained func())) GroupOpt {
+	return groupOpt{func(cfg *cfg) { cfg.onRevokedDrain = fn }}
+}
+
 // OnPartitionsLost sets the function to be called on "fatal" group errors,
 // such as IllegalGeneration, UnknownMemberID, and authentication failures.
 // This function differs from [OnPartitionsRevoked] in that it is unlikely that
@@ -1641,8 +2012,13 @@ func OnPartitionsLost(onLost func(context.Context, *Client, map[string][]int32))
 
 // OnOffsetsFetched sets a function to be called after offsets have been
 // fetched after a group has been balanced. This function is meant to allow
-// users to inspect offset commit metadata. An error can be returned to exit
-// this group session and exit back to join group.
+// users to inspect offset commit metadata: each partition in the response
+// has the Metadata string that was committed alongside its offset. An error
+// can be returned to exit this group session and exit back to join group.
+//
+// The same metadata is available per partition through
+// Offset.CommitMetadata in AdjustFetchOffsetsFn, and from the admin client
+// with kadm's FetchOffsets.
 //
 // This function should not exceed the rebalance interval. It is possible for
 // the group, immediately after finishing a balance, to re-enter a new
@@ -1655,6 +2031,20 @@ func OnOffsetsFetched(onFetched func(context.Context, *Client, *kmsg.OffsetFetch
 	return groupOpt{func(cfg *cfg) { cfg.onFetched = onFetched }}
 }
 
+// ResetOffsetFunc sets a function that returns the offset to start consuming
+// from for an assigned partition that has no committed offset, overriding
+// ConsumeResetOffset per partition. This allows, for example, consuming a
+// compacted topic from the start while consuming an event stream from the
+// end.
+//
+// The function is called while fetching offsets after a group balance, once
+// per uncommitted partition. If it returns the zero Offset (Offset{}), the
+// client uses ConsumeResetOffset. This only chooses where a new partition
+// starts; resetting after OFFSET_OUT_OF_RANGE always uses ConsumeResetOffset.
+func ResetOffsetFunc(fn func(topic string, partition int32) Offset) GroupOpt {
+	return groupOpt{func(cfg *cfg) { cfg.resetOffsetFn = fn }}
+}
+
 // DisableAutoCommit disable auto committing.
 //
 // If you disable autocommitting, you may want to use a custom
@@ -1694,6 +2084,37 @@ func AutoCommitInterval(interval time.Duration) GroupOpt {
 	return groupOpt{func(cfg *cfg) { cfg.autocommitInterval = interval }}
 }
 
+// AutoCommitPauseWait sets how long the default OnPartitionsRevoked waits for
+// autocommitting to be resumed if it is paused with PauseAutoCommit, overriding
+// the default 10s. If autocommitting is still paused once this wait elapses,
+// the revoke does not commit and the offsets will be reconsumed by whichever
+// member is assigned the partitions next.
+//
+// This wait is part of the rebalance, so it should be well below the
+// rebalance timeout.
+func AutoCommitPauseWait(wait time.Duration) GroupOpt {
+	return groupOpt{func(cfg *cfg) { cfg.autocommitPauseWait = wait }}
+}
+
+// AutoCommitOnClose commits everything that has been polled (or marked, with
+// AutoCommitMarks) when the client leaves the group via Close or LeaveGroup,
+// waiting up to timeout for the commit to finish. The commit is issued after
+// fetching stops and before OnPartitionsRevoked and the LeaveGroup request.
+//
+// Without this option, the same final commit happens only if you do not
+// override OnPartitionsRevoked, and its retries are bounded by the rebalance
+// timeout. With this option, the final commit happens even if you override
+// OnPartitionsRevoked, so you no longer need to do one final synchronous commit
+// yourself before leaving the group. If the coordinator is unreachable, leaving
+// continues once the timeout passes and the offsets are reconsumed by the next
+// member.
+//
+// This does nothing if autocommitting is disabled or the client is
+// transactional.
+func AutoCommitOnClose(timeout time.Duration) GroupOpt {
+	return groupOpt{func(cfg *cfg) { cfg.autocommitOnClose = timeout }}
+}
+
 // AutoCommitMarks switches the autocommitting behavior to only commit "marked"
 // records, which can be done with the MarkCommitRecords method.
 //
@@ -1730,6 +2151,14 @@ func AutoCommitMarks() GroupOpt {
 // issues a leave group request on behalf of this instance ID (see kcl), or you
 // can manually use the kmsg package with a proper LeaveGroupRequest.
 //
+// If another process joins the group with the same instance ID, the broker
+// fences this client and returns FENCED_INSTANCE_ID from its next heartbeat,
+// join, or sync. A fenced client calls OnPartitionsLost and stops
+// managing the group, returning an ErrGroupFatal from FatalGroupError and
+// injecting it into a poll. Retrying would only fence the other process in
+// turn, so recovery requires operator intervention: stop the duplicate
+// process and create a new client.
+//
 // NOTE: Leaving a group with an instance ID is only supported in Kafka 2.4+.
 //
 // NOTE: If you restart a consumer group leader that is using an instance ID,
@@ -1740,6 +2169,85 @@ func InstanceID(id string) GroupOpt {
 	return groupOpt{func(cfg *cfg) { cfg.instanceID = &id }}
 }
 
+// RegexRefreshInterval, if consuming a group via ConsumeRegex, forces a
+// metadata refresh every interval so that new topics matching the regular
+// expressions are discovered promptly, independent of MetadataMaxAge and any
+// other metadata triggers. Refreshes are still limited by MetadataMinAge.
+//
+// Regex consumers load all topics on every metadata refresh, so a short
+// interval with many topics in the cluster can be expensive. By default, no
+// extra refreshes are issued and new topics are discovered on the normal
+// MetadataMaxAge cadence. Topics that are deleted are dropped after
+// MissingTopicDelete, and a topic recreated with the same name is matched
+// again.
+func RegexRefreshInterval(interval time.Duration) GroupOpt {
+	return groupOpt{func(cfg *cfg) { cfg.regexRefresh = interval }}
+}
+
+// CheckInstanceIDConflict opts into verifying, after the first successful
+// join and sync with an InstanceID, that no other member of the group is
+// using the same instance ID.
+//
+// Two clients accidentally sharing an instance ID continually fence each
+// other, which is hard to diagnose from the resulting error storm. With this
+// option, the client issues one DescribeGroups request after its first join
+// and checks that exactly one member has this client's instance ID, and that
+// the member has this client's member ID and client ID. If another member is
+// found, the client stops managing the group and the conflict is returned as
+// an *ErrGroupFatal wrapping *ErrInstanceIDConflict, the same as any other
+// fatal group error.
+//
+// The check requires DESCRIBE on the group. If the describe itself fails, the
+// failure is logged and the check is retried on the next join.
+func CheckInstanceIDConflict() GroupOpt {
+	return groupOpt{func(cfg *cfg) { cfg.instanceIDCheck = true }}
+}
+
+// StopOnUnrecoverableGroupErrors opts into stopping group management when
+// the group errors in a way that retrying is unlikely to fix: the group is at
+// its max size (GROUP_MAX_SIZE_REACHED), the client is not authorized to use
+// the group (GROUP_AUTHORIZATION_FAILED), or the client is not authorized to
+// fetch the offsets of some of its assigned topics (TOPIC_AUTHORIZATION_FAILED).
+//
+// By default, the client backs off and rejoins on these errors like any
+// other, which allows a consumer to recover at runtime once, for example, the
+// missing ACLs are added. With this option, the client instead stops
+// managing the group and the error is returned as an *ErrGroupFatal from
+// FatalGroupError and injected into a poll. A FENCED_INSTANCE_ID error always
+// stops group management, regardless of this option.
+func StopOnUnrecoverableGroupErrors() GroupOpt {
+	return groupOpt{func(cfg *cfg) { cfg.stopOnGroupAuth = true }}
+}
+
+// ResumeUnassignedPartitions opts into resuming individually paused
+// partitions (see PauseFetchPartitions) once a rebalance finishes without the
+// partitions being assigned to this member.
+//
+// By default, paused partitions persist until resumed, even if a rebalance
+// moves them to another member: if a partition is later assigned back, it is
+// still paused. With this option, at the start of every group session, any
+// individually paused partition of a topic the group consumes that is not in
+// the new assignment is resumed. This includes partitions that were paused
+// before they were ever assigned. Partitions that stay assigned across a
+// rebalance stay paused, and paused topics (see PauseFetchTopics) are left
+// alone.
+func ResumeUnassignedPartitions() GroupOpt {
+	return groupOpt{func(cfg *cfg) { cfg.resumeUnassigned = true }}
+}
+
+// StrictGroupValidation makes NewClient return an error for group option
+// combinations that are contradictory but that are otherwise accepted with a
+// logged warning, for backwards compatibility:
+//
+//   - a heartbeat interval larger than the session timeout
+//   - an InstanceID without a ConsumerGroup, or an empty InstanceID
+//   - a TransactionalID with AutoCommitMarks or GreedyAutoCommit
+//
+// It is recommended to use this option in new code.
+func StrictGroupValidation() GroupOpt {
+	return groupOpt{func(cfg *cfg) { cfg.strictGroupValidation = true }}
+}
+
 // GroupProtocol sets the group's join protocol, overriding the default value
 // "consumer". The only reason to override this is if you are implementing
 // custom join and sync group logic.
@@ -1747,6 +2255,20 @@ func GroupProtocol(protocol string) GroupOpt {
 	return groupOpt{func(cfg *cfg) { cfg.protocol = protocol }}
 }
 
+// CommitMetadata sets a function that returns the metadata to commit alongside
+// each partition's offset, overriding the default of the group member ID. The
+// function is called with the topic, partition, and offset being committed for
+// every commit the client issues, including autocommits, commits in revoke,
+// and transactional offset commits. The metadata can be read back with
+// FetchCommittedOffsetsWithMetadata.
+//
+// Metadata given explicitly to CommitOffsetsWithMetadata takes precedence over
+// this function. Brokers reject metadata longer than
+// offset.metadata.max.bytes (default 4096) with OFFSET_METADATA_TOO_LARGE.
+func CommitMetadata(fn func(topic string, partition int32, eo EpochOffset) string) GroupOpt {
+	return groupOpt{func(cfg *cfg) { cfg.commitMetadata = fn }}
+}
+
 // AutoCommitCallback sets the callback to use if autocommitting is enabled.
 // This overrides the default callback that logs errors and continues.
 func AutoCommitCallback(fn func(*Client, *kmsg.OffsetCommitRequest, *kmsg.OffsetCommitResponse, error)) GroupOpt {
@@ -25,6 +25,8 @@ type Offset struct {
 
 	noReset    bool
 	afterMilli bool
+
+	metadata string // commit metadata, only set for offsets fetched from a group
 }
 
 // Random negative, only significant within this package.
@@ -57,6 +59,15 @@ func (o Offset) EpochOffset() EpochOffset {
 	}
 }
 
+// CommitMetadata returns the metadata that was committed alongside this offset,
+// if this offset was fetched from a group's committed offsets (i.e., it was
+// passed to the AdjustFetchOffsetsFn function). This is empty for any other
+// offset, or if the commit had no metadata. See CommitMetadata for customizing
+// the metadata that is committed.
+func (o Offset) CommitMetadata() string {
+	return o.metadata
+}
+
 // NewOffset creates and returns an offset to use in [ConsumePartitions] or
 // [ConsumeResetOffset].
 //
@@ -141,6 +152,13 @@ func (o Offset) AtCommitted() Offset {
 // Relative copies 'o' and returns an offset that starts 'n' relative to what
 // 'o' currently is. If 'o' is at the end (from [AtEnd]), Relative(-100) will
 // begin 100 before the end.
+//
+// Relative offsets are resolved per partition when the partition is first
+// consumed, by listing the partition's start and end offsets. The result is
+// bounded to the partition's log start and end: with AtEnd().Relative(-100), a
+// partition with fewer than 100 records begins at its log start. This applies
+// anywhere an Offset is used to begin consuming, including ConsumePartitions,
+// ConsumeResetOffset, and group partitions that have no commit.
 func (o Offset) Relative(n int64) Offset {
 	o.afterMilli = false
 	o.relative = n
@@ -275,7 +293,30 @@ func (c *consumer) waitAndAddRebalance() {
 	c.pollWaitMu.Lock()
 	defer c.pollWaitMu.Unlock()
 	c.pollWaitState += 1 << 32
+	if c.pollWaitState&math.MaxUint32 == 0 {
+		return
+	}
+
+	// If the user forgets to AllowRebalance, we do not want to block
+	// forever: after the rebalance timeout, our member is kicked from the
+	// group anyway. We proceed, and mask out the pollers as if the user
+	// allowed rebalancing.
+	var timedOut bool
+	timer := time.AfterFunc(c.cl.cfg.rebalanceTimeout, func() {
+		c.pollWaitMu.Lock()
+		timedOut = true
+		c.pollWaitMu.Unlock()
+		c.pollWaitC.Broadcast()
+	})
+	defer timer.Stop()
 	for c.pollWaitState&math.MaxUint32 != 0 {
+		if timedOut {
+			c.cl.cfg.logger.Log(LogLevelError, "BlockRebalanceOnPoll: AllowRebalance was not called within the rebalance timeout after polling, proceeding with the rebalance anyway; records being processed may be from revoked partitions",
+				"rebalance_timeout", c.cl.cfg.rebalanceTimeout,
+			)
+			c.pollWaitState &= math.MaxUint32 << 32
+			return
+		}
 		c.pollWaitC.Wait()
 	}
 }
@@ -325,6 +366,10 @@ func (c *consumer) init(cl *Client) {
 	c.sourcesReadyCond = sync.NewCond(&c.sourcesReadyMu)
 	c.pollWaitC = sync.NewCond(&c.pollWaitMu)
 
+	if cl.cfg.producerOnly {
+		return
+	}
+
 	if len(cl.cfg.topics) > 0 || len(cl.cfg.partitions) > 0 {
 		defer cl.triggerUpdateMetadataNow("querying metadata for consumer initialization") // we definitely want to trigger a metadata update
 	}
@@ -392,13 +437,16 @@ func NewErrFetch(err error) Fetches {
 // any partition has a fatal error and actually had no records, fake fetch will
 // be injected with the error.
 //
+// If the MaxPollRecords option is used, this returns at most that many
+// records across all fetches.
+//
 // If you are group consuming, a rebalance can happen under the hood while you
 // process the returned fetches. This can result in duplicate work, and you may
 // accidentally commit to partitions that you no longer own. You can prevent
 // this by using BlockRebalanceOnPoll, but this comes with different tradeoffs.
 // See the documentation on BlockRebalanceOnPoll for more information.
 func (cl *Client) PollFetches(ctx context.Context) Fetches {
-	return cl.PollRecords(ctx, 0)
+	return cl.PollRecords(ctx, cl.cfg.maxPollRecords)
 }
 
 // PollRecords waits for records to be available, returning as soon as any
@@ -423,11 +471,36 @@ func (cl *Client) PollFetches(ctx context.Context) Fetches {
 // this by using BlockRebalanceOnPoll, but this comes with different tradeoffs.
 // See the documentation on BlockRebalanceOnPoll for more information.
 func (cl *Client) PollRecords(ctx context.Context, maxPollRecords int) Fetches {
+	return cl.pollRecords(ctx, maxPollRecords, nil)
+}
+
+// PollFetchesInto is PollFetches, but reuses the memory backing f from a
+// prior poll rather than allocating new Fetches, and stores the result in f.
+// This is meant for high throughput consumers that poll in a tight loop and
+// want to avoid a per-poll allocation.
+//
+// The prior contents of f are invalidated: once this is called, you must no
+// longer use anything from the prior poll that was not copied out. Individual
+// topics, partitions, and records are still allocated per fetch response and
+// are not reused.
+func (cl *Client) PollFetchesInto(ctx context.Context, f *Fetches) {
+	reuse := *f
+	for i := range reuse {
+		reuse[i] = Fetch{} // drop references to the prior poll
+	}
+	*f = cl.pollRecords(ctx, cl.cfg.maxPollRecords, reuse[:0])
+}
+
+func (cl *Client) pollRecords(ctx context.Context, maxPollRecords int, fetches Fetches) Fetches {
 	if maxPollRecords == 0 {
 		maxPollRecords = -1
 	}
 	c := &cl.consumer
 
+	if cl.cfg.producerOnly {
+		return NewErrFetch(ErrConsumingDisabled)
+	}
+
 	c.g.undirtyUncommitted()
 
 	// If the user gave us a canceled context, we bail immediately after
@@ -440,7 +513,6 @@ func (cl *Client) PollRecords(ctx context.Context, maxPollRecords int) Fetches {
 		}
 	}
 
-	var fetches Fetches
 	fill := func() {
 		if c.cl.cfg.blockRebalanceOnPoll {
 			c.waitAndAddPoller()
@@ -605,6 +677,11 @@ func (cl *Client) PauseFetchTopics(topics ...string) []string {
 // PauseFetchPartitions, and then pause that same topic with PauseFetchTopics,
 // the individually paused partitions will not be unpaused if you only call
 // ResumeFetchTopics.
+//
+// If you are consuming as part of a group, paused partitions remain assigned
+// and the member keeps heartbeating. A paused partition stays paused across
+// rebalances, even if it is no longer assigned to this member; use the
+// ResumeUnassignedPartitions option to resume such partitions automatically.
 func (cl *Client) PauseFetchPartitions(topicPartitions map[string][]int32) map[string][]int32 {
 	c := &cl.consumer
 	if len(topicPartitions) == 0 {
@@ -665,7 +742,10 @@ func (cl *Client) ResumeFetchPartitions(topicPartitions map[string][]int32) {
 // If using transactions, it is advised to just use a GroupTransactSession and
 // avoid this function entirely.
 //
-// If using group consuming, It is strongly recommended to use this function
+// If using group consuming, only partitions currently assigned to this member
+// are set; this can be used from OnPartitionsAssigned to start consuming from
+// externally stored positions. Any partitions that are skipped because they
+// are not assigned are logged at the warn level. It is strongly recommended to use this function
 // outside of the context of a PollFetches loop and only when you know the
 // group is not revoked (i.e., block any concurrent revoke while issuing this
 // call) and to not use this concurrent with committing. Any other usage is
@@ -693,8 +773,15 @@ func (cl *Client) setOffsets(setOffsets map[string]map[int32]EpochOffset, log bo
 		assigns = c.d.getSetAssigns(setOffsets)
 		tps = c.d.tps
 	case c.g != nil:
-		assigns = c.g.getSetAssigns(setOffsets)
+		var skipped map[string][]int32
+		assigns, skipped = c.g.getSetAssigns(setOffsets)
 		tps = c.g.tps
+		if log && len(skipped) > 0 {
+			cl.cfg.logger.Log(LogLevelWarn, "skipping SetOffsets for partitions that are not assigned to this member",
+				"group", cl.cfg.group,
+				"skipped", skipped,
+			)
+		}
 	}
 	if len(assigns) == 0 {
 		return
@@ -709,43 +796,118 @@ func (cl *Client) setOffsets(setOffsets map[string]map[int32]EpochOffset, log bo
 // This is guaranteed to be called in a blocking metadata fn, which ensures
 // that metadata does not load the tps we are changing. Basically, we ensure
 // everything w.r.t. consuming is at a stand still.
-func (c *consumer) purgeTopics(topics []string) {
+//
+// If the topics were deleted, we also drop their uncommitted offsets in the
+// group: committing them would fail, and if a topic is recreated, the old
+// offsets are meaningless for the new topic.
+func (c *consumer) purgeTopics(topics []string, deleted bool) {
 	if c.g == nil && c.d == nil {
 		return
 	}
 
-	purgeAssignments := make(map[string]map[int32]Offset, len(topics))
-	for _, topic := range topics {
-		purgeAssignments[topic] = nil
-	}
-
 	c.waitAndAddRebalance()
 	defer c.unaddRebalance()
 
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	// The difference for groups is we need to lock the group and there is
-	// a slight type difference in g.using vs d.using.
 	if c.g != nil {
 		c.g.mu.Lock()
 		defer c.g.mu.Unlock()
+	}
+	c.purgeTopicsLocked(topics, deleted)
+	if c.g != nil {
+		c.g.rejoin("rejoin from PurgeFetchTopics")
+	}
+}
+
+// purgeTopicsLocked removes topics from consuming. This must be called with
+// the consumer mutex (and the group mutex, if consuming as a group) held, and
+// with an added rebalance.
+func (c *consumer) purgeTopicsLocked(topics []string, deleted bool) {
+	purgeAssignments := make(map[string]map[int32]Offset, len(topics))
+	for _, topic := range topics {
+		purgeAssignments[topic] = nil
+	}
+
+	// The difference for groups is a slight type difference in g.using vs
+	// d.using.
+	if c.g != nil {
 		c.assignPartitions(purgeAssignments, assignPurgeMatching, c.g.tps, fmt.Sprintf("purge of %v requested", topics))
 		for _, topic := range topics {
 			delete(c.g.using, topic)
 			delete(c.g.reSeen, topic)
+			delete(c.g.reMissing, topic)
+			if deleted {
+				delete(c.g.uncommitted, topic)
+			}
 		}
-		c.g.rejoin("rejoin from PurgeFetchTopics")
 	} else {
 		c.assignPartitions(purgeAssignments, assignPurgeMatching, c.d.tps, fmt.Sprintf("purge of %v requested", topics))
 		for _, topic := range topics {
 			delete(c.d.using, topic)
 			delete(c.d.reSeen, topic)
+			delete(c.d.reMissing, topic)
 			delete(c.d.m, topic)
 		}
 	}
 }
 
+// setTopics changes the consumed topics to exactly topics in one step, while
+// metadata is blocked, so that the group only rejoins once with the full new
+// subscription. The rejoin happens on the next metadata update, once the
+// partitions for any added topics are known.
+func (c *consumer) setTopics(topics []string) {
+	c.waitAndAddRebalance()
+	defer c.unaddRebalance()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var tps *topicsPartitions
+	if c.g != nil {
+		c.g.mu.Lock()
+		defer c.g.mu.Unlock()
+		tps = c.g.tps
+	} else {
+		tps = c.d.tps
+	}
+
+	want := make(map[string]bool, len(topics))
+	for _, topic := range topics {
+		want[topic] = true
+	}
+	var purge []string
+	for topic := range tps.load() {
+		if want[topic] {
+			delete(want, topic)
+		} else {
+			purge = append(purge, topic)
+		}
+	}
+	add := make([]string, 0, len(want))
+	for topic := range want {
+		add = append(add, topic)
+	}
+	if len(purge) == 0 && len(add) == 0 {
+		return
+	}
+
+	if len(purge) > 0 {
+		sort.Strings(purge) // for logging
+		c.purgeTopicsLocked(purge, false)
+	}
+	tps.storeTopics(add)
+	if c.g != nil {
+		c.g.subscriptionChanged = true
+	} else {
+		for _, topic := range add {
+			c.d.m.addt(topic)
+		}
+	}
+	c.cl.triggerUpdateMetadataNow("from SetConsumeTopics")
+}
+
 // AddConsumeTopics adds new topics to be consumed. This function is a no-op if
 // the client is configured to consume via regex.
 //
@@ -776,6 +938,31 @@ func (cl *Client) AddConsumeTopics(topics ...string) {
 	cl.triggerUpdateMetadataNow("from AddConsumeTopics")
 }
 
+// SetConsumeTopics changes the topics being consumed to exactly the input
+// topics: topics not yet consumed are added as with AddConsumeTopics, and
+// topics no longer wanted are removed as with PurgeTopicsFromConsuming. This
+// function is a no-op if the client is configured to consume via regex.
+//
+// The topics are swapped in one step. When consuming as a group, this does not
+// leave and rejoin the group from scratch. Partitions for removed topics stop
+// being fetched immediately, and the member rejoins once with its full new
+// subscription after the next metadata update (which is triggered immediately)
+// loads any added topics. A cooperative member keeps consuming its other
+// partitions throughout, and partitions for the removed topics are passed to
+// OnPartitionsRevoked once the rebalance moves them away.
+//
+// If you are directly consuming, topics consumed via ConsumePartitions are
+// included in the current set of topics, and are removed if not in the input.
+func (cl *Client) SetConsumeTopics(topics ...string) {
+	c := &cl.consumer
+	if c.g == nil && c.d == nil || cl.cfg.regex {
+		return
+	}
+	cl.blockingMetadataFn(func() {
+		c.setTopics(topics)
+	})
+}
+
 // GetConsumeTopics retrives a list of current topics being consumed.
 func (cl *Client) GetConsumeTopics() []string {
 	c := &cl.consumer
@@ -1004,7 +1191,14 @@ func (c *consumer) assignPartitions(assignments map[string]map[int32]Offset, how
 		// our topicPartitions.
 		session = c.guardSessionChange(tps)
 	} else {
-		loadOffsets, _ = c.stopSession()
+		// Invalidating specific partitions only needs to discard
+		// those partitions from buffered fetches; the rest of what is
+		// buffered remains pollable.
+		var discard map[string]map[int32]Offset
+		if how == assignInvalidateMatching {
+			discard = assignments
+		}
+		loadOffsets, _ = c.stopSession(discard)
 
 		// First, over all cursors currently in use, we unset them or set them
 		// directly as appropriate. Anything we do not unset, we keep.
@@ -1196,23 +1390,41 @@ func (c *consumer) filterMetadataAllTopics(topics []string) []string {
 	defer rns.log(&c.cl.cfg)
 
 	var reSeen map[string]bool
+	var reMissing map[string]time.Time
 	if c.d != nil {
-		reSeen = c.d.reSeen
+		reSeen, reMissing = c.d.reSeen, c.d.reMissing
 	} else {
-		reSeen = c.g.reSeen
+		reSeen, reMissing = c.g.reSeen, c.g.reMissing
+	}
+
+	var present map[string]struct{}
+	if c.cl.cfg.regexExpiry > 0 {
+		present = make(map[string]struct{}, len(topics))
 	}
 
 	keep := topics[:0]
 	for _, topic := range topics {
+		if present != nil {
+			present[topic] = struct{}{}
+		}
 		want, seen := reSeen[topic]
 		if !seen {
+			var matchedRe string
 			for rawRe, re := range c.cl.cfg.topics {
 				if want = re.MatchString(topic); want {
-					rns.add(rawRe, topic)
+					matchedRe = rawRe
 					break
 				}
 			}
-			if !want {
+			for _, re := range c.cl.cfg.regexExclude {
+				if !want {
+					break
+				}
+				want = !re.MatchString(topic)
+			}
+			if want {
+				rns.add(matchedRe, topic)
+			} else {
 				rns.skip(topic)
 			}
 			reSeen[topic] = want
@@ -1221,9 +1433,30 @@ func (c *consumer) filterMetadataAllTopics(topics []string) []string {
 			keep = append(keep, topic)
 		}
 	}
+	if present != nil {
+		expireReSeen(reSeen, reMissing, present, c.cl.cfg.regexExpiry, time.Now())
+	}
 	return keep
 }
 
+// expireReSeen drops topics from reSeen that have been missing from metadata
+// for at least expiry.
+func expireReSeen(reSeen map[string]bool, reMissing map[string]time.Time, present map[string]struct{}, expiry time.Duration, now time.Time) {
+	for topic := range reSeen {
+		if _, ok := present[topic]; ok {
+			delete(reMissing, topic)
+			continue
+		}
+		since, missing := reMissing[topic]
+		if !missing {
+			reMissing[topic] = now
+		} else if now.Sub(since) >= expiry {
+			delete(reSeen, topic)
+			delete(reMissing, topic)
+		}
+	}
+}
+
 func (c *consumer) doOnMetadataUpdate() {
 	if !c.consuming() {
 		return
@@ -1637,7 +1870,10 @@ func (c *consumer) unguardSessionChange(session *consumerSession) {
 // all fetching, listing, offset for leader epoching is complete. This
 // invalidates any buffered fetches for the previous session and returns any
 // partitions that were listing offsets or loading epochs.
-func (c *consumer) stopSession() (listOrEpochLoads, *topicsPartitions) {
+//
+// If discard is non-nil, only buffered partitions in discard are invalidated
+// and the rest of any buffered fetch is kept for polling.
+func (c *consumer) stopSession(discard map[string]map[int32]Offset) (listOrEpochLoads, *topicsPartitions) {
 	c.sessionChangeMu.Lock()
 
 	session := c.loadSession()
@@ -1678,14 +1914,20 @@ func (c *consumer) stopSession() (listOrEpochLoads, *topicsPartitions) {
 
 	c.sourcesReadyMu.Lock()
 	defer c.sourcesReadyMu.Unlock()
+	var keep []*source
 	for _, ready := range c.sourcesReadyForDraining {
-		ready.discardBuffered()
+		if discard == nil {
+			ready.discardBuffered()
+		} else if ready.discardBufferedMatching(discard) {
+			keep = append(keep, ready)
+		}
 	}
-	c.sourcesReadyForDraining = nil
+	c.sourcesReadyForDraining = keep
 
 	// At this point, we have invalidated any buffered data from the prior
-	// session. We leave any fake things that were ready so that the user
-	// can act on errors. The session is dead.
+	// session (or only the partitions in discard). We leave any fake
+	// things that were ready so that the user can act on errors. The
+	// session is dead.
 
 	session.listOrEpochLoadsWaiting.mergeFrom(session.listOrEpochLoadsLoading)
 	return session.listOrEpochLoadsWaiting, session.tps
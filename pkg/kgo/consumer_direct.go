@@ -1,5 +1,7 @@
 package kgo
 
+import "time"
+
 type directConsumer struct {
 	cfg    *cfg
 	tps    *topicsPartitions           // data for topics that the user assigned
@@ -7,16 +9,19 @@ type directConsumer struct {
 	m      mtmps                       // mirrors cfg.topics and cfg.partitions, but can change with Purge or Add
 	ps     map[string]map[int32]Offset // mirrors cfg.partitions, changed in Purge or Add
 	reSeen map[string]bool             // topics we evaluated against regex, and whether we want them or not
+
+	reMissing map[string]time.Time // reSeen topics missing from metadata, and since when; see ConsumeRegexExpiry
 }
 
 func (c *consumer) initDirect() {
 	d := &directConsumer{
-		cfg:    &c.cl.cfg,
-		tps:    newTopicsPartitions(),
-		reSeen: make(map[string]bool),
-		using:  make(mtmps),
-		m:      make(mtmps),
-		ps:     make(map[string]map[int32]Offset),
+		cfg:       &c.cl.cfg,
+		tps:       newTopicsPartitions(),
+		reSeen:    make(map[string]bool),
+		reMissing: make(map[string]time.Time),
+		using:     make(mtmps),
+		m:         make(mtmps),
+		ps:        make(map[string]map[int32]Offset),
 	}
 	c.d = d
 
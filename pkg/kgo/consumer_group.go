@@ -5,6 +5,8 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"math/rand"
+	"slices"
 	"sort"
 	"strings"
 	"sync"
@@ -24,13 +26,32 @@ type groupConsumer struct {
 	cancel     func()
 	manageDone chan struct{} // closed once when the manage goroutine quits
 
+	// commitLoopDone, if non-nil, is closed once the autocommit loop
+	// quits. This is only set in manage before the loop is started.
+	commitLoopDone chan struct{}
+
+	// leaveCommitted is set once commitOnLeave has taken over the final
+	// commit, so that the default revoke that follows does not commit
+	// a second time.
+	leaveCommitted atomicBool
+
 	cooperative atomicBool // true if the group balancer chosen during Join is cooperative
 
 	// The data for topics that the user assigned. Metadata updates the
 	// atomic.Value in each pointer atomically.
 	tps *topicsPartitions
 
-	reSeen map[string]bool // topics we evaluated against regex, and whether we want them or not
+	reSeen    map[string]bool      // topics we evaluated against regex, and whether we want them or not
+	reMissing map[string]time.Time // reSeen topics missing from metadata, and since when; see ConsumeRegexExpiry
+
+	// shrinkSeen tracks used topics that the last metadata update had
+	// fewer partitions for, and how many. Only used in findNewAssignments.
+	shrinkSeen map[string]int
+
+	// subscriptionChanged is set in SetConsumeTopics and read in
+	// findNewAssignments, both under the consumer mutex, so that we
+	// rejoin once with the new subscription on the next metadata update.
+	subscriptionChanged bool
 
 	// Full lock grabbed in CommitOffsetsSync, read lock grabbed in
 	// CommitOffsets, this lock ensures that only one sync commit can
@@ -136,17 +157,74 @@ type groupConsumer struct {
 	// async commit request. If another commit happens, it cancels the
 	// prior commit, waits for the prior to be done, and then starts its
 	// own.
-	commitCancel func()
-	commitDone   chan struct{}
+	commitCancel     func()
+	commitDone       chan struct{}
+	commitSuperseded *atomicBool
+
+	// superseded counts the commits that have been canceled for a newer
+	// commit; see ErrCommitSuperseded.
+	superseded atomicI64
+
+	// fatal is set if the manage loop quit due to an ErrGroupFatal.
+	fatal atomic.Value
+
+	// sessionErr is the last error that broke a group session that
+	// retrying does not fix on its own, cleared on the next successful
+	// join and sync; see GroupError.
+	sessionErr atomic.Value // groupSessionErr
 
 	// blockAuto is set and cleared in CommitOffsets{,Sync} to block
 	// autocommitting if autocommitting is active. This ensures that an
 	// autocommit does not cancel the user's manual commit.
 	blockAuto bool
 
+	// revokeCommitting is set while the default revoke is committing,
+	// including between retries, to block autocommitting.
+	revokeCommitting bool
+
+	// autoPaused is the PauseAutoCommit depth. When the depth is
+	// non-zero, autocommitting is skipped and the default revoke waits
+	// for autoResumed to be closed. autoPausedWarned ensures we only
+	// warn once per pause that outlives the session timeout.
+	autoPaused       int
+	autoPausedAt     time.Time
+	autoResumed      chan struct{}
+	autoPausedWarned bool
+
 	// We set this once to manage the group lifecycle once.
 	managing bool
 
+	// revokedCommitted tracks the committed offsets of partitions that a
+	// cooperative revoke just removed from uncommitted, and the
+	// generation they were revoked in. If the very next generation
+	// grants any of these partitions back to us, nobody else could have
+	// owned them in between and we can resume from the offsets we know
+	// rather than fetching them again. This is consumed (and cleared) by
+	// the next fetchOffsets.
+	revokedCommitted map[string]map[int32]revokedCommit
+
+	// instanceIDChecked is set in the manage goroutine once the
+	// CheckInstanceIDConflict describe succeeds.
+	instanceIDChecked bool
+
+	// consuming is true once a group session has fetched offsets for
+	// its assignment, and false while joining or between sessions.
+	// stableCh is closed and replaced whenever consuming changes, which
+	// wakes anything in WaitGroupStable.
+	//
+	// state is written under stableMu and loaded atomically; see
+	// GroupStatus.
+	stableMu  sync.Mutex
+	consuming bool
+	stableCh  chan struct{}
+	state     atomic.Value // groupMemberState
+
+	// heartbeats is a ring of the most recent heartbeat results, with
+	// nheartbeats the total number recorded; see GroupStatus.
+	heartbeatsMu sync.Mutex
+	heartbeats   [heartbeatHistory]HeartbeatResult
+	nheartbeats  int
+
 	dying    bool // set when closing, read in findNewAssignments
 	left     chan struct{}
 	leaveErr error // set before left is closed
@@ -194,7 +272,7 @@ func (g *groupMemberGen) storeMember(memberID string) {
 // rebalance to complete before the group can be left. This is necessary to
 // allow you to safely issue one final offset commit in OnPartitionsRevoked. If
 // you have overridden the default revoke, you must manually commit offsets
-// before leaving the group.
+// before leaving the group, or use the AutoCommitOnClose option.
 //
 // If you have configured the group with an InstanceID, this does not leave the
 // group. With instance IDs, it is expected that clients will restart and
@@ -261,8 +339,30 @@ func (cl *Client) LeaveGroupContext(ctx context.Context) error {
 	}
 }
 
+// CurrentAssignment returns a copy of the partitions this client currently
+// owns in its group, or nil if the client is not consuming as part of a group.
+// If the client is in a group but owns nothing (before the first sync, or
+// while assigned nothing), this returns an empty map.
+//
+// Cooperative consumers keep their partitions while rebalancing, so this
+// returns the prior assignment until the rebalance finishes, minus anything
+// revoked along the way. Eager consumers revoke everything at the start of a
+// rebalance, so this returns an empty map until the next sync completes.
+func (cl *Client) CurrentAssignment() map[string][]int32 {
+	g := cl.consumer.g
+	if g == nil {
+		return nil
+	}
+	return g.nowAssigned.clone()
+}
+
 // GroupMetadata returns the current group member ID and generation, or an
 // empty string and -1 if not in the group.
+//
+// The member ID and generation are stored together when a JoinGroup response
+// is received, so the two returned values are always from the same join and
+// are current by the time SyncGroup completes. This is useful to correlate
+// client logs with the group coordinator's logs.
 func (cl *Client) GroupMetadata() (string, int32) {
 	g := cl.consumer.g
 	if g == nil {
@@ -271,6 +371,513 @@ func (cl *Client) GroupMetadata() (string, int32) {
 	return g.memberGen.load()
 }
 
+// heartbeatHistory is how many heartbeat results GroupStatus returns.
+const heartbeatHistory = 16
+
+// HeartbeatResult is the result of a single heartbeat request.
+type HeartbeatResult struct {
+	// At is when the heartbeat was issued.
+	At time.Time
+	// Latency is how long the heartbeat took, including any internal
+	// retries and waiting for a connection.
+	Latency time.Duration
+	// Err is the heartbeat error, if any.
+	Err error
+}
+
+// GroupStatus is a point in time view of a client's group membership, as
+// returned from Client.GroupStatus.
+type GroupStatus struct {
+	// Group is the group being consumed.
+	Group string
+	// State is the member's current state, and StateSince is when the
+	// client entered that state.
+	State      GroupMemberState
+	StateSince time.Time
+	// Err is set if the state is GroupMemberUnjoined because the last
+	// group session errored, or if the state is GroupMemberDead because
+	// of a fatal error (the same error as FatalGroupError). The session
+	// error may be routine, such as the member's generation being
+	// rejected after a rebalance; the client rejoins on its own. Err is
+	// nil otherwise, including if the client is dead because it left the
+	// group.
+	Err error
+	// MemberID and Generation are as returned from GroupMetadata.
+	MemberID   string
+	Generation int32
+	// Coordinator is the group's coordinator, if it is currently known.
+	Coordinator *BrokerMetadata
+	// Heartbeats are up to the last 16 heartbeat results, oldest first.
+	Heartbeats []HeartbeatResult
+}
+
+// GroupStatus returns the client's current group membership state,
+// coordinator, and recent heartbeat results. This is meant for health checks,
+// e.g. a readiness probe that requires GroupMemberStable or alerting if a
+// member has been GroupMemberRebalancing for too long, as well as for
+// investigating session timeouts: it shows which broker the client thinks is
+// the coordinator and how recent heartbeats went. This returns the zero
+// GroupStatus, with state GroupMemberUnknown, if the client is not consuming
+// as part of a group. This does not issue any requests.
+func (cl *Client) GroupStatus() GroupStatus {
+	g := cl.consumer.g
+	if g == nil {
+		return GroupStatus{}
+	}
+	state, _ := g.state.Load().(groupMemberState)
+	s := GroupStatus{
+		Group:      g.cfg.group,
+		State:      state.state,
+		StateSince: state.since,
+		Err:        state.err,
+	}
+	s.MemberID, s.Generation = g.memberGen.load()
+	if meta, ok := cl.cachedCoordinator(coordinatorTypeGroup, g.cfg.group); ok {
+		s.Coordinator = &meta
+	}
+
+	g.heartbeatsMu.Lock()
+	defer g.heartbeatsMu.Unlock()
+	n := g.nheartbeats
+	if n > heartbeatHistory {
+		n = heartbeatHistory
+	}
+	s.Heartbeats = make([]HeartbeatResult, 0, n)
+	for i := g.nheartbeats - n; i < g.nheartbeats; i++ {
+		s.Heartbeats = append(s.Heartbeats, g.heartbeats[i%heartbeatHistory])
+	}
+	return s
+}
+
+// GroupState returns the client's current group membership state, when the
+// client entered that state, and the error for the state, if any. These are
+// the State, StateSince, and Err fields of GroupStatus; this function is a
+// cheaper alternative for health checks that are polled frequently and only
+// need the state. This returns GroupMemberUnknown if the client is not
+// consuming as part of a group.
+func (cl *Client) GroupState() (state GroupMemberState, since time.Time, err error) {
+	g := cl.consumer.g
+	if g == nil {
+		return GroupMemberUnknown, time.Time{}, nil
+	}
+	s, _ := g.state.Load().(groupMemberState)
+	return s.state, s.since, s.err
+}
+
+// GroupDescription is a description of the client's group, as returned from
+// Client.DescribeGroup.
+type GroupDescription struct {
+	// Group is the group being described.
+	Group string
+	// State is the group state, e.g. "Stable" or "PreparingRebalance".
+	State string
+	// ProtocolType is the group's protocol type, "consumer" by default.
+	ProtocolType string
+	// Protocol is the balancer protocol the group chose, e.g.
+	// "cooperative-sticky".
+	Protocol string
+	// Members are the group's members, sorted by member ID.
+	Members []GroupMemberDescription
+}
+
+// GroupMemberDescription describes one member of a group.
+type GroupMemberDescription struct {
+	// MemberID is the member's ID.
+	MemberID string
+	// InstanceID is the member's instance ID, if it is a static member.
+	InstanceID *string
+	// ClientID and ClientHost are the client ID and host of the member.
+	ClientID   string
+	ClientHost string
+	// Topics are the topics the member is interested in, decoded from its
+	// join metadata. This is nil if the group does not use the consumer
+	// protocol or if the metadata could not be decoded.
+	Topics []string
+	// Assigned is the member's current assignment, decoded with the
+	// group's chosen balancer the same way as a SyncGroup assignment. This
+	// is nil if the assignment could not be decoded, or if the member has
+	// no assignment yet.
+	Assigned map[string][]int32
+}
+
+// DescribeGroup issues a DescribeGroups request for the client's group and
+// returns the group's members along with what each is interested in and
+// assigned. This is meant for tooling and debugging, e.g. investigating
+// lopsided assignments, and returns an error if the client is not consuming
+// as part of a group.
+func (cl *Client) DescribeGroup(ctx context.Context) (GroupDescription, error) {
+	g := cl.consumer.g
+	if g == nil {
+		return GroupDescription{}, errNotGroup
+	}
+	req := kmsg.NewPtrDescribeGroupsRequest()
+	req.Groups = []string{g.cfg.group}
+	resp, err := req.RequestWith(ctx, cl)
+	if err != nil {
+		return GroupDescription{}, err
+	}
+	if len(resp.Groups) != 1 {
+		return GroupDescription{}, fmt.Errorf("describe groups response has %d groups, expected 1", len(resp.Groups))
+	}
+	return describedGroup(&resp.Groups[0], g.cfg.balancers)
+}
+
+// describedGroup converts a described group into a GroupDescription, parsing
+// assignments with the balancer that matches the group's protocol.
+func describedGroup(rg *kmsg.DescribeGroupsResponseGroup, balancers []GroupBalancer) (GroupDescription, error) {
+	if err := kerr.ErrorForCode(rg.ErrorCode); err != nil {
+		return GroupDescription{}, err
+	}
+	d := GroupDescription{
+		Group:        rg.Group,
+		State:        rg.State,
+		ProtocolType: rg.ProtocolType,
+		Protocol:     rg.Protocol,
+		Members:      make([]GroupMemberDescription, 0, len(rg.Members)),
+	}
+	parse := ParseConsumerSyncAssignment
+	for _, b := range balancers {
+		if b.ProtocolName() == rg.Protocol {
+			parse = b.ParseSyncAssignment
+			break
+		}
+	}
+	for _, rm := range rg.Members {
+		m := GroupMemberDescription{
+			MemberID:   rm.MemberID,
+			InstanceID: rm.InstanceID,
+			ClientID:   rm.ClientID,
+			ClientHost: rm.ClientHost,
+		}
+		if rg.ProtocolType == "consumer" {
+			var meta kmsg.ConsumerMemberMetadata
+			if err := meta.ReadFrom(rm.ProtocolMetadata); err == nil {
+				m.Topics = meta.Topics
+			}
+		}
+		if len(rm.MemberAssignment) > 0 {
+			m.Assigned, _ = parse(rm.MemberAssignment)
+		}
+		d.Members = append(d.Members, m)
+	}
+	sort.Slice(d.Members, func(i, j int) bool { return d.Members[i].MemberID < d.Members[j].MemberID })
+	return d, nil
+}
+
+// heartbeatedSince returns whether any recorded heartbeat that began at or
+// after t succeeded.
+func (g *groupConsumer) heartbeatedSince(t time.Time) bool {
+	g.heartbeatsMu.Lock()
+	defer g.heartbeatsMu.Unlock()
+	for i := g.nheartbeats - 1; i >= 0 && i >= g.nheartbeats-heartbeatHistory; i-- {
+		hb := &g.heartbeats[i%heartbeatHistory]
+		if hb.At.Before(t) {
+			return false
+		}
+		if hb.Err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// recordHeartbeat is called from the heartbeat loop after every heartbeat, and
+// also calls the user's OnHeartbeat, if any.
+func (g *groupConsumer) recordHeartbeat(start time.Time, err error) {
+	g.heartbeatsMu.Lock()
+	g.heartbeats[g.nheartbeats%heartbeatHistory] = HeartbeatResult{
+		At:      start,
+		Latency: time.Since(start),
+		Err:     err,
+	}
+	g.nheartbeats++
+	g.heartbeatsMu.Unlock()
+
+	if g.cfg.onHeartbeat != nil {
+		g.cfg.onHeartbeat(err)
+	}
+}
+
+// GroupTimeouts returns the session timeout, rebalance timeout, and heartbeat
+// interval that the client uses when joining and heartbeating in a group,
+// after any defaults have been applied. These are the values sent to the
+// broker in JoinGroup requests and used for the heartbeat loop.
+//
+// The configuration is immutable once the client is created, so these values
+// are constant for the life of the client. If the client is not consuming as
+// part of a group, these return the configured (or default) values regardless.
+func (cl *Client) GroupTimeouts() (session, rebalance, heartbeat time.Duration) {
+	return cl.cfg.sessionTimeout, cl.cfg.rebalanceTimeout, cl.cfg.heartbeatInterval
+}
+
+// PauseAutoCommit pauses autocommitting until a matching ResumeAutoCommit.
+// Pauses are reference counted: each call must be paired with a call to
+// ResumeAutoCommit, and autocommitting only resumes once every pause has been
+// resumed. This allows nested critical sections during which offsets must not
+// be committed.
+//
+// While paused, the periodic autocommit is skipped and the default
+// OnPartitionsRevoked waits up to AutoCommitPauseWait for autocommitting to
+// be resumed before committing. Manual commits are unaffected.
+//
+// Pausing across a full session timeout is likely a bug and is logged as a
+// warning. This function does nothing if the client is not consuming as part
+// of a group.
+func (cl *Client) PauseAutoCommit() {
+	g := cl.consumer.g
+	if g == nil {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.autoPaused++
+	if g.autoPaused == 1 {
+		g.autoPausedAt = time.Now()
+		g.autoResumed = make(chan struct{})
+		g.autoPausedWarned = false
+	}
+}
+
+// ResumeAutoCommit undoes one PauseAutoCommit. Autocommitting resumes once
+// every pause has been resumed. Calling this more times than PauseAutoCommit
+// is logged and otherwise ignored.
+func (cl *Client) ResumeAutoCommit() {
+	g := cl.consumer.g
+	if g == nil {
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.autoPaused == 0 {
+		g.cfg.logger.Log(LogLevelWarn, "ResumeAutoCommit called without a matching PauseAutoCommit, ignoring", "group", g.cfg.group)
+		return
+	}
+	g.autoPaused--
+	if g.autoPaused == 0 {
+		close(g.autoResumed)
+		g.autoResumed = nil
+	}
+}
+
+// AutoCommitPaused returns how many PauseAutoCommit calls are outstanding
+// and, if any, when autocommitting was first paused. This returns 0 and the
+// zero time if autocommitting is not paused or if the client is not consuming
+// as part of a group.
+func (cl *Client) AutoCommitPaused() (depth int, since time.Time) {
+	g := cl.consumer.g
+	if g == nil {
+		return 0, time.Time{}
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.autoPaused == 0 {
+		return 0, time.Time{}
+	}
+	return g.autoPaused, g.autoPausedAt
+}
+
+// groupSessionErr wraps an error so that it can be cleared in an atomic.Value.
+type groupSessionErr struct{ err error }
+
+// GroupError returns the last error that broke this member's group session
+// that retrying does not fix on its own, such as GROUP_AUTHORIZATION_FAILED or
+// INVALID_SESSION_TIMEOUT, or nil if there is none. Retriable errors, such as
+// the coordinator moving, and routine rejoins, such as the group rebalancing
+// or the member being unknown to the coordinator, are not returned. The error
+// is cleared once the member successfully joins and syncs the group again. If
+// the client stopped managing the group because of a fatal error, this
+// returns the same error as FatalGroupError.
+//
+// Every error that breaks a group session is also injected into a poll as an
+// ErrGroupSession; this function is for applications that want to check
+// whether the group is healthy, such as to alert or crash rather than retry
+// forever.
+func (cl *Client) GroupError() error {
+	g := cl.consumer.g
+	if g == nil {
+		return nil
+	}
+	if fatal := cl.FatalGroupError(); fatal != nil {
+		return fatal
+	}
+	se, _ := g.sessionErr.Load().(groupSessionErr)
+	return se.err
+}
+
+// FatalGroupError returns the error that caused the client to stop managing
+// its group, or nil if the group is still being managed. The returned error,
+// if non-nil, is an *ErrGroupFatal. When the client stops, OnPartitionsLost is
+// called, the underlying error is passed to HookGroupManageError, and the
+// *ErrGroupFatal is injected into a poll as an ErrGroupSession. Because the
+// client never rejoins after a fatal error, this error is never cleared.
+func (cl *Client) FatalGroupError() error {
+	g := cl.consumer.g
+	if g == nil {
+		return nil
+	}
+	if fatal, _ := g.fatal.Load().(*ErrGroupFatal); fatal != nil {
+		return fatal
+	}
+	return nil
+}
+
+// WaitGroupStable blocks until this member has joined the group, been
+// assigned at least one partition, and fetched the starting offsets for its
+// assignment such that fetching has begun. This returns the group's fatal
+// error if the group stops being managed, ErrClientClosed if the client is
+// closed, or the context error if the context is canceled first.
+//
+// This is meant for tests and startup probes. A member that is in the group
+// but is assigned nothing never becomes stable; use a context deadline to
+// bound waiting.
+func (cl *Client) WaitGroupStable(ctx context.Context) error {
+	return cl.waitGroupStable(ctx, func(map[string][]int32) bool { return true })
+}
+
+// WaitPartitionAssigned is like WaitGroupStable, but additionally waits until
+// the given topic partition is assigned to this member.
+func (cl *Client) WaitPartitionAssigned(ctx context.Context, topic string, partition int32) error {
+	return cl.waitGroupStable(ctx, func(assigned map[string][]int32) bool {
+		for _, p := range assigned[topic] {
+			if p == partition {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+func (cl *Client) waitGroupStable(ctx context.Context, want func(map[string][]int32) bool) error {
+	g := cl.consumer.g
+	if g == nil {
+		return errNotGroup
+	}
+	for {
+		consuming, changed := g.stableState()
+		if consuming {
+			if assigned := g.nowAssigned.read(); len(assigned) > 0 && want(assigned) {
+				return nil
+			}
+		}
+		select {
+		case <-changed:
+		case <-g.manageDone:
+			if err := cl.FatalGroupError(); err != nil {
+				return err
+			}
+			return ErrClientClosed
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-cl.ctx.Done():
+			return ErrClientClosed
+		}
+	}
+}
+
+// stableState returns whether the group session is consuming, and a channel
+// that is closed when that changes.
+func (g *groupConsumer) stableState() (bool, <-chan struct{}) {
+	g.stableMu.Lock()
+	defer g.stableMu.Unlock()
+	if g.stableCh == nil {
+		g.stableCh = make(chan struct{})
+	}
+	return g.consuming, g.stableCh
+}
+
+func (g *groupConsumer) setConsuming(consuming bool) {
+	g.stableMu.Lock()
+	defer g.stableMu.Unlock()
+	if g.consuming == consuming {
+		return
+	}
+	g.consuming = consuming
+	if consuming {
+		g.setStateLocked(GroupMemberStable, nil)
+	}
+	if g.stableCh != nil {
+		close(g.stableCh)
+		g.stableCh = nil
+	}
+}
+
+// GroupMemberState is the state of a client's membership in its group, as
+// returned in GroupStatus.
+type GroupMemberState int8
+
+const (
+	// GroupMemberUnknown is the zero state, returned if the client is not
+	// consuming as part of a group.
+	GroupMemberUnknown GroupMemberState = iota
+	// GroupMemberUnjoined is the state before the client first joins the
+	// group, and after a group session errors until the client rejoins.
+	GroupMemberUnjoined
+	// GroupMemberJoining is the state while issuing JoinGroup.
+	GroupMemberJoining
+	// GroupMemberSyncing is the state while issuing SyncGroup.
+	GroupMemberSyncing
+	// GroupMemberStable is the state once the client has been assigned
+	// partitions and fetched their offsets, i.e., it is consuming.
+	GroupMemberStable
+	// GroupMemberRebalancing is the state once a stable member observes a
+	// rebalance, until it is stable again. The client joins and syncs
+	// while rebalancing, but the state is not changed to joining or
+	// syncing so that the entire rebalance can be timed.
+	GroupMemberRebalancing
+	// GroupMemberDead is the state once the client stops managing the
+	// group, either because it left the group or because of a fatal error.
+	GroupMemberDead
+)
+
+func (s GroupMemberState) String() string {
+	switch s {
+	case GroupMemberUnjoined:
+		return "Unjoined"
+	case GroupMemberJoining:
+		return "Joining"
+	case GroupMemberSyncing:
+		return "Syncing"
+	case GroupMemberStable:
+		return "Stable"
+	case GroupMemberRebalancing:
+		return "Rebalancing"
+	case GroupMemberDead:
+		return "Dead"
+	default:
+		return "Unknown"
+	}
+}
+
+// groupMemberState is what is stored in groupConsumer.state.
+type groupMemberState struct {
+	state GroupMemberState
+	since time.Time
+	err   error
+}
+
+// setState updates the group state, keeping the time the state was entered
+// if the state is unchanged.
+func (g *groupConsumer) setState(state GroupMemberState, err error) {
+	g.stableMu.Lock()
+	defer g.stableMu.Unlock()
+	g.setStateLocked(state, err)
+}
+
+func (g *groupConsumer) setStateLocked(state GroupMemberState, err error) {
+	cur, _ := g.state.Load().(groupMemberState)
+	switch {
+	case cur.state == GroupMemberDead:
+		return // dead is final
+	case cur.state == GroupMemberRebalancing && (state == GroupMemberJoining || state == GroupMemberSyncing):
+		return // we are still rebalancing
+	}
+	since := time.Now()
+	if cur.state == state {
+		since = cur.since
+	}
+	g.state.Store(groupMemberState{state: state, since: since, err: err})
+}
+
 func (c *consumer) initGroup() {
 	ctx, cancel := context.WithCancel(c.cl.ctx)
 	g := &groupConsumer{
@@ -281,7 +888,8 @@ func (c *consumer) initGroup() {
 		ctx:    ctx,
 		cancel: cancel,
 
-		reSeen: make(map[string]bool),
+		reSeen:    make(map[string]bool),
+		reMissing: make(map[string]time.Time),
 
 		manageDone:       make(chan struct{}),
 		tps:              newTopicsPartitions(),
@@ -291,11 +899,16 @@ func (c *consumer) initGroup() {
 
 		left: make(chan struct{}),
 	}
+	g.state.Store(groupMemberState{state: GroupMemberUnjoined, since: time.Now()})
 	c.g = g
 	if !g.cfg.setCommitCallback {
 		g.cfg.commitCallback = g.defaultCommitCallback
 	}
 
+	if g.cfg.onRevokedDrain != nil {
+		g.cfg.onRevoked, g.cfg.setRevoked = g.drainRevoke(g.cfg.onRevokedDrain), true
+	}
+
 	if g.cfg.txnID == nil {
 		// We only override revoked / lost if they were not explicitly
 		// set by options.
@@ -309,9 +922,14 @@ func (c *consumer) initGroup() {
 			g.cfg.onLost = func(context.Context, *Client, map[string][]int32) {}
 		}
 	} else {
+		if !g.cfg.autocommitDisable {
+			g.cfg.logger.Log(LogLevelInfo, "disabling autocommitting because the client is transactional; offsets are committed when ending transactions", "group", g.cfg.group)
+		}
 		g.cfg.autocommitDisable = true
 	}
 
+	g.warnSuspiciousCfg()
+
 	for _, logOn := range []struct {
 		name string
 		set  *func(context.Context, *Client, map[string][]int32)
@@ -363,6 +981,58 @@ func (c *consumer) initGroup() {
 		}
 		g.tps.storeTopics(topics)
 	}
+
+	if g.cfg.regex && g.cfg.regexRefresh > 0 {
+		go g.loopRegexRefresh()
+	}
+}
+
+// loopRegexRefresh periodically triggers a metadata update so that regex
+// consumers notice new (and deleted) topics on their own schedule.
+func (g *groupConsumer) loopRegexRefresh() {
+	ticker := time.NewTicker(g.cfg.regexRefresh)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+		case <-g.ctx.Done():
+			return
+		}
+		g.cl.triggerUpdateMetadata(false, "regex refresh interval")
+	}
+}
+
+// warnSuspiciousCfg logs warnings for group option combinations that are
+// valid but are likely not what the user intended. Outright contradictory
+// options are rejected in cfg.validate.
+func (g *groupConsumer) warnSuspiciousCfg() {
+	var coop, eager []string
+	for _, b := range g.cfg.balancers {
+		if b.IsCooperative() {
+			coop = append(coop, b.ProtocolName())
+		} else {
+			eager = append(eager, b.ProtocolName())
+		}
+	}
+	if len(coop) > 0 && len(eager) > 0 {
+		g.cfg.logger.Log(LogLevelWarn, "group balancers mix cooperative and eager protocols; this is only meant for upgrading a group to cooperative balancing, and the group will use eager rebalancing if the chosen protocol is eager",
+			"group", g.cfg.group,
+			"cooperative", coop,
+			"eager", eager,
+		)
+	}
+
+	if g.cfg.setLost && !g.cfg.setRevoked {
+		g.cfg.logger.Log(LogLevelWarn, "OnPartitionsLost is set but OnPartitionsRevoked is not; revoked partitions use the default revoke behavior rather than your lost function", "group", g.cfg.group)
+	}
+
+	if g.cfg.instanceID != nil {
+		g.cfg.logger.Log(LogLevelInfo, "using static group membership; restarts that take longer than the session timeout will trigger a rebalance",
+			"group", g.cfg.group,
+			"instance_id", *g.cfg.instanceID,
+			"session_timeout", g.cfg.sessionTimeout,
+		)
+	}
 }
 
 // Manages the group consumer's join / sync / heartbeat / fetch offset flow.
@@ -373,10 +1043,21 @@ func (c *consumer) initGroup() {
 // dedicated goroutine until the group is left.
 func (g *groupConsumer) manage() {
 	defer close(g.manageDone)
+	defer func() {
+		var err error
+		if fatal, _ := g.fatal.Load().(*ErrGroupFatal); fatal != nil {
+			err = fatal
+		}
+		g.setState(GroupMemberDead, err)
+	}()
 	g.cfg.logger.Log(LogLevelInfo, "beginning to manage the group lifecycle", "group", g.cfg.group)
 	if !g.cfg.autocommitDisable && g.cfg.autocommitInterval > 0 {
 		g.cfg.logger.Log(LogLevelInfo, "beginning autocommit loop", "group", g.cfg.group)
-		go g.loopCommit()
+		g.commitLoopDone = make(chan struct{})
+		go func() {
+			defer close(g.commitLoopDone)
+			g.loopCommit()
+		}()
 	}
 
 	var consecutiveErrors int
@@ -385,7 +1066,12 @@ func (g *groupConsumer) manage() {
 		if joinWhy == "" {
 			joinWhy = "rejoining from normal rebalance"
 		}
+		sessionStart := time.Now()
 		err := g.joinAndSync(joinWhy)
+		if err == nil {
+			g.sessionErr.Store(groupSessionErr{})
+			err = g.checkInstanceIDOnce()
+		}
 		if err == nil {
 			if joinWhy, err = g.setupAssignedAndHeartbeat(); err != nil {
 				if errors.Is(err, kerr.RebalanceInProgress) {
@@ -394,16 +1080,38 @@ func (g *groupConsumer) manage() {
 			}
 		}
 		if err == nil {
-			consecutiveErrors = 0
+			// We only reset our backoff if the session was stable
+			// long enough to heartbeat successfully; a join that
+			// is immediately followed by an error does not mean
+			// the coordinator is healthy again.
+			if g.heartbeatedSince(sessionStart) {
+				consecutiveErrors = 0
+			}
 			continue
 		}
 		joinWhy = "rejoining after we previously errored and backed off"
 
+		// Hooks and the injected ErrGroupSession are given the error
+		// as it was before we tracked stages; the stage is reported
+		// separately.
+		var stage GroupStage
+		stage, err = splitGroupManageErr(err)
+		fatal := isGroupFatal(err, g.cfg.stopOnGroupAuth)
+		if isGroupSessionErr(err) {
+			g.sessionErr.Store(groupSessionErr{err})
+		}
+
 		// If the user has BlockPollOnRebalance enabled, we have to
 		// block around the onLost and assigning.
 		g.c.waitAndAddRebalance()
 
 		if errors.Is(err, context.Canceled) && g.cfg.onRevoked != nil {
+			// Our final commit: LeaveGroupContext has already
+			// stopped fetching, and the heartbeat loop returns on
+			// cancelation without revoking, so everything polled
+			// is still uncommitted.
+			g.commitOnLeave()
+
 			// The cooperative consumer does not revoke everything
 			// while rebalancing, meaning if our context is
 			// canceled, we may have uncommitted data. Rather than
@@ -428,8 +1136,15 @@ func (g *groupConsumer) manage() {
 				if h, ok := h.(HookGroupManageError); ok {
 					h.OnGroupManageError(err)
 				}
+				if h, ok := h.(HookGroupManageErrorStage); ok {
+					h.OnGroupManageErrorStage(stage, err)
+				}
 			})
-			g.c.addFakeReadyForDraining("", 0, &ErrGroupSession{err}, "notification of group management loop error")
+			sessionErr := err
+			if fatal != nil {
+				sessionErr = fatal
+			}
+			g.c.addFakeReadyForDraining("", 0, &ErrGroupSession{sessionErr}, "notification of group management loop error")
 		}
 
 		// If we are eager, we should have invalidated everything
@@ -446,6 +1161,7 @@ func (g *groupConsumer) manage() {
 			g.mu.Lock()     // before allowing poll to touch uncommitted, lock the group
 			g.c.mu.Unlock() // now part of poll can continue
 			g.uncommitted = nil
+			g.revokedCommitted = nil
 			g.mu.Unlock()
 
 			g.nowAssigned.store(nil)
@@ -463,11 +1179,28 @@ func (g *groupConsumer) manage() {
 		if errors.Is(err, context.Canceled) { // context was canceled, quit now
 			return
 		}
+		if fatal != nil {
+			msg := "join and sync loop errored with a fatal error, no longer managing the group"
+			if errors.Is(fatal, kerr.FencedInstanceID) {
+				msg = "static member was fenced by another member using the same instance id, no longer managing the group; only one process may use an instance id at a time"
+			}
+			g.cfg.logger.Log(LogLevelError, msg,
+				"group", g.cfg.group,
+				"err", fatal,
+			)
+			g.fatal.Store(fatal)
+			return
+		}
+		g.setState(GroupMemberUnjoined, err)
 
 		// Waiting for the backoff is a good time to update our
 		// metadata; maybe the error is from stale metadata.
 		consecutiveErrors++
-		backoff := g.cfg.retryBackoff(consecutiveErrors)
+		backoffFn := g.cfg.retryBackoff
+		if g.cfg.groupErrBackoff != nil {
+			backoffFn = g.cfg.groupErrBackoff
+		}
+		backoff := backoffFn(consecutiveErrors)
 		g.cfg.logger.Log(LogLevelError, "join and sync loop errored",
 			"group", g.cfg.group,
 			"err", err,
@@ -475,7 +1208,11 @@ func (g *groupConsumer) manage() {
 			"backoff", backoff,
 		)
 		deadline := time.Now().Add(backoff)
-		g.cl.waitmeta(g.ctx, backoff, "waitmeta during join & sync error backoff")
+		metaWait := backoff
+		if g.cfg.groupErrMetaWait > 0 {
+			metaWait = g.cfg.groupErrMetaWait
+		}
+		g.cl.waitmeta(g.ctx, metaWait, "waitmeta during join & sync error backoff")
 		after := time.NewTimer(time.Until(deadline))
 		select {
 		case <-g.ctx.Done():
@@ -486,6 +1223,68 @@ func (g *groupConsumer) manage() {
 	}
 }
 
+// checkInstanceIDOnce, if opted into with CheckInstanceIDConflict, describes
+// the group after our first successful join to ensure nobody else is using our
+// instance ID. A conflict is returned as a fatal error; a failure to describe
+// is logged and we try again after the next join.
+func (g *groupConsumer) checkInstanceIDOnce() error {
+	if !g.cfg.instanceIDCheck || g.instanceIDChecked {
+		return nil
+	}
+
+	req := kmsg.NewPtrDescribeGroupsRequest()
+	req.Groups = []string{g.cfg.group}
+	resp, err := req.RequestWith(g.ctx, g.cl)
+	if err == nil && len(resp.Groups) != 1 {
+		err = fmt.Errorf("describe groups response has %d groups, expected 1", len(resp.Groups))
+	}
+	if err == nil {
+		err = kerr.ErrorForCode(resp.Groups[0].ErrorCode)
+	}
+	if err != nil {
+		if errors.Is(err, context.Canceled) {
+			return err
+		}
+		g.cfg.logger.Log(LogLevelWarn, "unable to describe group to check for instance id conflicts, will retry after the next join",
+			"group", g.cfg.group,
+			"err", err,
+		)
+		return nil
+	}
+	g.instanceIDChecked = true
+
+	var (
+		instanceID = *g.cfg.instanceID
+		memberID   = g.memberGen.memberID()
+		clientID   = ""
+		members    []string
+		conflict   bool
+	)
+	if g.cfg.id != nil {
+		clientID = *g.cfg.id
+	}
+	for _, m := range resp.Groups[0].Members {
+		if m.InstanceID == nil || *m.InstanceID != instanceID {
+			continue
+		}
+		members = append(members, fmt.Sprintf("%s %s %s", m.MemberID, m.ClientID, m.ClientHost))
+		if m.MemberID != memberID || m.ClientID != clientID {
+			conflict = true
+		}
+	}
+	// If the broker is too old to return instance IDs in describe
+	// responses, members is empty and we have nothing to check.
+	if !conflict && len(members) <= 1 {
+		g.cfg.logger.Log(LogLevelInfo, "no instance id conflict detected", "group", g.cfg.group, "instance_id", instanceID)
+		return nil
+	}
+	return &ErrGroupFatal{Err: &ErrInstanceIDConflict{
+		InstanceID: instanceID,
+		MemberID:   memberID,
+		Members:    members,
+	}}
+}
+
 func (g *groupConsumer) leave(ctx context.Context) {
 	// If g.using is nonzero before this check, then a manage goroutine has
 	// started. If not, it will never start because we set dying.
@@ -539,6 +1338,52 @@ func (g *groupConsumer) leave(ctx context.Context) {
 	}()
 }
 
+// unpauseUnassigned, if ResumeUnassignedPartitions is used, resumes
+// individually paused partitions of topics we are consuming that are no
+// longer assigned to us. Partitions that stay assigned across a rebalance stay
+// paused. Paused topics are left alone.
+func (g *groupConsumer) unpauseUnassigned() {
+	if !g.cfg.resumeUnassigned {
+		return
+	}
+	c := g.c
+	c.pausedMu.Lock()
+	defer c.pausedMu.Unlock()
+
+	paused := c.loadPaused()
+	if len(paused) == 0 {
+		return
+	}
+	nowAssigned := g.nowAssigned.read()
+	groupTopics := g.tps.load()
+
+	var unassigned map[string][]int32
+	for topic, pps := range paused {
+		if !groupTopics.hasTopic(topic) {
+			continue
+		}
+		assigned := make(map[int32]bool, len(nowAssigned[topic]))
+		for _, p := range nowAssigned[topic] {
+			assigned[p] = true
+		}
+		for p := range pps.m {
+			if !assigned[p] {
+				if unassigned == nil {
+					unassigned = make(map[string][]int32)
+				}
+				unassigned[topic] = append(unassigned[topic], p)
+			}
+		}
+	}
+	if unassigned == nil {
+		return
+	}
+	g.cfg.logger.Log(LogLevelInfo, "resuming paused partitions that are no longer assigned to us", "group", g.cfg.group, "partitions", unassigned)
+	cloned := c.clonePaused()
+	cloned.delPartitions(unassigned)
+	c.storePaused(cloned)
+}
+
 // returns the difference of g.nowAssigned and g.lastAssigned.
 func (g *groupConsumer) diffAssigned() (added, lost map[string][]int32) {
 	nowAssigned := g.nowAssigned.clone()
@@ -685,7 +1530,8 @@ func (g *groupConsumer) revoke(stage revokeStage, lost map[string][]int32, leavi
 		//
 		// We want to invalidate buffered fetches since they may
 		// contain partitions that we lost, and we do not want a future
-		// poll to return those fetches.
+		// poll to return those fetches. Only the lost partitions are
+		// discarded; anything else buffered remains pollable.
 		lostOffsets := make(map[string]map[int32]Offset, len(lost))
 
 		for lostTopic, lostPartitions := range lost {
@@ -731,15 +1577,28 @@ func (g *groupConsumer) revoke(stage revokeStage, lost map[string][]int32, leavi
 	// commit.
 	g.mu.Lock()
 	defer g.mu.Unlock()
+	g.revokedCommitted = nil
 	if g.uncommitted == nil {
 		return
 	}
+	generation := g.memberGen.generation()
 	for lostTopic, lostPartitions := range lost {
 		uncommittedPartitions := g.uncommitted[lostTopic]
 		if uncommittedPartitions == nil {
 			continue
 		}
 		for _, lostPartition := range lostPartitions {
+			if uncommit, ok := uncommittedPartitions[lostPartition]; ok && uncommit.committed.Offset >= 0 && g.cfg.txnID == nil {
+				if g.revokedCommitted == nil {
+					g.revokedCommitted = make(map[string]map[int32]revokedCommit)
+				}
+				rt := g.revokedCommitted[lostTopic]
+				if rt == nil {
+					rt = make(map[int32]revokedCommit)
+					g.revokedCommitted[lostTopic] = rt
+				}
+				rt[lostPartition] = revokedCommit{uncommit.committed, generation}
+			}
 			delete(uncommittedPartitions, lostPartition)
 		}
 		if len(uncommittedPartitions) == 0 {
@@ -835,6 +1694,7 @@ func (g *groupConsumer) setupAssignedAndHeartbeat() (string, error) {
 	s := newAssignRevokeSession()
 	added, lost := g.diffAssigned()
 	g.lastAssigned = g.nowAssigned.clone() // now that we are done with our last assignment, update it per the new assignment
+	g.unpauseUnassigned()
 
 	g.cfg.logger.Log(LogLevelInfo, "new group session begun", "group", g.cfg.group, "added", mtps(added), "lost", mtps(lost))
 	s.prerevoke(g, lost) // for cooperative consumers
@@ -859,6 +1719,7 @@ func (g *groupConsumer) setupAssignedAndHeartbeat() (string, error) {
 	// can kill heartbeating, or signal it to continue, while fetchDone
 	// is specifically used for this function's return.
 	fetchDone := make(chan struct{})
+	defer g.setConsuming(false) // after fetchDone, so a late fetch cannot leave us consuming
 	defer func() { <-fetchDone }()
 
 	// Before we fetch offsets, we wait for the user's onAssign callback to
@@ -895,11 +1756,16 @@ func (g *groupConsumer) setupAssignedAndHeartbeat() (string, error) {
 		go func() {
 			defer close(fetchDone)
 			defer close(fetchErrCh)
-			fetchErrCh <- g.fetchOffsets(ctx, added)
+			err := g.fetchOffsets(ctx, added)
+			if err == nil {
+				g.setConsuming(true)
+			}
+			fetchErrCh <- err
 		}()
 	} else {
 		close(fetchDone)
 		close(fetchErrCh)
+		g.setConsuming(true)
 	}
 
 	// Finally, we simply return whatever the heartbeat error is. This will
@@ -920,7 +1786,7 @@ func (g *groupConsumer) setupAssignedAndHeartbeat() (string, error) {
 // If the offset fetch is successful, then we basically sit in this function
 // until a heartbeat errors or we, being the leader, decide to re-join.
 func (g *groupConsumer) heartbeat(fetchErrCh <-chan error, s *assignRevokeSession) (string, error) {
-	ticker := time.NewTicker(g.cfg.heartbeatInterval)
+	ticker := newJitterTicker(g.cfg.heartbeatInterval, g.cfg.heartbeatJitter, g.cfg.sessionTimeout/2)
 	defer ticker.Stop()
 
 	// We issue one heartbeat quickly if we are cooperative because
@@ -936,6 +1802,12 @@ func (g *groupConsumer) heartbeat(fetchErrCh <-chan error, s *assignRevokeSessio
 	var rejoinWhy string
 	var lastErr error
 
+	// lastOK tracks our last successful heartbeat: if a heartbeat fails
+	// from a transient network or coordinator issue, our session is
+	// likely still alive broker side and we keep heartbeating until it
+	// is at risk of expiring.
+	lastOK := time.Now()
+
 	ctxCh := g.ctx.Done()
 
 	for {
@@ -946,6 +1818,7 @@ func (g *groupConsumer) heartbeat(fetchErrCh <-chan error, s *assignRevokeSessio
 		case <-cooperativeFastCheck:
 			heartbeat = true
 		case <-ticker.C:
+			ticker.next()
 			heartbeat = true
 		case force = <-g.heartbeatForceCh:
 			heartbeat = true
@@ -956,6 +1829,7 @@ func (g *groupConsumer) heartbeat(fetchErrCh <-chan error, s *assignRevokeSessio
 			err = kerr.RebalanceInProgress
 		case err = <-fetchErrCh:
 			fetchErrCh = nil
+			err = groupManageErr(GroupStageFetchOffsets, err)
 		case <-metadone:
 			metadone = nil
 			didMetadone = true
@@ -980,13 +1854,29 @@ func (g *groupConsumer) heartbeat(fetchErrCh <-chan error, s *assignRevokeSessio
 			req.MemberID = memberID
 			req.InstanceID = g.cfg.instanceID
 			var resp *kmsg.HeartbeatResponse
+			start := time.Now()
 			if resp, err = req.RequestWith(g.ctx, g.cl); err == nil {
 				err = kerr.ErrorForCode(resp.ErrorCode)
 			}
+			g.recordHeartbeat(start, err)
 			g.cfg.logger.Log(LogLevelDebug, "heartbeat complete", "group", g.cfg.group, "err", err)
 			if force != nil {
 				force(err)
 			}
+			err = groupManageErr(GroupStageHeartbeat, err)
+			switch {
+			case err == nil:
+				lastOK = time.Now()
+			case lastErr == nil && !didRevoke && revoked == nil &&
+				isTransientHeartbeatErr(err) &&
+				time.Since(lastOK)+g.cfg.heartbeatInterval < g.cfg.sessionTimeout:
+				g.cfg.logger.Log(LogLevelInfo, "heartbeat failed with a transient error, retrying on the next interval before revoking",
+					"group", g.cfg.group,
+					"err", err,
+					"since_last_success", time.Since(lastOK),
+				)
+				err = nil
+			}
 		}
 
 		// The first error either triggers a clean revoke and metadata
@@ -1024,6 +1914,16 @@ func (g *groupConsumer) heartbeat(fetchErrCh <-chan error, s *assignRevokeSessio
 			if !errors.Is(err, kerr.RebalanceInProgress) && revoked == nil {
 				return "", err
 			}
+			g.setState(GroupMemberRebalancing, nil)
+
+			// A cooperative consumer keeps consuming through a
+			// rebalance, and anything processed since the last
+			// autocommit would be reprocessed by a new owner of
+			// a partition we lose. We commit immediately rather
+			// than waiting for the next autocommit tick.
+			if g.cooperative.Load() && !g.cfg.autocommitDisable && g.cfg.autocommitInterval > 0 {
+				g.autocommit("autocommitting early after observing a rebalance")
+			}
 
 			// Now we call the user provided revoke callback, even
 			// if cooperative: if cooperative, this only revokes
@@ -1064,6 +1964,11 @@ func (g *groupConsumer) heartbeat(fetchErrCh <-chan error, s *assignRevokeSessio
 // If neither of the cases above are true (this member is not a leader, and the
 // join group metadata has not changed), then Kafka will not actually trigger a
 // rebalance and will instead reply to the member with its current assignment.
+//
+// This is a no-op if the client is not consuming as part of a group. It is
+// safe to call concurrently and while a rebalance is in progress: requests to
+// rejoin are coalesced, so many calls before the heartbeat loop notices the
+// first result in a single rejoin.
 func (cl *Client) ForceRebalance() {
 	if g := cl.consumer.g; g != nil {
 		g.rejoin("rejoin from ForceRebalance")
@@ -1105,6 +2010,7 @@ start:
 	case <-g.rejoinCh: // drain to avoid unnecessary rejoins
 	default:
 	}
+	g.setState(GroupMemberJoining, nil)
 
 	joinReq := kmsg.NewPtrJoinGroupRequest()
 	joinReq.Group = g.cfg.group
@@ -1142,7 +2048,7 @@ start:
 		return g.cl.ctx.Err() // client closed
 	}
 	if err != nil {
-		return err
+		return groupManageErr(GroupStageJoin, err)
 	}
 
 	restart, protocol, plan, err := g.handleJoinResp(joinResp)
@@ -1151,7 +2057,7 @@ start:
 	}
 	if err != nil {
 		g.cfg.logger.Log(LogLevelWarn, "join group failed", "group", g.cfg.group, "err", err)
-		return err
+		return groupManageErr(GroupStageJoin, err)
 	}
 
 	syncReq := kmsg.NewPtrSyncGroupRequest()
@@ -1171,6 +2077,7 @@ start:
 	)
 
 	g.cfg.logger.Log(LogLevelInfo, "syncing", "group", g.cfg.group, "protocol_type", g.cfg.protocol, "protocol", protocol)
+	g.setState(GroupMemberSyncing, nil)
 	go func() {
 		defer close(synced)
 		syncResp, err = syncReq.RequestWith(g.cl.ctx, g.cl)
@@ -1182,7 +2089,7 @@ start:
 		return g.cl.ctx.Err()
 	}
 	if err != nil {
-		return err
+		return groupManageErr(GroupStageSync, err)
 	}
 
 	if err = g.handleSyncResp(protocol, syncResp); err != nil {
@@ -1191,7 +2098,7 @@ start:
 			goto start
 		}
 		g.cfg.logger.Log(LogLevelWarn, "sync group failed", "group", g.cfg.group, "err", err)
-		return err
+		return groupManageErr(GroupStageSync, err)
 	}
 
 	// KIP-814 fixes one limitation with KIP-345, but has another
@@ -1468,11 +2375,30 @@ func (g *groupConsumer) joinGroupProtocols() []kmsg.JoinGroupRequestProtocol {
 		proto := kmsg.NewJoinGroupRequestProtocol()
 		proto.Name = balancer.ProtocolName()
 		proto.Metadata = balancer.JoinGroupMetadata(topics, lastDup, gen)
+		if g.cfg.protocol == "consumer" {
+			proto.Metadata = memberMetadataWithRack(proto.Metadata, g.cfg.rack)
+		}
 		protos = append(protos, proto)
 	}
 	return protos
 }
 
+// memberMetadataWithRack sets the rack in consumer member metadata so that
+// rack aware balancers can prefer assigning partitions with replicas in the
+// same rack (KIP-881). If the rack is empty, or if the metadata cannot be
+// parsed or is too old to contain the rack, the metadata is returned as is.
+func memberMetadataWithRack(metadata []byte, rack string) []byte {
+	if rack == "" {
+		return metadata
+	}
+	var meta kmsg.ConsumerMemberMetadata
+	if err := meta.ReadFrom(metadata); err != nil || meta.Version < 3 || meta.Rack != nil {
+		return metadata
+	}
+	meta.Rack = &rack
+	return meta.AppendTo(nil)
+}
+
 // If we are cooperatively consuming, we have a potential problem: if fetch
 // offsets is canceled due to an immediate rebalance, when we resume, we will
 // not re-fetch offsets for partitions we were previously assigned and are
@@ -1537,6 +2463,162 @@ func (g *groupConsumer) adjustCooperativeFetchOffsets(added, lost map[string][]i
 	return added
 }
 
+// revokedCommit is a committed offset for a partition we revoked, and the
+// generation we revoked it in.
+type revokedCommit struct {
+	committed  EpochOffset
+	generation int32
+}
+
+// takeRegranted splits added into partitions we need to fetch offsets for and
+// partitions that were revoked from us in the prior generation and granted
+// right back. For the latter, our last commit is the group's commit: nobody
+// else owned the partition in between. Non-transactional commits are visible
+// as soon as they succeed, so we can resume from what we committed without
+// asking the broker. Our tracking of revoked partitions is cleared.
+func (g *groupConsumer) takeRegranted(added map[string][]int32, generation int32) (fetch map[string][]int32, regranted map[string]map[int32]EpochOffset) {
+	g.mu.Lock()
+	revoked := g.revokedCommitted
+	g.revokedCommitted = nil
+	g.mu.Unlock()
+
+	if len(revoked) == 0 {
+		return added, nil
+	}
+	fetch = make(map[string][]int32, len(added))
+	for topic, partitions := range added {
+		rt := revoked[topic]
+		for _, partition := range partitions {
+			if r, ok := rt[partition]; ok && r.generation+1 == generation {
+				if regranted == nil {
+					regranted = make(map[string]map[int32]EpochOffset)
+				}
+				if regranted[topic] == nil {
+					regranted[topic] = make(map[int32]EpochOffset)
+				}
+				regranted[topic][partition] = r.committed
+				continue
+			}
+			fetch[topic] = append(fetch[topic], partition)
+		}
+	}
+	return fetch, regranted
+}
+
+// chunkOffsetFetch splits the partitions to fetch into requests of at most
+// per partitions. A topic with more partitions than the limit is split across
+// requests. Members with huge assignments otherwise issue requests that
+// brokers can time out on, wedging session setup.
+func chunkOffsetFetch(group string, requireStable bool, fetch map[string][]int32, per int) []*kmsg.OffsetFetchRequest {
+	var (
+		reqs []*kmsg.OffsetFetchRequest
+		req  *kmsg.OffsetFetchRequest
+		n    int
+	)
+	for topic, partitions := range fetch {
+		for len(partitions) > 0 {
+			if req == nil || n == per {
+				req = kmsg.NewPtrOffsetFetchRequest()
+				req.Group = group
+				req.RequireStable = requireStable
+				reqs = append(reqs, req)
+				n = 0
+			}
+			take := per - n
+			if take > len(partitions) {
+				take = len(partitions)
+			}
+			reqTopic := kmsg.NewOffsetFetchRequestTopic()
+			reqTopic.Topic = topic
+			reqTopic.Partitions = partitions[:take:take]
+			req.Topics = append(req.Topics, reqTopic)
+			partitions = partitions[take:]
+			n += take
+		}
+	}
+	return reqs
+}
+
+// maxOffsetChunksInFlight bounds how many chunks of a single offset fetch or
+// commit are issued at once.
+const maxOffsetChunksInFlight = 8
+
+// issueChunks calls fn for every chunk index in [0, n), running at most
+// maxOffsetChunksInFlight at once, and returns once all calls are done.
+func issueChunks(n int, fn func(i int)) {
+	var (
+		wg  sync.WaitGroup
+		sem = make(chan struct{}, maxOffsetChunksInFlight)
+	)
+	for i := 0; i < n; i++ {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func(i int) {
+			defer func() { <-sem; wg.Done() }()
+			fn(i)
+		}(i)
+	}
+	wg.Wait()
+}
+
+// fetchOffsetChunks concurrently issues every chunk and merges the responses.
+// A topic can be split across chunks, so partitions are merged into one entry
+// per topic, in chunk order. If any chunk fails, this returns the first error.
+func (g *groupConsumer) fetchOffsetChunks(ctx context.Context, reqs []*kmsg.OffsetFetchRequest) (*kmsg.OffsetFetchResponse, error) {
+	resps := make([]*kmsg.OffsetFetchResponse, len(reqs))
+	errs := make([]error, len(reqs))
+	issueChunks(len(reqs), func(i int) {
+		resps[i], errs[i] = g.fetchOffsetChunk(ctx, reqs[i])
+	})
+
+	var (
+		merged   = kmsg.NewPtrOffsetFetchResponse()
+		topicIdx = make(map[string]int)
+	)
+	for i, resp := range resps {
+		if errs[i] != nil {
+			return nil, errs[i]
+		}
+		merged.Version = resp.Version
+		merged.ThrottleMillis = max(merged.ThrottleMillis, resp.ThrottleMillis)
+		for _, rTopic := range resp.Topics {
+			if j, ok := topicIdx[rTopic.Topic]; ok {
+				merged.Topics[j].Partitions = append(merged.Topics[j].Partitions, rTopic.Partitions...)
+				continue
+			}
+			topicIdx[rTopic.Topic] = len(merged.Topics)
+			merged.Topics = append(merged.Topics, rTopic)
+		}
+	}
+	return merged, nil
+}
+
+// fetchOffsetChunk issues one chunk of an offset fetch. KIP-447: an unstable
+// offset commit means there is a pending transaction that should be committing
+// soon. If any partition in this chunk is unstable, we sleep for 1s and retry
+// only this chunk.
+func (g *groupConsumer) fetchOffsetChunk(ctx context.Context, req *kmsg.OffsetFetchRequest) (*kmsg.OffsetFetchResponse, error) {
+	for {
+		resp, err := req.RequestWith(ctx, g.cl)
+		if err != nil {
+			return nil, err
+		}
+		unstable := offsetFetchTopicsFailing(resp, kerr.UnstableOffsetCommit.Code)
+		if len(unstable) == 0 {
+			return resp, nil
+		}
+		g.cfg.logger.Log(LogLevelInfo, "fetch offsets failed with UnstableOffsetCommit, waiting 1s and retrying",
+			"group", g.cfg.group,
+			"topics", unstable,
+		)
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(time.Second):
+		}
+	}
+}
+
 // fetchOffsets is issued once we join a group to see what the prior commits
 // were for the partitions we were assigned.
 func (g *groupConsumer) fetchOffsets(ctx context.Context, added map[string][]int32) (rerr error) { // we must use "rerr"! see introducing commit
@@ -1548,19 +2630,18 @@ func (g *groupConsumer) fetchOffsets(ctx context.Context, added map[string][]int
 		}
 	}()
 
+	added, regranted := g.takeRegranted(added, g.memberGen.generation())
+	if len(regranted) > 0 {
+		g.cfg.logger.Log(LogLevelInfo, "resuming partitions that were revoked and immediately regranted from our last commit, skipping fetching their offsets",
+			"group", g.cfg.group,
+			"regranted", regranted,
+		)
+	}
+
 	// Our client maps the v0 to v7 format to v8+ when sharding this
 	// request, if we are only requesting one group, as well as maps the
 	// response back, so we do not need to worry about v8+ here.
-start:
-	req := kmsg.NewPtrOffsetFetchRequest()
-	req.Group = g.cfg.group
-	req.RequireStable = g.cfg.requireStable
-	for topic, partitions := range added {
-		reqTopic := kmsg.NewOffsetFetchRequestTopic()
-		reqTopic.Topic = topic
-		reqTopic.Partitions = partitions
-		req.Topics = append(req.Topics, reqTopic)
-	}
+	reqs := chunkOffsetFetch(g.cfg.group, g.cfg.requireStable, added, g.cfg.offsetChunkPartitions)
 
 	var resp *kmsg.OffsetFetchResponse
 	var err error
@@ -1568,7 +2649,7 @@ start:
 	fetchDone := make(chan struct{})
 	go func() {
 		defer close(fetchDone)
-		resp, err = req.RequestWith(ctx, g.cl)
+		resp, err = g.fetchOffsetChunks(ctx, reqs)
 	}()
 	select {
 	case <-fetchDone:
@@ -1588,31 +2669,22 @@ start:
 
 	offsets := make(map[string]map[int32]Offset)
 	for _, rTopic := range resp.Topics {
-		topicOffsets := make(map[int32]Offset)
-		offsets[rTopic.Topic] = topicOffsets
+		topicOffsets := offsets[rTopic.Topic]
+		if topicOffsets == nil {
+			topicOffsets = make(map[int32]Offset)
+			offsets[rTopic.Topic] = topicOffsets
+		}
 		for _, rPartition := range rTopic.Partitions {
 			if err = kerr.ErrorForCode(rPartition.ErrorCode); err != nil {
-				// KIP-447: Unstable offset commit means there is a
-				// pending transaction that should be committing soon.
-				// We sleep for 1s and retry fetching offsets.
-				if errors.Is(err, kerr.UnstableOffsetCommit) {
-					g.cfg.logger.Log(LogLevelInfo, "fetch offsets failed with UnstableOffsetCommit, waiting 1s and retrying",
-						"group", g.cfg.group,
-						"topic", rTopic.Topic,
-						"partition", rPartition.Partition,
-					)
-					select {
-					case <-ctx.Done():
-					case <-time.After(time.Second):
-						goto start
-					}
-				}
 				g.cfg.logger.Log(LogLevelError, "fetch offsets failed",
 					"group", g.cfg.group,
 					"topic", rTopic.Topic,
 					"partition", rPartition.Partition,
 					"err", err,
 				)
+				if g.cfg.stopOnGroupAuth && errors.Is(err, kerr.TopicAuthorizationFailed) {
+					return &ErrGroupFatal{Err: err, Topics: offsetFetchTopicsFailing(resp, rPartition.ErrorCode)}
+				}
 				return err
 			}
 			offset := Offset{
@@ -1623,11 +2695,30 @@ start:
 				offset.epoch = rPartition.LeaderEpoch
 			}
 			if rPartition.Offset == -1 {
-				offset = g.cfg.resetOffset
+				offset = g.resetOffsetFor(rTopic.Topic, rPartition.Partition)
+			} else if rPartition.Metadata != nil {
+				offset.metadata = *rPartition.Metadata
 			}
 			topicOffsets[rPartition.Partition] = offset
 		}
 	}
+	for topic, partitions := range regranted {
+		topicOffsets := offsets[topic]
+		if topicOffsets == nil {
+			topicOffsets = make(map[int32]Offset)
+			offsets[topic] = topicOffsets
+		}
+		for partition, committed := range partitions {
+			offset := Offset{
+				at:    committed.Offset,
+				epoch: -1,
+			}
+			if kip320 {
+				offset.epoch = committed.Epoch
+			}
+			topicOffsets[partition] = offset
+		}
+	}
 
 	groupTopics := g.tps.load()
 	for fetchedTopic := range offsets {
@@ -1693,6 +2784,33 @@ start:
 	return nil
 }
 
+// resetOffsetFor returns where to start consuming a partition that has no
+// committed offset: the ResetOffsetFunc result if it is set and returns a
+// non-zero offset, otherwise ConsumeResetOffset.
+func (g *groupConsumer) resetOffsetFor(topic string, partition int32) Offset {
+	if g.cfg.resetOffsetFn != nil {
+		if offset := g.cfg.resetOffsetFn(topic, partition); offset != (Offset{}) {
+			return offset
+		}
+	}
+	return g.cfg.resetOffset
+}
+
+// offsetFetchTopicsFailing returns all topics in the response that have any
+// partition failing with the given error code.
+func offsetFetchTopicsFailing(resp *kmsg.OffsetFetchResponse, code int16) []string {
+	var topics []string
+	for _, rTopic := range resp.Topics {
+		for _, rPartition := range rTopic.Partitions {
+			if rPartition.ErrorCode == code {
+				topics = append(topics, rTopic.Topic)
+				break
+			}
+		}
+	}
+	return topics
+}
+
 // findNewAssignments updates topics the group wants to use and other metadata.
 // We only grab the group mu at the end if we need to.
 //
@@ -1703,8 +2821,11 @@ start:
 // Additionally, if the member is the leader, this rejoins the group if the
 // leader notices new partitions in an existing topic.
 //
-// This does not rejoin if the leader notices a partition is lost, which is
-// finicky.
+// Partitions that are lost (a topic was deleted, or deleted and recreated
+// with fewer partitions) are only acted on once the loss is seen in two
+// metadata updates in a row, so that a single stale broker response does not
+// cause a rebalance. A lost topic is no longer used, which changes our
+// interests and rejoins; lost partitions rejoin only if we are the leader.
 func (g *groupConsumer) findNewAssignments() {
 	topics := g.tps.load()
 
@@ -1713,16 +2834,27 @@ func (g *groupConsumer) findNewAssignments() {
 		delta int
 	}
 
-	var numNewTopics int
+	var numNewTopics, numLostTopics int
 	toChange := make(map[string]change, len(topics))
+	shrinking := make(map[string]int)
 	for topic, topicPartitions := range topics {
 		parts := topicPartitions.load()
-		numPartitions := len(parts.partitions)
+		numPartitions := parts.livePartitions()
 		// If we are already using this topic, add that it changed if
-		// there are more partitions than we were using prior.
+		// there are more partitions than we were using prior, or if
+		// we have now seen fewer partitions twice.
 		if used, exists := g.using[topic]; exists {
 			if added := numPartitions - used; added > 0 {
 				toChange[topic] = change{delta: added}
+			} else if added < 0 {
+				if seen, ok := g.shrinkSeen[topic]; ok && seen == numPartitions {
+					toChange[topic] = change{delta: added}
+					if numPartitions == 0 {
+						numLostTopics++
+					}
+				} else {
+					shrinking[topic] = numPartitions
+				}
 			}
 			continue
 		}
@@ -1751,9 +2883,14 @@ func (g *groupConsumer) findNewAssignments() {
 		}
 	}
 
+	g.shrinkSeen = shrinking
+
 	externalRejoin := g.leader.Load() && g.getAndResetExternalRejoin()
 
-	if len(toChange) == 0 && !externalRejoin {
+	subscriptionChanged := g.subscriptionChanged
+	g.subscriptionChanged = false
+
+	if len(toChange) == 0 && !externalRejoin && !subscriptionChanged {
 		return
 	}
 
@@ -1766,6 +2903,12 @@ func (g *groupConsumer) findNewAssignments() {
 
 	for topic, change := range toChange {
 		g.using[topic] += change.delta
+		if g.using[topic] == 0 {
+			g.cfg.logger.Log(LogLevelInfo, "topic is no longer in metadata, no longer using it", "group", g.cfg.group, "topic", topic)
+			delete(g.using, topic)
+		} else if change.delta < 0 {
+			g.cfg.logger.Log(LogLevelInfo, "topic has lost partitions", "group", g.cfg.group, "topic", topic, "partitions", g.using[topic])
+		}
 	}
 
 	if !g.managing {
@@ -1776,9 +2919,13 @@ func (g *groupConsumer) findNewAssignments() {
 
 	if numNewTopics > 0 {
 		g.rejoin("rejoining because there are more topics to consume, our interests have changed")
+	} else if numLostTopics > 0 {
+		g.rejoin("rejoining because topics we were consuming no longer exist, our interests have changed")
+	} else if subscriptionChanged {
+		g.rejoin("rejoining because SetConsumeTopics changed our subscription")
 	} else if g.leader.Load() {
 		if len(toChange) > 0 {
-			g.rejoin("rejoining because we are the leader and noticed some topics have new partitions")
+			g.rejoin("rejoining because we are the leader and noticed some topics have new or lost partitions")
 		} else if externalRejoin {
 			g.rejoin("leader detected that partitions on topics another member is consuming have changed, rejoining to trigger rebalance")
 		}
@@ -1792,6 +2939,9 @@ type uncommit struct {
 	dirty     EpochOffset // if autocommitting, what will move to head on next Poll
 	head      EpochOffset // ready to commit
 	committed EpochOffset // what is committed
+
+	committedAt   time.Time     // when committed was last successfully committed by us, zero if never
+	commitLatency time.Duration // how long the request that last committed took
 }
 
 // EpochOffset combines a record offset with the leader epoch the broker
@@ -1810,6 +2960,17 @@ type EpochOffset struct {
 	Offset int64
 }
 
+// EpochOffsetMetadata is an EpochOffset with the metadata string committed
+// alongside it; see CommitOffsetsWithMetadata.
+type EpochOffsetMetadata struct {
+	EpochOffset
+
+	// Metadata is the commit metadata. When committing, an empty string
+	// defaults to what every other commit uses: the CommitMetadata
+	// function if set, otherwise the member ID.
+	Metadata string
+}
+
 // Less returns whether the this EpochOffset is less than another. This is less
 // than the other if this one's epoch is less, or the epoch's are equal and
 // this one's offset is less.
@@ -1817,6 +2978,11 @@ func (e EpochOffset) Less(o EpochOffset) bool {
 	return e.Epoch < o.Epoch || e.Epoch == o.Epoch && e.Offset < o.Offset
 }
 
+// At returns an EpochOffset with the same epoch at the given offset.
+func (e EpochOffset) At(offset int64) EpochOffset {
+	return EpochOffset{Epoch: e.Epoch, Offset: offset}
+}
+
 type uncommitted map[string]map[int32]uncommit
 
 // updateUncommitted sets the latest uncommitted offset.
@@ -1839,10 +3005,22 @@ func (g *groupConsumer) updateUncommitted(fetches Fetches) {
 			}
 			var topicOffsets map[int32]uncommit
 			for _, partition := range topic.Partitions {
-				if len(partition.Records) == 0 {
+				// Our new head points just past the final consumed offset,
+				// that is, if we rejoin, this is the offset to begin at.
+				var set EpochOffset
+				switch {
+				case len(partition.Records) > 0:
+					final := partition.Records[len(partition.Records)-1]
+					set = EpochOffset{
+						final.LeaderEpoch, // -1 if old message / unknown
+						final.Offset + 1,
+					}
+				case len(partition.RawBatches) > 0:
+					final := &partition.RawBatches[len(partition.RawBatches)-1]
+					set = EpochOffset{final.LeaderEpoch, final.NextOffset()}
+				default:
 					continue
 				}
-				final := partition.Records[len(partition.Records)-1]
 
 				if topicOffsets == nil {
 					if g.uncommitted == nil {
@@ -1855,12 +3033,6 @@ func (g *groupConsumer) updateUncommitted(fetches Fetches) {
 					}
 				}
 
-				// Our new head points just past the final consumed offset,
-				// that is, if we rejoin, this is the offset to begin at.
-				set := EpochOffset{
-					final.LeaderEpoch, // -1 if old message / unknown
-					final.Offset + 1,
-				}
 				prior := topicOffsets[partition.Partition]
 
 				if debug {
@@ -1936,12 +3108,24 @@ func (g *groupConsumer) undirtyUncommitted() {
 func (g *groupConsumer) updateCommitted(
 	req *kmsg.OffsetCommitRequest,
 	resp *kmsg.OffsetCommitResponse,
+	latency time.Duration,
 ) {
 	g.mu.Lock()
 	defer g.mu.Unlock()
 
-	if req.Generation != g.memberGen.generation() {
-		return
+	// A commit issued in a prior generation can complete after a
+	// cooperative rebalance bumped our generation. The commit still
+	// succeeded, so we track it for partitions we still own. Eager
+	// consumers revoke everything when rebalancing, so there is nothing
+	// to track. Our assignment can be empty after the rebalance, in which
+	// case nothing from the stale commit is tracked.
+	stale := req.Generation != g.memberGen.generation()
+	var owned map[string][]int32
+	if stale {
+		if !g.cooperative.Load() {
+			return
+		}
+		owned = g.nowAssigned.read()
 	}
 	if g.uncommitted == nil {
 		g.cfg.logger.Log(LogLevelWarn, "received an OffsetCommitResponse after our group session has ended, unable to handle this (were we kicked from the group?)")
@@ -1961,11 +3145,15 @@ func (g *groupConsumer) updateCommitted(
 
 	var b bytes.Buffer
 	debug := g.cfg.logger.Level() >= LogLevelDebug
+	now := time.Now()
 
 	for i := range resp.Topics {
 		reqTopic := &req.Topics[i]
 		respTopic := &resp.Topics[i]
 		topic := g.uncommitted[respTopic.Topic]
+		if stale && topic == nil {
+			continue // lost this topic since the commit was issued
+		}
 		if topic == nil || // just in case
 			reqTopic.Topic != respTopic.Topic || // bad kafka
 			len(reqTopic.Partitions) != len(respTopic.Partitions) { // same
@@ -2015,7 +3203,12 @@ func (g *groupConsumer) updateCommitted(
 				reqPart.LeaderEpoch,
 				reqPart.Offset,
 			}
+			if stale && (!slices.Contains(owned[reqTopic.Topic], reqPart.Partition) || set.Less(uncommit.committed)) {
+				continue // no longer ours, or a newer commit already completed
+			}
 			uncommit.committed = set
+			uncommit.committedAt = now
+			uncommit.commitLatency = latency
 
 			// head is set in four places:
 			//  (1) if manually committing or greedily autocommitting,
@@ -2073,67 +3266,118 @@ func (g *groupConsumer) updateCommitted(
 	}
 }
 
-func (g *groupConsumer) defaultCommitCallback(_ *Client, _ *kmsg.OffsetCommitRequest, resp *kmsg.OffsetCommitResponse, err error) {
-	if err != nil {
-		if !errors.Is(err, context.Canceled) {
-			g.cfg.logger.Log(LogLevelError, "default commit failed", "group", g.cfg.group, "err", err)
+func (g *groupConsumer) defaultCommitCallback(_ *Client, req *kmsg.OffsetCommitRequest, resp *kmsg.OffsetCommitResponse, err error) {
+	var ce *ErrCommit
+	if !errors.As(CommitError(req, resp, err), &ce) {
+		return
+	}
+	if len(ce.Partitions) == 0 {
+		if !errors.Is(ce.Err, context.Canceled) {
+			g.cfg.logger.Log(LogLevelError, "default commit failed", "group", g.cfg.group, "err", ce.Err)
 		} else {
 			g.cfg.logger.Log(LogLevelDebug, "default commit canceled", "group", g.cfg.group)
 		}
 		return
 	}
-	for _, topic := range resp.Topics {
-		for _, partition := range topic.Partitions {
-			if err := kerr.ErrorForCode(partition.ErrorCode); err != nil {
-				g.cfg.logger.Log(LogLevelError, "in default commit: unable to commit offsets for topic partition",
-					"group", g.cfg.group,
-					"topic", topic.Topic,
-					"partition", partition.Partition,
-					"error", err)
-			}
+	if ce.Err != nil {
+		g.cfg.logger.Log(LogLevelError, "in default commit: unable to commit offsets due to a group error",
+			"group", g.cfg.group,
+			"error", ce.Err,
+			"partitions", ce.Partitions,
+		)
+		return
+	}
+	for topic, partitions := range ce.Partitions {
+		for partition, err := range partitions {
+			g.cfg.logger.Log(LogLevelError, "in default commit: unable to commit offsets for topic partition",
+				"group", g.cfg.group,
+				"topic", topic,
+				"partition", partition,
+				"error", err)
 		}
 	}
 }
 
 func (g *groupConsumer) loopCommit() {
-	ticker := time.NewTicker(g.cfg.autocommitInterval)
+	ticker := newJitterTicker(g.cfg.autocommitInterval, g.cfg.heartbeatJitter, 0)
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ticker.C:
+			ticker.next()
 		case <-g.ctx.Done():
 			return
 		}
+		g.autocommit("autocommitting")
+	}
+}
 
-		// We use the group context for the default autocommit; revokes
-		// use the client context so that we can be sure we commit even
-		// after the group context is canceled (which is the first
-		// thing that happens so as to quit the manage loop before
-		// leaving a group).
-		//
-		// We always commit only the head. If we are autocommitting
-		// dirty, then updateUncommitted updates the head to dirty
-		// offsets.
-		g.noCommitDuringJoinAndSync.RLock()
-		g.mu.Lock()
-		if !g.blockAuto {
-			uncommitted := g.getUncommittedLocked(true, false)
-			if len(uncommitted) == 0 {
-				g.cfg.logger.Log(LogLevelDebug, "skipping autocommit due to no offsets to commit", "group", g.cfg.group)
-				g.noCommitDuringJoinAndSync.RUnlock()
-			} else {
-				g.cfg.logger.Log(LogLevelDebug, "autocommitting", "group", g.cfg.group)
-				g.commit(g.ctx, uncommitted, func(cl *Client, req *kmsg.OffsetCommitRequest, resp *kmsg.OffsetCommitResponse, err error) {
-					g.noCommitDuringJoinAndSync.RUnlock()
-					g.cfg.commitCallback(cl, req, resp, err)
-				})
-			}
-		} else {
-			g.noCommitDuringJoinAndSync.RUnlock()
-		}
-		g.mu.Unlock()
+// jitterTicker is like a time.Ticker, but every interval is randomly adjusted
+// by up to +/- frac of the base interval. If limit is positive, jitter never
+// pushes an interval above limit (or above the base interval, if that is
+// already larger than limit). After every receive from C, next must be called
+// to schedule the next tick.
+type jitterTicker struct {
+	*time.Timer
+	d     time.Duration
+	frac  float64
+	limit time.Duration
+}
+
+func newJitterTicker(d time.Duration, frac float64, limit time.Duration) *jitterTicker {
+	t := &jitterTicker{d: d, frac: frac, limit: limit}
+	t.Timer = time.NewTimer(t.interval())
+	return t
+}
+
+func (t *jitterTicker) interval() time.Duration {
+	if t.frac == 0 {
+		return t.d
+	}
+	j := t.d + time.Duration((2*rand.Float64()-1)*t.frac*float64(t.d))
+	if limit := max(t.limit, t.d); t.limit > 0 && j > limit {
+		j = limit
+	}
+	return j
+}
+
+func (t *jitterTicker) next() { t.Reset(t.interval()) }
+
+// autocommit commits the current head offsets if autocommitting is not
+// blocked by a manual commit or paused by the user.
+func (g *groupConsumer) autocommit(why string) {
+	// We use the group context for the default autocommit; revokes use
+	// the client context so that we can be sure we commit even after the
+	// group context is canceled (which is the first thing that happens so
+	// as to quit the manage loop before leaving a group).
+	//
+	// We always commit only the head. If we are autocommitting dirty,
+	// then updateUncommitted updates the head to dirty offsets.
+	g.noCommitDuringJoinAndSync.RLock()
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.blockAuto || g.revokeCommitting {
+		g.noCommitDuringJoinAndSync.RUnlock()
+		return
+	}
+	if g.autoPaused > 0 {
+		g.noCommitDuringJoinAndSync.RUnlock()
+		g.warnLongAutoPauseLocked()
+		g.cfg.logger.Log(LogLevelDebug, "skipping autocommit due to autocommitting being paused", "group", g.cfg.group)
+		return
 	}
+	uncommitted := g.getUncommittedLocked(true, false)
+	if len(uncommitted) == 0 {
+		g.cfg.logger.Log(LogLevelDebug, "skipping autocommit due to no offsets to commit", "group", g.cfg.group)
+		g.noCommitDuringJoinAndSync.RUnlock()
+		return
+	}
+	g.cfg.logger.Log(LogLevelDebug, why, "group", g.cfg.group)
+	g.commit(g.ctx, uncommitted, func(cl *Client, req *kmsg.OffsetCommitRequest, resp *kmsg.OffsetCommitResponse, err error) {
+		g.noCommitDuringJoinAndSync.RUnlock()
+		g.cfg.commitCallback(cl, req, resp, err)
+	})
 }
 
 // For SetOffsets, the gist of what follows:
@@ -2143,7 +3387,14 @@ func (g *groupConsumer) loopCommit() {
 // commit, then we do not need to actually invalidate our current assignments.
 // This is a great optimization for transactions that are resetting their state
 // on abort.
-func (g *groupConsumer) getSetAssigns(setOffsets map[string]map[int32]EpochOffset) (assigns map[string]map[int32]Offset) {
+//
+// Partitions that are not currently assigned are not set and are returned in
+// skipped.
+func (g *groupConsumer) getSetAssigns(setOffsets map[string]map[int32]EpochOffset) (assigns map[string]map[int32]Offset, skipped map[string][]int32) {
+	// nowAssigned is read before locking g.mu: revoking writes nowAssigned
+	// and then locks g.mu.
+	nowAssigned := g.nowAssigned.read()
+
 	g.mu.Lock()
 	defer g.mu.Unlock()
 
@@ -2152,17 +3403,34 @@ func (g *groupConsumer) getSetAssigns(setOffsets map[string]map[int32]EpochOffse
 	if g.uncommitted == nil {
 		g.uncommitted = make(uncommitted)
 	}
+	skip := func(topic string, partition int32) {
+		if skipped == nil {
+			skipped = make(map[string][]int32)
+		}
+		skipped[topic] = append(skipped[topic], partition)
+	}
 	for topic, partitions := range setOffsets {
 		if !groupTopics.hasTopic(topic) {
-			continue // trying to set a topic that was not assigned...
-		}
-		topicUncommitted := g.uncommitted[topic]
-		if topicUncommitted == nil {
-			topicUncommitted = make(map[int32]uncommit)
-			g.uncommitted[topic] = topicUncommitted
+			// Trying to set a topic that was not assigned...
+			for partition := range partitions {
+				skip(topic, partition)
+			}
+			continue
 		}
+		var topicUncommitted map[int32]uncommit
 		var topicAssigns map[int32]Offset
 		for partition, epochOffset := range partitions {
+			if !slices.Contains(nowAssigned[topic], partition) {
+				skip(topic, partition) // ...or a partition that is not assigned
+				continue
+			}
+			if topicUncommitted == nil {
+				topicUncommitted = g.uncommitted[topic]
+				if topicUncommitted == nil {
+					topicUncommitted = make(map[int32]uncommit)
+					g.uncommitted[topic] = topicUncommitted
+				}
+			}
 			current, exists := topicUncommitted[partition]
 			topicUncommitted[partition] = uncommit{
 				dirty:     epochOffset,
@@ -2187,7 +3455,7 @@ func (g *groupConsumer) getSetAssigns(setOffsets map[string]map[int32]EpochOffse
 		}
 	}
 
-	return assigns
+	return assigns, skipped
 }
 
 // UncommittedOffsets returns the latest uncommitted offsets. Uncommitted
@@ -2213,11 +3481,150 @@ func (cl *Client) MarkedOffsets() map[string]map[int32]EpochOffset {
 	return g.getUncommitted(false)
 }
 
-// CommittedOffsets returns the latest committed offsets. Committed offsets are
-// updated from commits or from joining a group and fetching offsets.
+// CommittedOffsets returns the latest committed offsets. Committed offsets are
+// updated from commits or from joining a group and fetching offsets.
+//
+// If there are no committed offsets, this returns nil.
+func (cl *Client) CommittedOffsets() map[string]map[int32]EpochOffset {
+	g := cl.consumer.g
+	if g == nil {
+		return nil
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.getUncommittedLocked(false, false)
+}
+
+// FetchCommittedOffsets asks the group coordinator for the group's committed
+// offsets, as opposed to CommittedOffsets, which returns what this client
+// knows it has committed or fetched.
+//
+// If no topics are specified, this fetches offsets for all partitions
+// currently assigned to this member. Otherwise, this fetches the committed
+// offsets for all partitions of the given topics. Partitions with no commit
+// are not included in the result. Leader epochs are returned if the broker
+// supports them (OffsetFetch v5+); otherwise epochs are -1.
+//
+// This returns an error if the client is not consuming as part of a group, if
+// the request fails, or an *ErrPartition if any partition fails with an error.
+func (cl *Client) FetchCommittedOffsets(ctx context.Context, topics ...string) (map[string]map[int32]EpochOffset, error) {
+	fetchedMeta, err := cl.FetchCommittedOffsetsWithMetadata(ctx, topics...)
+	if err != nil || fetchedMeta == nil {
+		return nil, err
+	}
+	fetched := make(map[string]map[int32]EpochOffset, len(fetchedMeta))
+	for topic, partitions := range fetchedMeta {
+		fetchedTopic := make(map[int32]EpochOffset, len(partitions))
+		fetched[topic] = fetchedTopic
+		for partition, eom := range partitions {
+			fetchedTopic[partition] = eom.EpochOffset
+		}
+	}
+	return fetched, nil
+}
+
+// FetchCommittedOffsetsWithMetadata is FetchCommittedOffsets, but also returns
+// the metadata committed with each offset.
+func (cl *Client) FetchCommittedOffsetsWithMetadata(ctx context.Context, topics ...string) (map[string]map[int32]EpochOffsetMetadata, error) {
+	g := cl.consumer.g
+	if g == nil {
+		return nil, errNotGroup
+	}
+
+	req := kmsg.NewPtrOffsetFetchRequest()
+	req.Group = g.cfg.group
+	req.RequireStable = g.cfg.requireStable
+
+	var want map[string]bool
+	if len(topics) == 0 {
+		assigned := g.nowAssigned.read()
+		if len(assigned) == 0 {
+			return nil, nil
+		}
+		for topic, partitions := range assigned {
+			reqTopic := kmsg.NewOffsetFetchRequestTopic()
+			reqTopic.Topic = topic
+			reqTopic.Partitions = partitions
+			req.Topics = append(req.Topics, reqTopic)
+		}
+	} else {
+		// Requesting all topics (nil) is the only way to get every
+		// partition of a topic without knowing the partitions.
+		want = make(map[string]bool, len(topics))
+		for _, topic := range topics {
+			want[topic] = true
+		}
+	}
+
+	resp, err := req.RequestWith(ctx, cl)
+	if err != nil {
+		return nil, err
+	}
+	// Prior to v2, group errors were returned in every partition, which
+	// we handle below. v2+ has a top level error code, and our sharding
+	// maps v8+ per-group errors back into it.
+	if err := kerr.ErrorForCode(resp.ErrorCode); err != nil {
+		return nil, err
+	}
+
+	kip320 := cl.supportsOffsetForLeaderEpoch()
+	fetched := make(map[string]map[int32]EpochOffsetMetadata)
+	for _, rTopic := range resp.Topics {
+		if want != nil && !want[rTopic.Topic] {
+			continue
+		}
+		for _, rPartition := range rTopic.Partitions {
+			if err := kerr.ErrorForCode(rPartition.ErrorCode); err != nil {
+				return nil, &ErrPartition{rTopic.Topic, rPartition.Partition, err}
+			}
+			if rPartition.Offset < 0 {
+				continue
+			}
+			eo := EpochOffset{
+				Epoch:  -1,
+				Offset: rPartition.Offset,
+			}
+			if resp.Version >= 5 && kip320 {
+				eo.Epoch = rPartition.LeaderEpoch
+			}
+			eom := EpochOffsetMetadata{EpochOffset: eo}
+			if rPartition.Metadata != nil {
+				eom.Metadata = *rPartition.Metadata
+			}
+			fetchedTopic := fetched[rTopic.Topic]
+			if fetchedTopic == nil {
+				fetchedTopic = make(map[int32]EpochOffsetMetadata)
+				fetched[rTopic.Topic] = fetchedTopic
+			}
+			fetchedTopic[rPartition.Partition] = eom
+		}
+	}
+	return fetched, nil
+}
+
+// CommitStatus is the commit status of a partition, as returned from
+// CommitStatuses.
+type CommitStatus struct {
+	// Committed is the latest committed offset, either from a commit or
+	// from fetching offsets when joining the group.
+	Committed EpochOffset
+	// LastCommit is when this client last successfully committed the
+	// partition. This is the zero time if the partition has not been
+	// committed since it was assigned.
+	LastCommit time.Time
+	// LastCommitLatency is how long the OffsetCommit request that last
+	// committed the partition took.
+	LastCommitLatency time.Duration
+}
+
+// CommitStatuses returns the commit status of every partition that this
+// client is tracking offsets for in the group. This can be used to alert on
+// how long it has been since a partition was committed, rather than on offset
+// deltas.
 //
-// If there are no committed offsets, this returns nil.
-func (cl *Client) CommittedOffsets() map[string]map[int32]EpochOffset {
+// If not consuming as part of a group, this returns nil.
+func (cl *Client) CommitStatuses() map[string]map[int32]CommitStatus {
 	g := cl.consumer.g
 	if g == nil {
 		return nil
@@ -2225,7 +3632,22 @@ func (cl *Client) CommittedOffsets() map[string]map[int32]EpochOffset {
 	g.mu.Lock()
 	defer g.mu.Unlock()
 
-	return g.getUncommittedLocked(false, false)
+	if g.uncommitted == nil {
+		return nil
+	}
+	statuses := make(map[string]map[int32]CommitStatus, len(g.uncommitted))
+	for topic, partitions := range g.uncommitted {
+		topicStatuses := make(map[int32]CommitStatus, len(partitions))
+		statuses[topic] = topicStatuses
+		for partition, uncommit := range partitions {
+			topicStatuses[partition] = CommitStatus{
+				Committed:         uncommit.committed,
+				LastCommit:        uncommit.committedAt,
+				LastCommitLatency: uncommit.commitLatency,
+			}
+		}
+	}
+	return statuses
 }
 
 func (g *groupConsumer) getUncommitted(dirty bool) map[string]map[int32]EpochOffset {
@@ -2325,6 +3747,12 @@ func PreTxnCommitFnContext(ctx context.Context, fn func(*kmsg.TxnOffsetCommitReq
 // recommended to call this for every record processed in a high throughput
 // scenario, because you do not want to unnecessarily increase load on Kafka.
 //
+// Each record is committed at its offset+1 with its leader epoch. If multiple
+// records are for the same partition, the record with the latest leader epoch,
+// and then the largest offset, is committed. Records for topics that the group
+// is not consuming are not filtered: they are committed as given, and Kafka
+// accepts commits for any topic in a group.
+//
 // If you do not want to wait for this function to complete before continuing
 // processing records, you can call this function in a goroutine.
 func (cl *Client) CommitRecords(ctx context.Context, rs ...*Record) error {
@@ -2349,28 +3777,47 @@ func (cl *Client) CommitRecords(ctx context.Context, rs ...*Record) error {
 		}
 	}
 
-	var rerr error // return error
+	return unwrapPartitionErr(cl.CommitSync(ctx, offsets))
+}
+
+// CommitSync synchronously commits the given offsets, returning the request
+// error or the first partition error. A partition error is returned as an
+// *ErrPartition with the topic and partition that failed; use errors.Is or
+// errors.As to inspect the underlying kerr error. This is a simpler form of CommitOffsetsSync for the
+// common case of committing and checking whether the commit succeeded, for
+// example before shutting down.
+//
+// Canceling the context cancels the commit and returns the context error. As
+// with CommitOffsetsSync, this blocks autocommitting while the commit is in
+// flight and cancels any prior in flight commit. See the documentation on
+// CommitOffsetsSync for more details.
+func (cl *Client) CommitSync(ctx context.Context, uncommitted map[string]map[int32]EpochOffset) error {
+	var rerr error
+	cl.CommitOffsetsSync(ctx, uncommitted, firstCommitErr(&rerr))
+	return rerr
+}
 
+// firstCommitErr returns an onDone function that saves the request error or
+// the first partition error into rerr.
+func firstCommitErr(rerr *error) func(*Client, *kmsg.OffsetCommitRequest, *kmsg.OffsetCommitResponse, error) {
 	// Our client retries an OffsetCommitRequest as necessary if the first
 	// response partition has a retryable group error (group coordinator
 	// loading, etc), so any partition error is fatal.
-	cl.CommitOffsetsSync(ctx, offsets, func(_ *Client, _ *kmsg.OffsetCommitRequest, resp *kmsg.OffsetCommitResponse, err error) {
+	return func(_ *Client, _ *kmsg.OffsetCommitRequest, resp *kmsg.OffsetCommitResponse, err error) {
 		if err != nil {
-			rerr = err
+			*rerr = err
 			return
 		}
 
 		for _, topic := range resp.Topics {
 			for _, partition := range topic.Partitions {
 				if err := kerr.ErrorForCode(partition.ErrorCode); err != nil {
-					rerr = err
+					*rerr = &ErrPartition{topic.Topic, partition.Partition, err}
 					return
 				}
 			}
 		}
-	})
-
-	return rerr
+	}
 }
 
 // MarkCommitRecords marks records to be available for autocommitting. This
@@ -2412,11 +3859,8 @@ func (cl *Client) MarkCommitRecords(rs ...*Record) {
 			r.LeaderEpoch,
 			r.Offset + 1,
 		}); current.head.Less(newHead) {
-			curPartitions[r.Partition] = uncommit{
-				dirty:     current.dirty,
-				committed: current.committed,
-				head:      newHead,
-			}
+			current.head = newHead
+			curPartitions[r.Partition] = current
 		}
 	}
 }
@@ -2449,11 +3893,8 @@ func (cl *Client) MarkCommitOffsets(unmarked map[string]map[int32]EpochOffset) {
 		for partition, newHead := range partitions {
 			current := curPartitions[partition]
 			if current.head.Less(newHead) {
-				curPartitions[partition] = uncommit{
-					dirty:     current.dirty,
-					committed: current.committed,
-					head:      newHead,
-				}
+				current.head = newHead
+				curPartitions[partition] = current
 			}
 		}
 	}
@@ -2470,8 +3911,40 @@ func (cl *Client) MarkCommitOffsets(unmarked map[string]map[int32]EpochOffset) {
 //
 // As an alternative if you want to commit specific records, see CommitRecords.
 func (cl *Client) CommitUncommittedOffsets(ctx context.Context) error {
-	// This function is just the tail end of CommitRecords just above.
-	return cl.commitOffsets(ctx, cl.UncommittedOffsets())
+	var rerr error
+	cl.CommitUncommitted(ctx, firstCommitErr(&rerr))
+	return unwrapPartitionErr(rerr)
+}
+
+// CommitUncommitted synchronously commits everything that has been polled so
+// far, i.e. what UncommittedOffsets returns, calling onDone with the commit
+// request and either the response or an error if the response was not issued.
+// It is OK if onDone is nil.
+//
+// Unlike calling UncommittedOffsets and passing the result to
+// CommitOffsetsSync, the uncommitted offsets are snapshotted under the same
+// lock that blocks autocommitting, so there is no window in which a
+// concurrent poll or autocommit can change what is being committed.
+//
+// If nothing is uncommitted, this is a no-op and onDone is called with an
+// empty request and response. See CommitOffsetsSync for more details about
+// synchronous commits.
+func (cl *Client) CommitUncommitted(
+	ctx context.Context,
+	onDone func(*Client, *kmsg.OffsetCommitRequest, *kmsg.OffsetCommitResponse, error),
+) {
+	if onDone == nil {
+		onDone = func(*Client, *kmsg.OffsetCommitRequest, *kmsg.OffsetCommitResponse, error) {}
+	}
+
+	g := cl.consumer.g
+	if g == nil {
+		onDone(cl, kmsg.NewPtrOffsetCommitRequest(), kmsg.NewPtrOffsetCommitResponse(), errNotGroup)
+		return
+	}
+	g.commitSync(ctx, func() map[string]map[int32]EpochOffset {
+		return g.getUncommittedLocked(true, true)
+	}, onDone)
 }
 
 // CommitMarkedOffsets issues a synchronous offset commit for any partition
@@ -2489,32 +3962,11 @@ func (cl *Client) CommitUncommittedOffsets(ctx context.Context) error {
 //
 // As an alternative if you want to commit specific records, see CommitRecords.
 func (cl *Client) CommitMarkedOffsets(ctx context.Context) error {
-	// This function is just the tail end of CommitRecords just above.
 	marked := cl.MarkedOffsets()
 	if len(marked) == 0 {
 		return nil
 	}
-	return cl.commitOffsets(ctx, marked)
-}
-
-func (cl *Client) commitOffsets(ctx context.Context, offsets map[string]map[int32]EpochOffset) error {
-	var rerr error
-	cl.CommitOffsetsSync(ctx, offsets, func(_ *Client, _ *kmsg.OffsetCommitRequest, resp *kmsg.OffsetCommitResponse, err error) {
-		if err != nil {
-			rerr = err
-			return
-		}
-
-		for _, topic := range resp.Topics {
-			for _, partition := range topic.Partitions {
-				if err := kerr.ErrorForCode(partition.ErrorCode); err != nil {
-					rerr = err
-					return
-				}
-			}
-		}
-	})
-	return rerr
+	return unwrapPartitionErr(cl.CommitSync(ctx, marked))
 }
 
 // CommitOffsetsSync cancels any active CommitOffsets, begins a commit that
@@ -2596,7 +4048,17 @@ func (g *groupConsumer) commitOffsetsSync(
 	uncommitted map[string]map[int32]EpochOffset,
 	onDone func(*Client, *kmsg.OffsetCommitRequest, *kmsg.OffsetCommitResponse, error),
 ) {
-	g.cfg.logger.Log(LogLevelDebug, "in CommitOffsetsSync", "group", g.cfg.group, "with", uncommitted)
+	g.commitSync(ctx, func() map[string]map[int32]EpochOffset { return uncommitted }, onDone)
+}
+
+// commitSync is commitOffsetsSync, but the offsets to commit are loaded with
+// g.mu held just before blocking autocommitting.
+func (g *groupConsumer) commitSync(
+	ctx context.Context,
+	loadOffsets func() map[string]map[int32]EpochOffset,
+	onDone func(*Client, *kmsg.OffsetCommitRequest, *kmsg.OffsetCommitResponse, error),
+) {
+	g.cfg.logger.Log(LogLevelDebug, "in CommitOffsetsSync", "group", g.cfg.group)
 	defer g.cfg.logger.Log(LogLevelDebug, "left CommitOffsetsSync", "group", g.cfg.group)
 
 	done := make(chan struct{})
@@ -2623,6 +4085,9 @@ func (g *groupConsumer) commitOffsetsSync(
 	g.mu.Lock()
 	defer g.mu.Unlock()
 
+	uncommitted := loadOffsets()
+	g.cfg.logger.Log(LogLevelDebug, "committing offsets synchronously", "group", g.cfg.group, "with", uncommitted)
+
 	g.blockAuto = true
 	unblockAuto := func(cl *Client, req *kmsg.OffsetCommitRequest, resp *kmsg.OffsetCommitResponse, err error) {
 		unblockCommits(cl, req, resp, err)
@@ -2657,7 +4122,9 @@ func (g *groupConsumer) commitOffsetsSync(
 // periodically commit async and then issue a final sync commit before quitting
 // (this is the behavior of autocommiting and using the default revoke). This
 // differs from the Java async commit, which does not retry requests to avoid
-// trampling on future commits.
+// trampling on future commits. A prior commit that is canceled this way has
+// its onDone called with ErrCommitSuperseded, and HookGroupCommitSuperseded is
+// called.
 //
 // It is highly recommended to check the response's partition's error codes if
 // the response is non-nil. While unlikely, individual partitions can error.
@@ -2715,18 +4182,301 @@ func (cl *Client) CommitOffsets(
 	g.commit(ctx, uncommitted, unblockAuto)
 }
 
+// CommitOffsetsWithMetadata is CommitOffsets, but commits each offset with its
+// own metadata string rather than the member ID. This can be used to record
+// which instance committed what, or to store small checkpoints that can be
+// read back with FetchCommittedOffsetsWithMetadata. Partitions with empty
+// metadata are committed with the member ID.
+//
+// This is implemented with PreCommitFnContext: if ctx already has a pre-commit
+// function, it is called first and the metadata is applied after.
+func (cl *Client) CommitOffsetsWithMetadata(
+	ctx context.Context,
+	uncommitted map[string]map[int32]EpochOffsetMetadata,
+	onDone func(*Client, *kmsg.OffsetCommitRequest, *kmsg.OffsetCommitResponse, error),
+) {
+	offsets := make(map[string]map[int32]EpochOffset, len(uncommitted))
+	for topic, partitions := range uncommitted {
+		topicOffsets := make(map[int32]EpochOffset, len(partitions))
+		offsets[topic] = topicOffsets
+		for partition, eom := range partitions {
+			topicOffsets[partition] = eom.EpochOffset
+		}
+	}
+
+	prior, _ := ctx.Value(commitContextFn).(func(*kmsg.OffsetCommitRequest) error)
+	ctx = PreCommitFnContext(ctx, func(req *kmsg.OffsetCommitRequest) error {
+		if prior != nil {
+			if err := prior(req); err != nil {
+				return err
+			}
+		}
+		for i := range req.Topics {
+			reqTopic := &req.Topics[i]
+			partitions := uncommitted[reqTopic.Topic]
+			for j := range reqTopic.Partitions {
+				reqPartition := &reqTopic.Partitions[j]
+				if eom, ok := partitions[reqPartition.Partition]; ok && eom.Metadata != "" {
+					metadata := eom.Metadata
+					reqPartition.Metadata = &metadata
+				}
+			}
+		}
+		return nil
+	})
+	cl.CommitOffsets(ctx, offsets, onDone)
+}
+
 // defaultRevoke commits the last fetched offsets and waits for the commit to
 // finish. This is the default onRevoked function which, when combined with the
 // default autocommit, ensures we never miss committing everything.
 //
 // Note that the heartbeat loop invalidates all buffered, unpolled fetches
 // before revoking, meaning this truly will commit all polled fetches.
+//
+// If autocommitting is paused, this waits for it to be resumed and skips
+// committing if it is not resumed in time.
+//
+// When leaving the group, commitOnLeave runs first and owns the final commit;
+// we skip committing if it did.
 func (g *groupConsumer) defaultRevoke(context.Context, *Client, map[string][]int32) {
+	if g.leaveCommitted.Load() {
+		return
+	}
 	if !g.cfg.autocommitDisable {
-		// We use the client's context rather than the group context,
-		// because this could come from the group being left. The group
-		// context will already be canceled.
-		g.commitOffsetsSync(g.cl.ctx, g.getUncommitted(false), g.cfg.commitCallback)
+		if !g.waitAutoResumed() {
+			return
+		}
+		g.commitRevokeSync(g.getUncommitted(false))
+	}
+}
+
+// commitOnLeave performs the final autocommit when the group is gracefully
+// left: after fetching stops, before OnPartitionsRevoked and LeaveGroup. This
+// is not called on fatal errors, where we instead call onLost.
+//
+// We first wait for the autocommit loop to quit, so that a tick cannot race
+// with (and cancel) this commit. With AutoCommitOnClose, the commit is bounded
+// by the configured timeout and happens even if the user overrode
+// OnPartitionsRevoked. Otherwise, this is the commit of the default revoke, and
+// retries are bounded by the rebalance timeout. We use the client context
+// because the group context is already canceled.
+//
+// If this takes over the final commit, it marks leaveCommitted so that the
+// default revoke does not commit again.
+func (g *groupConsumer) commitOnLeave() {
+	if g.cfg.autocommitDisable || g.cfg.autocommitOnClose <= 0 && g.cfg.setRevoked {
+		return
+	}
+	g.leaveCommitted.Store(true)
+	if g.commitLoopDone != nil {
+		<-g.commitLoopDone
+	}
+	if !g.waitAutoResumed() {
+		return
+	}
+	uncommitted := g.getUncommitted(false)
+	if len(uncommitted) == 0 {
+		return
+	}
+	if g.cfg.autocommitOnClose <= 0 {
+		g.cfg.logger.Log(LogLevelInfo, "committing polled offsets before leaving the group", "group", g.cfg.group)
+		g.commitRevokeSync(uncommitted)
+		return
+	}
+	g.cfg.logger.Log(LogLevelInfo, "committing polled offsets before leaving the group",
+		"group", g.cfg.group,
+		"timeout", g.cfg.autocommitOnClose,
+	)
+	ctx, cancel := context.WithTimeout(g.cl.ctx, g.cfg.autocommitOnClose)
+	defer cancel()
+	g.commitOffsetsSync(ctx, uncommitted, g.cfg.commitCallback)
+}
+
+// drainRevoke adapts an OnPartitionsRevokedDrain function into an onRevoked
+// function that does not return until the user calls drained or 90% of the
+// rebalance timeout passes. The heartbeat loop keeps heartbeating while we
+// wait, since revoking runs in its own goroutine.
+func (g *groupConsumer) drainRevoke(fn func(context.Context, *Client, map[string][]int32, func())) func(context.Context, *Client, map[string][]int32) {
+	return func(ctx context.Context, cl *Client, revoked map[string][]int32) {
+		timeout := g.cfg.rebalanceTimeout - g.cfg.rebalanceTimeout/10
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		defer cancel()
+
+		var once sync.Once
+		drained := make(chan struct{})
+		fn(ctx, cl, revoked, func() { once.Do(func() { close(drained) }) })
+
+		select {
+		case <-drained:
+		case <-ctx.Done():
+			g.cfg.logger.Log(LogLevelWarn, "revoke drain did not finish before its deadline, continuing the rebalance",
+				"group", g.cfg.group,
+				"timeout", timeout,
+				"revoked", mtps(revoked),
+				"err", ctx.Err(),
+			)
+		}
+	}
+}
+
+// commitRevokeSync commits synchronously in the default revoke. Brokers accept
+// commits for the current generation while the group is preparing to
+// rebalance, but a commit that races with the rebalance can still fail with
+// RebalanceInProgress, or with NotCoordinator if the coordinator moved and
+// the commit's own retries were exhausted. Since this is the last chance to
+// commit before losing partitions, we retry only the partitions that failed
+// with those errors, up to the rebalance timeout and only while our
+// generation is unchanged: once we rejoin, the offsets are no longer ours to
+// commit. Every attempt, including the per-partition retries within a commit,
+// is bounded by what remains of the rebalance timeout.
+//
+// Autocommitting is blocked for the duration, including between attempts, so
+// that an autocommit cannot cancel a retry. The commit callback is called
+// once, with the final attempt.
+func (g *groupConsumer) commitRevokeSync(uncommitted map[string]map[int32]EpochOffset) {
+	g.retryRevokeCommit(uncommitted, func(ctx context.Context, uncommitted map[string]map[int32]EpochOffset, onDone func(*Client, *kmsg.OffsetCommitRequest, *kmsg.OffsetCommitResponse, error)) {
+		g.commitOffsetsSync(ctx, uncommitted, onDone)
+	})
+}
+
+func (g *groupConsumer) retryRevokeCommit(
+	uncommitted map[string]map[int32]EpochOffset,
+	commit func(context.Context, map[string]map[int32]EpochOffset, func(*Client, *kmsg.OffsetCommitRequest, *kmsg.OffsetCommitResponse, error)),
+) {
+	g.mu.Lock()
+	g.revokeCommitting = true
+	g.mu.Unlock()
+	defer func() {
+		g.mu.Lock()
+		g.revokeCommitting = false
+		g.mu.Unlock()
+	}()
+
+	generation := g.memberGen.generation()
+	deadline := time.Now().Add(g.cfg.rebalanceTimeout)
+
+	// We use the client's context rather than the group context, because
+	// this could come from the group being left. The group context will
+	// already be canceled.
+	ctx, cancel := context.WithDeadline(g.cl.ctx, deadline)
+	defer cancel()
+
+	for tries := 1; ; tries++ {
+		var retry map[string]map[int32]EpochOffset
+		commit(ctx, uncommitted, func(cl *Client, req *kmsg.OffsetCommitRequest, resp *kmsg.OffsetCommitResponse, err error) {
+			if err == nil {
+				retry = revokeRetryCommits(uncommitted, resp)
+			}
+			if len(retry) > 0 && time.Now().Before(deadline) && g.memberGen.generation() == generation {
+				return
+			}
+			retry = nil
+			g.cfg.commitCallback(cl, req, resp, err)
+		})
+		if len(retry) == 0 {
+			return
+		}
+
+		backoff := g.cfg.retryBackoff(tries)
+		g.cfg.logger.Log(LogLevelInfo, "revoke commit failed with a rebalance or coordinator error, retrying failed partitions",
+			"group", g.cfg.group,
+			"partitions", retry,
+			"tries", tries,
+			"backoff", backoff,
+		)
+		after := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			after.Stop()
+			return
+		case <-after.C:
+		}
+		uncommitted = retry
+	}
+}
+
+// commitMetadata returns the metadata to commit for a partition: the result
+// of the CommitMetadata function if set, otherwise the member ID.
+func (g *groupConsumer) commitMetadata(memberID *string, topic string, partition int32, eo EpochOffset) *string {
+	if g.cfg.commitMetadata == nil {
+		return memberID
+	}
+	metadata := g.cfg.commitMetadata(topic, partition, eo)
+	return &metadata
+}
+
+// revokeRetryCommits returns the offsets of partitions in the commit response
+// that failed with RebalanceInProgress or NotCoordinator.
+func revokeRetryCommits(uncommitted map[string]map[int32]EpochOffset, resp *kmsg.OffsetCommitResponse) map[string]map[int32]EpochOffset {
+	var retry map[string]map[int32]EpochOffset
+	for _, t := range resp.Topics {
+		for _, p := range t.Partitions {
+			if p.ErrorCode != kerr.RebalanceInProgress.Code && p.ErrorCode != kerr.NotCoordinator.Code {
+				continue
+			}
+			eo, ok := uncommitted[t.Topic][p.Partition]
+			if !ok {
+				continue
+			}
+			if retry == nil {
+				retry = make(map[string]map[int32]EpochOffset)
+			}
+			rt := retry[t.Topic]
+			if rt == nil {
+				rt = make(map[int32]EpochOffset)
+				retry[t.Topic] = rt
+			}
+			rt[p.Partition] = eo
+		}
+	}
+	return retry
+}
+
+// waitAutoResumed waits up to the configured pause wait for autocommitting to
+// be resumed, returning whether autocommitting is unpaused.
+func (g *groupConsumer) waitAutoResumed() bool {
+	g.mu.Lock()
+	resumed := g.autoResumed
+	if g.autoPaused == 0 {
+		g.mu.Unlock()
+		return true
+	}
+	g.warnLongAutoPauseLocked()
+	g.mu.Unlock()
+
+	g.cfg.logger.Log(LogLevelInfo, "autocommitting is paused, waiting for it to be resumed before committing in revoke",
+		"group", g.cfg.group,
+		"max_wait", g.cfg.autocommitPauseWait,
+	)
+	timer := time.NewTimer(g.cfg.autocommitPauseWait)
+	defer timer.Stop()
+	select {
+	case <-resumed:
+		return true
+	case <-timer.C:
+	case <-g.cl.ctx.Done():
+	}
+	g.cfg.logger.Log(LogLevelError, "autocommitting is still paused, skipping the commit in revoke; offsets will be reconsumed",
+		"group", g.cfg.group,
+	)
+	return false
+}
+
+// warnLongAutoPauseLocked warns once per pause if autocommitting has been
+// paused for longer than the session timeout. This is called with g.mu held.
+func (g *groupConsumer) warnLongAutoPauseLocked() {
+	if g.autoPausedWarned {
+		return
+	}
+	if paused := time.Since(g.autoPausedAt); paused > g.cfg.sessionTimeout {
+		g.autoPausedWarned = true
+		g.cfg.logger.Log(LogLevelWarn, "autocommitting has been paused for longer than the session timeout; is ResumeAutoCommit missing?",
+			"group", g.cfg.group,
+			"paused_for", paused,
+			"session_timeout", g.cfg.sessionTimeout,
+			"depth", g.autoPaused,
+		)
 	}
 }
 
@@ -2787,14 +4537,31 @@ func (g *groupConsumer) commit(
 		return
 	}
 
+	// We are under g.mu, so capturing the prior commit and swapping in
+	// our own is atomic with respect to any other commit: each commit
+	// waits on exactly the one before it. Our goroutine below closes
+	// commitDone on every return path, so the chain cannot stall even if
+	// we are canceled before issuing anything.
 	priorCancel := g.commitCancel
 	priorDone := g.commitDone
+	priorSuperseded := g.commitSuperseded
 
 	commitCtx, commitCancel := context.WithCancel(ctx) // enable ours to be canceled and waited for
 	commitDone := make(chan struct{})
+	superseded := new(atomicBool)
 
 	g.commitCancel = commitCancel
 	g.commitDone = commitDone
+	g.commitSuperseded = superseded
+
+	// If we are canceled by a newer commit, we return a more
+	// descriptive error than a bare context.Canceled.
+	done := func(req *kmsg.OffsetCommitRequest, resp *kmsg.OffsetCommitResponse, err error) {
+		if err != nil && superseded.Load() && errors.Is(err, context.Canceled) && ctx.Err() == nil {
+			err = ErrCommitSuperseded
+		}
+		onDone(g.cl, req, resp, err)
+	}
 
 	req := kmsg.NewPtrOffsetCommitRequest()
 	req.Group = g.cfg.group
@@ -2821,8 +4588,15 @@ func (g *groupConsumer) commit(
 			case <-priorDone:
 			default:
 				g.cfg.logger.Log(LogLevelDebug, "canceling prior commit to issue another", "group", g.cfg.group)
+				priorSuperseded.Store(true)
 				priorCancel()
 				<-priorDone
+				n := g.superseded.Add(1)
+				g.cfg.hooks.each(func(h Hook) {
+					if h, ok := h.(HookGroupCommitSuperseded); ok {
+						h.OnGroupCommitSuperseded(g.cfg.group, n)
+					}
+				})
 			}
 		}
 		g.cfg.logger.Log(LogLevelDebug, "issuing commit", "group", g.cfg.group, "uncommitted", uncommitted)
@@ -2835,7 +4609,7 @@ func (g *groupConsumer) commit(
 				reqPartition.Partition = partition
 				reqPartition.Offset = eo.Offset
 				reqPartition.LeaderEpoch = eo.Epoch // KIP-320
-				reqPartition.Metadata = &req.MemberID
+				reqPartition.Metadata = g.commitMetadata(&req.MemberID, topic, partition, eo)
 				reqTopic.Partitions = append(reqTopic.Partitions, reqPartition)
 			}
 			req.Topics = append(req.Topics, reqTopic)
@@ -2843,21 +4617,265 @@ func (g *groupConsumer) commit(
 
 		if fn, ok := ctx.Value(commitContextFn).(func(*kmsg.OffsetCommitRequest) error); ok {
 			if err := fn(req); err != nil {
-				onDone(g.cl, req, nil, err)
+				done(req, nil, err)
 				return
 			}
 		}
 
-		resp, err := req.RequestWith(commitCtx, g.cl)
-		if err != nil {
-			onDone(g.cl, req, nil, err)
+		// Large commits are split into bounded chunks, a few of which
+		// are issued concurrently, and the chunk responses are merged
+		// by topic. Each successful chunk is recorded as committed
+		// immediately, so if any chunk fails, a retried commit only
+		// needs to include what has not yet been committed. If only
+		// some chunks fail, the merged response has the partitions of
+		// the failed chunks failing, rather than failing everything.
+		chunks := chunkOffsetCommit(req, g.cfg.offsetChunkPartitions)
+		if len(chunks) == 1 {
+			resp, err := g.commitChunk(commitCtx, req)
+			done(req, resp, err)
+			return
+		}
+		resps := make([]*kmsg.OffsetCommitResponse, len(chunks))
+		errs := make([]error, len(chunks))
+		issueChunks(len(chunks), func(i int) {
+			resps[i], errs[i] = g.commitChunk(commitCtx, chunks[i])
+		})
+		var failed int
+		for i, err := range errs {
+			if err == nil {
+				continue
+			}
+			failed++
+			g.cfg.logger.Log(LogLevelWarn, "commit chunk failed, failing its partitions",
+				"group", g.cfg.group,
+				"topics", len(chunks[i].Topics),
+				"err", err,
+			)
+			resps[i] = failedCommitChunk(chunks[i], err)
+		}
+		if failed == len(chunks) {
+			done(req, nil, errs[0])
 			return
 		}
-		g.updateCommitted(req, resp)
-		onDone(g.cl, req, resp, nil)
+		done(req, mergeCommitChunks(resps), nil)
 	}()
 }
 
+// commitPartitionRetryTimeout bounds how long commitChunk retries partitions
+// that failed with coordinator or rebalance errors. Commits are serialized, so
+// a long retry here holds up every later autocommit and revoke commit.
+const commitPartitionRetryTimeout = 5 * time.Second
+
+// commitChunk issues one commit request. Request level retriable errors,
+// including the coordinator moving, are retried when issuing the request.
+// Partitions that fail because the coordinator moved or is loading, or
+// because the group is rebalancing, are retried here with backoff until the
+// commit context is done, we run out of retries, or commitPartitionRetryTimeout
+// (or an earlier context deadline) passes. Other partition errors, such as a
+// deleted topic, are not retried. The returned response has the final result
+// for every partition in req.
+func (g *groupConsumer) commitChunk(ctx context.Context, req *kmsg.OffsetCommitRequest) (*kmsg.OffsetCommitResponse, error) {
+	start := time.Now()
+	deadline := start.Add(commitPartitionRetryTimeout)
+	if ctxDeadline, ok := ctx.Deadline(); ok && ctxDeadline.Before(deadline) {
+		deadline = ctxDeadline
+	}
+	resp, err := req.RequestWith(ctx, g.cl)
+	if err != nil {
+		return nil, err
+	}
+	g.updateCommitted(req, resp, time.Since(start))
+
+	for tries := 1; ; tries++ {
+		retry := retriableCommits(req, resp)
+		backoff := g.cfg.retryBackoff(tries)
+		if retry == nil ||
+			int64(tries) > g.cfg.retries ||
+			time.Now().Add(backoff).After(deadline) {
+			return resp, nil
+		}
+		g.cfg.logger.Log(LogLevelInfo, "commit failed for some partitions with coordinator or rebalance errors, retrying them",
+			"group", g.cfg.group,
+			"tries", tries,
+			"backoff", backoff,
+		)
+		after := time.NewTimer(backoff)
+		select {
+		case <-ctx.Done():
+			after.Stop()
+			return resp, nil
+		case <-after.C:
+		}
+
+		start = time.Now()
+		retryResp, err := retry.RequestWith(ctx, g.cl)
+		if err != nil {
+			return resp, nil // we keep the prior partition errors
+		}
+		g.updateCommitted(retry, retryResp, time.Since(start))
+		mergeCommitResponse(resp, retryResp)
+	}
+}
+
+// retriableCommits returns a request containing only the partitions in req
+// that failed in resp with a coordinator or rebalance error, or nil if there
+// are none.
+func retriableCommits(req *kmsg.OffsetCommitRequest, resp *kmsg.OffsetCommitResponse) *kmsg.OffsetCommitRequest {
+	var failed map[string]map[int32]bool
+	for _, t := range resp.Topics {
+		for _, p := range t.Partitions {
+			switch p.ErrorCode {
+			case kerr.NotCoordinator.Code,
+				kerr.CoordinatorNotAvailable.Code,
+				kerr.CoordinatorLoadInProgress.Code,
+				kerr.RebalanceInProgress.Code:
+			default:
+				continue
+			}
+			if failed == nil {
+				failed = make(map[string]map[int32]bool)
+			}
+			ft := failed[t.Topic]
+			if ft == nil {
+				ft = make(map[int32]bool)
+				failed[t.Topic] = ft
+			}
+			ft[p.Partition] = true
+		}
+	}
+	if failed == nil {
+		return nil
+	}
+
+	retry := *req
+	retry.Topics = nil
+	for _, t := range req.Topics {
+		ft := failed[t.Topic]
+		if ft == nil {
+			continue
+		}
+		rt := t
+		rt.Partitions = nil
+		for _, p := range t.Partitions {
+			if ft[p.Partition] {
+				rt.Partitions = append(rt.Partitions, p)
+			}
+		}
+		retry.Topics = append(retry.Topics, rt)
+	}
+	return &retry
+}
+
+// mergeCommitResponse updates the partition error codes in resp with those in
+// retry.
+func mergeCommitResponse(resp, retry *kmsg.OffsetCommitResponse) {
+	codes := make(map[string]map[int32]int16)
+	for _, t := range retry.Topics {
+		ct := make(map[int32]int16, len(t.Partitions))
+		codes[t.Topic] = ct
+		for _, p := range t.Partitions {
+			ct[p.Partition] = p.ErrorCode
+		}
+	}
+	for i := range resp.Topics {
+		t := &resp.Topics[i]
+		ct := codes[t.Topic]
+		for j := range t.Partitions {
+			p := &t.Partitions[j]
+			if code, ok := ct[p.Partition]; ok {
+				p.ErrorCode = code
+			}
+		}
+	}
+}
+
+// mergeCommitChunks merges the responses for every chunk of a commit into one
+// response. A topic can be split across chunks, so partitions are merged into
+// one entry per topic, in chunk order.
+func mergeCommitChunks(resps []*kmsg.OffsetCommitResponse) *kmsg.OffsetCommitResponse {
+	var (
+		merged   = kmsg.NewPtrOffsetCommitResponse()
+		topicIdx = make(map[string]int)
+	)
+	for _, resp := range resps {
+		merged.Version = resp.Version
+		merged.ThrottleMillis = max(merged.ThrottleMillis, resp.ThrottleMillis)
+		for _, rTopic := range resp.Topics {
+			if i, ok := topicIdx[rTopic.Topic]; ok {
+				merged.Topics[i].Partitions = append(merged.Topics[i].Partitions, rTopic.Partitions...)
+				continue
+			}
+			topicIdx[rTopic.Topic] = len(merged.Topics)
+			merged.Topics = append(merged.Topics, rTopic)
+		}
+	}
+	return merged
+}
+
+// failedCommitChunk returns a response for a chunk whose request failed, with
+// every partition in the chunk failing. Kafka errors keep their code; any
+// other error, such as the connection dying, is reported as NETWORK_EXCEPTION.
+func failedCommitChunk(chunk *kmsg.OffsetCommitRequest, err error) *kmsg.OffsetCommitResponse {
+	code := kerr.NetworkException.Code
+	var ke *kerr.Error
+	if errors.As(err, &ke) {
+		code = ke.Code
+	}
+	resp := chunk.ResponseKind().(*kmsg.OffsetCommitResponse)
+	for _, t := range chunk.Topics {
+		rt := kmsg.NewOffsetCommitResponseTopic()
+		rt.Topic = t.Topic
+		for _, p := range t.Partitions {
+			rp := kmsg.NewOffsetCommitResponseTopicPartition()
+			rp.Partition = p.Partition
+			rp.ErrorCode = code
+			rt.Partitions = append(rt.Partitions, rp)
+		}
+		resp.Topics = append(resp.Topics, rt)
+	}
+	return resp
+}
+
+// chunkOffsetCommit splits req into requests of at most per partitions. If req
+// is small enough, it is returned as is.
+func chunkOffsetCommit(req *kmsg.OffsetCommitRequest, per int) []*kmsg.OffsetCommitRequest {
+	var total int
+	for _, t := range req.Topics {
+		total += len(t.Partitions)
+	}
+	if total <= per {
+		return []*kmsg.OffsetCommitRequest{req}
+	}
+
+	var (
+		reqs  []*kmsg.OffsetCommitRequest
+		chunk *kmsg.OffsetCommitRequest
+		n     int
+	)
+	for _, t := range req.Topics {
+		partitions := t.Partitions
+		for len(partitions) > 0 {
+			if chunk == nil || n == per {
+				dup := *req
+				dup.Topics = nil
+				chunk = &dup
+				reqs = append(reqs, chunk)
+				n = 0
+			}
+			take := per - n
+			if take > len(partitions) {
+				take = len(partitions)
+			}
+			chunkTopic := t
+			chunkTopic.Partitions = partitions[:take:take]
+			chunk.Topics = append(chunk.Topics, chunkTopic)
+			partitions = partitions[take:]
+			n += take
+		}
+	}
+	return reqs
+}
+
 type reNews struct {
 	added   map[string][]string
 	skipped []string
@@ -0,0 +1,2324 @@
+package kgo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"net"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kmsg"
+)
+
+func TestTakeRegranted(t *testing.T) {
+	g := &groupConsumer{
+		revokedCommitted: map[string]map[int32]revokedCommit{
+			"t": {
+				0: {EpochOffset{1, 10}, 4},
+				1: {EpochOffset{1, 20}, 3}, // revoked two generations ago: someone else may have owned it
+			},
+		},
+	}
+
+	// Generation 5 is the generation right after we revoked in 4: t0 is
+	// resumed from our commit, t1 and u0 are fetched.
+	fetch, regranted := g.takeRegranted(map[string][]int32{
+		"t": {0, 1},
+		"u": {0},
+	}, 5)
+
+	if exp := map[string][]int32{"t": {1}, "u": {0}}; !reflect.DeepEqual(fetch, exp) {
+		t.Errorf("fetch: got %v != exp %v", fetch, exp)
+	}
+	if exp := map[string]map[int32]EpochOffset{"t": {0: {1, 10}}}; !reflect.DeepEqual(regranted, exp) {
+		t.Errorf("regranted: got %v != exp %v", regranted, exp)
+	}
+
+	// The tracking is single use: a back to back rebalance that grants
+	// the same partition again must fetch.
+	fetch, regranted = g.takeRegranted(map[string][]int32{"t": {0}}, 6)
+	if exp := map[string][]int32{"t": {0}}; !reflect.DeepEqual(fetch, exp) || regranted != nil {
+		t.Errorf("second take: got fetch %v regranted %v, exp fetch %v and no regranted", fetch, regranted, exp)
+	}
+}
+
+func TestChunkOffsetRequests(t *testing.T) {
+	const offsetChunkPartitions = 5000
+	fetch := map[string][]int32{"big": make([]int32, offsetChunkPartitions+1), "small": {0, 1}}
+	for i := range fetch["big"] {
+		fetch["big"][i] = int32(i)
+	}
+
+	var fetched int
+	reqs := chunkOffsetFetch("g", true, fetch, offsetChunkPartitions)
+	if len(reqs) != 2 {
+		t.Fatalf("fetch: got %d chunks != exp 2", len(reqs))
+	}
+	for _, req := range reqs {
+		var n int
+		for _, topic := range req.Topics {
+			n += len(topic.Partitions)
+		}
+		if n > offsetChunkPartitions {
+			t.Errorf("fetch: chunk has %d partitions > max %d", n, offsetChunkPartitions)
+		}
+		if req.Group != "g" || !req.RequireStable {
+			t.Errorf("fetch: chunk lost group or require stable")
+		}
+		fetched += n
+	}
+	if exp := offsetChunkPartitions + 3; fetched != exp {
+		t.Errorf("fetch: got %d total partitions != exp %d", fetched, exp)
+	}
+
+	commit := kmsg.NewPtrOffsetCommitRequest()
+	commit.Group = "g"
+	commit.Generation = 3
+	for topic, partitions := range fetch {
+		reqTopic := kmsg.NewOffsetCommitRequestTopic()
+		reqTopic.Topic = topic
+		for _, p := range partitions {
+			reqPartition := kmsg.NewOffsetCommitRequestTopicPartition()
+			reqPartition.Partition = p
+			reqTopic.Partitions = append(reqTopic.Partitions, reqPartition)
+		}
+		commit.Topics = append(commit.Topics, reqTopic)
+	}
+	chunks := chunkOffsetCommit(commit, offsetChunkPartitions)
+	if len(chunks) != 2 {
+		t.Fatalf("commit: got %d chunks != exp 2", len(chunks))
+	}
+	var committed int
+	for _, chunk := range chunks {
+		if chunk.Group != "g" || chunk.Generation != 3 {
+			t.Errorf("commit: chunk lost group or generation")
+		}
+		for _, topic := range chunk.Topics {
+			committed += len(topic.Partitions)
+		}
+	}
+	if exp := offsetChunkPartitions + 3; committed != exp {
+		t.Errorf("commit: got %d total partitions != exp %d", committed, exp)
+	}
+
+	small := kmsg.NewPtrOffsetCommitRequest()
+	if chunks := chunkOffsetCommit(small, offsetChunkPartitions); len(chunks) != 1 || chunks[0] != small {
+		t.Errorf("commit: small request was unexpectedly chunked")
+	}
+
+	// Chunks are packed across topics up to the chunk size.
+	if chunks := chunkOffsetCommit(commit, 2); len(chunks) != (offsetChunkPartitions+3+1)/2 {
+		t.Errorf("commit: got %d chunks with size 2 != exp %d", len(chunks), (offsetChunkPartitions+3+1)/2)
+	}
+	if reqs := chunkOffsetFetch("g", false, map[string][]int32{"a": {0, 1, 2}, "b": {0, 1}}, 2); len(reqs) != 3 {
+		t.Errorf("fetch: got %d chunks with size 2 != exp 3", len(reqs))
+	}
+}
+
+func TestWaitGroupStableUnjoined(t *testing.T) {
+	cl, err := NewClient(SeedBrokers("127.0.0.1:1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cl.WaitGroupStable(context.Background()); !errors.Is(err, errNotGroup) {
+		t.Errorf("no group: got %v != exp %v", err, errNotGroup)
+	}
+	cl.Close()
+
+	cl, err = NewClient(SeedBrokers("127.0.0.1:1"), ConsumerGroup("g"), ConsumeTopics("t"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := cl.WaitPartitionAssigned(ctx, "t", 0); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("unjoined: got %v != exp %v", err, context.DeadlineExceeded)
+	}
+}
+
+func TestFindNewAssignmentsLostPartitions(t *testing.T) {
+	cfg := defaultCfg()
+	g := &groupConsumer{
+		cfg:      &cfg,
+		tps:      newTopicsPartitions(),
+		rejoinCh: make(chan string, 1),
+		using:    map[string]int{"t": 3, "u": 1},
+		managing: true,
+	}
+	g.tps.storeTopics([]string{"t", "u"})
+	update := func(tParts, uParts int, uErr error) {
+		tps := g.tps.load()
+		store := func(topic string, n int, err error) {
+			d := &topicPartitionsData{topic: topic, loadErr: err}
+			for i := 0; i < n; i++ {
+				d.partitions = append(d.partitions, &topicPartition{})
+			}
+			// Partitions beyond what metadata returns are kept as missing.
+			for i := n; i < g.using[topic]; i++ {
+				d.partitions = append(d.partitions, &topicPartition{loadErr: errMissingMetadataPartition})
+			}
+			tps[topic].v.Store(d)
+		}
+		store("t", tParts, nil)
+		store("u", uParts, uErr)
+	}
+	rejoined := func() bool {
+		select {
+		case <-g.rejoinCh:
+			return true
+		default:
+			return false
+		}
+	}
+
+	// The first update that sees the loss does nothing.
+	update(2, 0, kerr.UnknownTopicOrPartition)
+	g.findNewAssignments()
+	if rejoined() || g.using["t"] != 3 || g.using["u"] != 1 {
+		t.Fatalf("acted on the first lost update: using %v", g.using)
+	}
+
+	// The second does: t shrinks, u is no longer used, and we rejoin.
+	g.findNewAssignments()
+	if !rejoined() {
+		t.Error("did not rejoin after losing a topic")
+	}
+	if exp := map[string]int{"t": 2}; !reflect.DeepEqual(g.using, exp) {
+		t.Errorf("using: got %v != exp %v", g.using, exp)
+	}
+
+	// Stable metadata does nothing further.
+	g.findNewAssignments()
+	if rejoined() || g.using["t"] != 2 {
+		t.Errorf("acted on stable metadata: using %v", g.using)
+	}
+}
+
+func TestRevokeRetryCommits(t *testing.T) {
+	uncommitted := map[string]map[int32]EpochOffset{
+		"t": {0: {1, 10}, 1: {1, 20}, 2: {1, 30}},
+		"u": {0: {2, 5}},
+	}
+	resp := kmsg.NewPtrOffsetCommitResponse()
+	for _, tp := range []struct {
+		topic     string
+		partition int32
+		code      int16
+	}{
+		{"t", 0, 0},
+		{"t", 1, kerr.RebalanceInProgress.Code},
+		{"t", 2, kerr.NotCoordinator.Code},
+		{"u", 0, kerr.IllegalGeneration.Code},
+	} {
+		rt := kmsg.NewOffsetCommitResponseTopic()
+		rt.Topic = tp.topic
+		rp := kmsg.NewOffsetCommitResponseTopicPartition()
+		rp.Partition = tp.partition
+		rp.ErrorCode = tp.code
+		rt.Partitions = append(rt.Partitions, rp)
+		resp.Topics = append(resp.Topics, rt)
+	}
+	got := revokeRetryCommits(uncommitted, resp)
+	if exp := map[string]map[int32]EpochOffset{"t": {1: {1, 20}, 2: {1, 30}}}; !reflect.DeepEqual(got, exp) {
+		t.Errorf("got %v != exp %v", got, exp)
+	}
+}
+
+func TestCommitError(t *testing.T) {
+	if err := CommitError(nil, kmsg.NewPtrOffsetCommitResponse(), nil); err != nil {
+		t.Errorf("empty response: got %v != exp nil", err)
+	}
+
+	resp := kmsg.NewPtrOffsetCommitResponse()
+	rt := kmsg.NewOffsetCommitResponseTopic()
+	rt.Topic = "t"
+	for p, code := range []int16{0, kerr.OffsetMetadataTooLarge.Code, kerr.IllegalGeneration.Code} {
+		rp := kmsg.NewOffsetCommitResponseTopicPartition()
+		rp.Partition = int32(p)
+		rp.ErrorCode = code
+		rt.Partitions = append(rt.Partitions, rp)
+	}
+	resp.Topics = append(resp.Topics, rt)
+
+	var ce *ErrCommit
+	if err := CommitError(nil, resp, nil); !errors.As(err, &ce) {
+		t.Fatalf("got %v, not an *ErrCommit", err)
+	}
+	if !errors.Is(ce.Err, kerr.IllegalGeneration) {
+		t.Errorf("group err: got %v != exp %v", ce.Err, kerr.IllegalGeneration)
+	}
+	exp := map[string]map[int32]error{"t": {1: kerr.OffsetMetadataTooLarge, 2: kerr.IllegalGeneration}}
+	if !reflect.DeepEqual(ce.Partitions, exp) {
+		t.Errorf("partitions: got %v != exp %v", ce.Partitions, exp)
+	}
+
+	// Without a group error, every partition error unwraps.
+	resp.Topics[0].Partitions = resp.Topics[0].Partitions[:2]
+	if err := CommitError(nil, resp, nil); !errors.Is(err, kerr.OffsetMetadataTooLarge) {
+		t.Errorf("got %v, does not unwrap to %v", err, kerr.OffsetMetadataTooLarge)
+	}
+}
+
+func TestRetriableCommits(t *testing.T) {
+	req := kmsg.NewPtrOffsetCommitRequest()
+	req.Group = "g"
+	resp := kmsg.NewPtrOffsetCommitResponse()
+	rt := kmsg.NewOffsetCommitRequestTopic()
+	rt.Topic = "t"
+	respT := kmsg.NewOffsetCommitResponseTopic()
+	respT.Topic = "t"
+	for p, code := range []int16{0, kerr.NotCoordinator.Code, kerr.UnknownTopicOrPartition.Code} {
+		reqP := kmsg.NewOffsetCommitRequestTopicPartition()
+		reqP.Partition = int32(p)
+		reqP.Offset = int64(p * 10)
+		rt.Partitions = append(rt.Partitions, reqP)
+		respP := kmsg.NewOffsetCommitResponseTopicPartition()
+		respP.Partition = int32(p)
+		respP.ErrorCode = code
+		respT.Partitions = append(respT.Partitions, respP)
+	}
+	req.Topics = append(req.Topics, rt)
+	resp.Topics = append(resp.Topics, respT)
+
+	retry := retriableCommits(req, resp)
+	if retry == nil || retry.Group != "g" || len(retry.Topics) != 1 || len(retry.Topics[0].Partitions) != 1 {
+		t.Fatalf("unexpected retry request %+v", retry)
+	}
+	if p := retry.Topics[0].Partitions[0]; p.Partition != 1 || p.Offset != 10 {
+		t.Errorf("retrying the wrong partition: %+v", p)
+	}
+
+	retryResp := kmsg.NewPtrOffsetCommitResponse()
+	retryT := kmsg.NewOffsetCommitResponseTopic()
+	retryT.Topic = "t"
+	retryP := kmsg.NewOffsetCommitResponseTopicPartition()
+	retryP.Partition = 1
+	retryT.Partitions = append(retryT.Partitions, retryP)
+	retryResp.Topics = append(retryResp.Topics, retryT)
+	mergeCommitResponse(resp, retryResp)
+	if retry := retriableCommits(req, resp); retry != nil {
+		t.Errorf("still retrying after a successful retry: %+v", retry)
+	}
+	if code := resp.Topics[0].Partitions[2].ErrorCode; code != kerr.UnknownTopicOrPartition.Code {
+		t.Errorf("merge clobbered an unretried partition, code %d", code)
+	}
+}
+
+func TestUnpauseUnassigned(t *testing.T) {
+	for _, resume := range []bool{false, true} {
+		opts := []Opt{SeedBrokers("127.0.0.1:1"), ConsumerGroup("g"), ConsumeTopics("t")}
+		exp := map[string][]int32{"t": {0, 1}, "other": {0}}
+		if resume {
+			opts = append(opts, ResumeUnassignedPartitions())
+			exp = map[string][]int32{"t": {0}, "other": {0}}
+		}
+		cl, err := NewClient(opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		g := cl.consumer.g
+
+		g.nowAssigned.store(map[string][]int32{"t": {0}})
+		cl.PauseFetchPartitions(map[string][]int32{"t": {0, 1}, "other": {0}})
+		g.unpauseUnassigned()
+
+		got := cl.PauseFetchPartitions(nil)
+		for _, ps := range got {
+			slices.Sort(ps)
+		}
+		if !reflect.DeepEqual(got, exp) {
+			t.Errorf("resume %v: got %v != exp %v", resume, got, exp)
+		}
+		cl.Close()
+	}
+}
+
+func TestGroupStatusHeartbeats(t *testing.T) {
+	cl, err := NewClient(SeedBrokers("127.0.0.1:1"), ConsumerGroup("g"), ConsumeTopics("t"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+	g := cl.consumer.g
+
+	if s := cl.GroupStatus(); s.Group != "g" || s.Coordinator != nil || len(s.Heartbeats) != 0 {
+		t.Fatalf("unexpected initial status %+v", s)
+	}
+
+	start := time.Now()
+	for i := 0; i < heartbeatHistory+3; i++ {
+		var err error
+		if i == heartbeatHistory+2 {
+			err = kerr.RebalanceInProgress
+		}
+		g.recordHeartbeat(start.Add(time.Duration(i)), err)
+	}
+	hbs := cl.GroupStatus().Heartbeats
+	if len(hbs) != heartbeatHistory {
+		t.Fatalf("got %d heartbeats != exp %d", len(hbs), heartbeatHistory)
+	}
+	if !hbs[0].At.Equal(start.Add(3)) {
+		t.Errorf("oldest heartbeat: got %v != exp %v", hbs[0].At, start.Add(3))
+	}
+	if last := hbs[len(hbs)-1]; last.Err != kerr.RebalanceInProgress {
+		t.Errorf("newest heartbeat: got err %v != exp %v", last.Err, kerr.RebalanceInProgress)
+	}
+
+	for _, test := range []struct {
+		since time.Duration
+		exp   bool
+	}{
+		{heartbeatHistory + 1, true},  // success, then the rebalance failure
+		{heartbeatHistory + 2, false}, // only the rebalance failure
+		{heartbeatHistory + 3, false}, // nothing
+	} {
+		if got := g.heartbeatedSince(start.Add(test.since)); got != test.exp {
+			t.Errorf("heartbeatedSince(+%d): got %v != exp %v", test.since, got, test.exp)
+		}
+	}
+}
+
+func TestCommitFromRevokedWithCommitInFlight(t *testing.T) {
+	offsets := map[string]map[int32]EpochOffset{"t": {0: {-1, 10}}}
+
+	// A broker that accepts connections and never replies keeps every
+	// commit in flight until its context expires.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	accepted := make(chan struct{})
+	go func() {
+		defer close(accepted)
+		var conns []net.Conn
+		defer func() {
+			for _, conn := range conns {
+				conn.Close()
+			}
+		}()
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conns = append(conns, conn)
+		}
+	}()
+	closeBroker := func() { ln.Close(); <-accepted }
+
+	revokedCommitErr := make(chan error, 1)
+	cl, err := NewClient(
+		SeedBrokers(ln.Addr().String()),
+		ConsumerGroup("g"),
+		ConsumeTopics("t"),
+		DisableAutoCommit(),
+		OnPartitionsRevoked(func(ctx context.Context, cl *Client, _ map[string][]int32) {
+			ctx, cancel := context.WithTimeout(ctx, 300*time.Millisecond)
+			defer cancel()
+			cl.CommitOffsetsSync(ctx, offsets, func(_ *Client, _ *kmsg.OffsetCommitRequest, _ *kmsg.OffsetCommitResponse, err error) {
+				revokedCommitErr <- err
+			})
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+	defer closeBroker() // before closing the client, so leaving the group does not hang
+	g := cl.consumer.g
+	g.nowAssigned.store(map[string][]int32{"t": {0}})
+
+	// This commit stays in flight until its context expires, overlapping
+	// the revoke below.
+	inFlightCtx, cancel := context.WithTimeout(context.Background(), 300*time.Millisecond)
+	defer cancel()
+	inFlightDone := make(chan struct{})
+	cl.CommitOffsets(inFlightCtx, offsets, func(*Client, *kmsg.OffsetCommitRequest, *kmsg.OffsetCommitResponse, error) {
+		close(inFlightDone)
+	})
+
+	revoked := make(chan struct{})
+	go func() {
+		defer close(revoked)
+		g.revoke(revokeLastSession, nil, true)
+	}()
+
+	timeout := time.After(10 * time.Second)
+	for _, ch := range []<-chan struct{}{inFlightDone, revoked} {
+		select {
+		case <-ch:
+		case <-timeout:
+			t.Fatal("deadlocked committing from OnPartitionsRevoked while a commit was in flight")
+		}
+	}
+	if err := <-revokedCommitErr; err == nil {
+		t.Error("expected an error committing to an unresponsive broker")
+	}
+}
+
+func TestGroupManageErr(t *testing.T) {
+	var zero GroupStage
+	if zero != GroupStageUnknown || zero.String() != "unknown" {
+		t.Errorf("zero stage: got %v, exp unknown", zero)
+	}
+	if err := groupManageErr(GroupStageJoin, nil); err != nil {
+		t.Errorf("nil error: got %v, exp nil", err)
+	}
+	if err := groupManageErr(GroupStageHeartbeat, context.Canceled); err != context.Canceled {
+		t.Errorf("canceled: got %v, exp bare context.Canceled", err)
+	}
+
+	// Users are given the error exactly as it was before stages were
+	// tracked, so that == comparisons keep working.
+	err := groupManageErr(GroupStageHeartbeat, kerr.UnknownMemberID)
+	if !errors.Is(err, kerr.UnknownMemberID) {
+		t.Errorf("got %v, exp to unwrap to UNKNOWN_MEMBER_ID", err)
+	}
+	if stage, bare := splitGroupManageErr(err); stage != GroupStageHeartbeat || bare != kerr.UnknownMemberID {
+		t.Errorf("got stage %v err %v, exp heartbeat and bare UNKNOWN_MEMBER_ID", stage, bare)
+	}
+	if stage, bare := splitGroupManageErr(kerr.UnknownMemberID); stage != GroupStageUnknown || bare != kerr.UnknownMemberID {
+		t.Errorf("got stage %v err %v for an unwrapped error, exp unknown stage and the same error", stage, bare)
+	}
+
+	// Authorization and max size errors are retried unless the user
+	// opts into stopping on them.
+	for _, retried := range []error{kerr.GroupAuthorizationFailed, kerr.GroupMaxSizeReached} {
+		if fatal := isGroupFatal(groupManageErr(GroupStageJoin, retried), false); fatal != nil {
+			t.Errorf("%v is fatal without opting in: %v", retried, fatal)
+		}
+		if fatal := isGroupFatal(groupManageErr(GroupStageJoin, retried), true); fatal == nil {
+			t.Errorf("wrapped %v is not detected as fatal when opted in", retried)
+		}
+	}
+
+	// A topic authorization failure is only fatal when fetching offsets,
+	// which returns it already wrapped.
+	if fatal := isGroupFatal(groupManageErr(GroupStageHeartbeat, kerr.TopicAuthorizationFailed), true); fatal != nil {
+		t.Errorf("bare topic authorization failure is unexpectedly fatal: %v", fatal)
+	}
+	fetchFatal := &ErrGroupFatal{Err: kerr.TopicAuthorizationFailed, Topics: []string{"t"}}
+	if fatal := isGroupFatal(groupManageErr(GroupStageFetchOffsets, fetchFatal), true); fatal != fetchFatal {
+		t.Errorf("got %v, exp the offset fetch topic authorization failure to be fatal", fatal)
+	}
+
+	// A heartbeat that is fenced is always fatal rather than retried, and
+	// the fatal error still identifies the fencing.
+	_, bare := splitGroupManageErr(groupManageErr(GroupStageHeartbeat, kerr.FencedInstanceID))
+	fenced := isGroupFatal(bare, false)
+	if fenced == nil {
+		t.Fatal("fenced heartbeat is not detected as fatal")
+	}
+	if fenced.Err != kerr.FencedInstanceID {
+		t.Errorf("got %v, exp fatal error wrapping a bare FENCED_INSTANCE_ID", fenced)
+	}
+}
+
+func TestSetOffsetsOnlyAssigned(t *testing.T) {
+	cl, err := NewClient(SeedBrokers("127.0.0.1:1"), ConsumerGroup("g"), ConsumeTopics("t"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+	g := cl.consumer.g
+	g.tps.storeTopics([]string{"t", "u"})
+	g.nowAssigned.store(map[string][]int32{"t": {0}})
+
+	at := EpochOffset{Epoch: 2, Offset: 5}
+	assigns, skipped := g.getSetAssigns(map[string]map[int32]EpochOffset{
+		"t": {0: at, 1: at.At(9)},
+		"u": {0: at},
+		"v": {2: at},
+	})
+	exp := map[string]map[int32]Offset{"t": {0: {at: 5, epoch: 2}}}
+	if !reflect.DeepEqual(assigns, exp) {
+		t.Errorf("got assigns %v != exp %v", assigns, exp)
+	}
+	if expSkipped := map[string][]int32{"t": {1}, "u": {0}, "v": {2}}; !reflect.DeepEqual(skipped, expSkipped) {
+		t.Errorf("got skipped %v != exp %v", skipped, expSkipped)
+	}
+	if len(g.uncommitted) != 1 || len(g.uncommitted["t"]) != 1 || g.uncommitted["t"][0].head != at {
+		t.Errorf("got uncommitted %v, exp only t[0] at %v", g.uncommitted, at)
+	}
+}
+
+func TestRetryRevokeCommit(t *testing.T) {
+	uncommitted := map[string]map[int32]EpochOffset{"t": {0: {1, 10}, 1: {1, 20}}}
+	respond := func(offsets map[string]map[int32]EpochOffset, failed int32, code int16) *kmsg.OffsetCommitResponse {
+		resp := kmsg.NewPtrOffsetCommitResponse()
+		rt := kmsg.NewOffsetCommitResponseTopic()
+		rt.Topic = "t"
+		for p := range offsets["t"] {
+			rp := kmsg.NewOffsetCommitResponseTopicPartition()
+			rp.Partition = p
+			if p == failed {
+				rp.ErrorCode = code
+			}
+			rt.Partitions = append(rt.Partitions, rp)
+		}
+		resp.Topics = append(resp.Topics, rt)
+		return resp
+	}
+
+	for _, test := range []struct {
+		name         string
+		bumpGen      bool
+		expAttempts  int
+		expFinalCode int16
+	}{
+		{"retry succeeds", false, 2, 0},
+		{"generation changed", true, 1, kerr.RebalanceInProgress.Code},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var callbacks []*kmsg.OffsetCommitResponse
+			cl, err := NewClient(
+				SeedBrokers("127.0.0.1:1"),
+				ConsumerGroup("g"),
+				ConsumeTopics("t"),
+				RetryBackoffFn(func(int) time.Duration { return time.Millisecond }),
+				AutoCommitCallback(func(_ *Client, _ *kmsg.OffsetCommitRequest, resp *kmsg.OffsetCommitResponse, _ error) {
+					callbacks = append(callbacks, resp)
+				}),
+			)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer cl.Close()
+			g := cl.consumer.g
+			g.memberGen.store("m", 3)
+
+			var attempts []map[string]map[int32]EpochOffset
+			g.retryRevokeCommit(uncommitted, func(ctx context.Context, offsets map[string]map[int32]EpochOffset, onDone func(*Client, *kmsg.OffsetCommitRequest, *kmsg.OffsetCommitResponse, error)) {
+				if _, ok := ctx.Deadline(); !ok {
+					t.Error("revoke commit is not bounded by the rebalance timeout")
+				}
+				if !g.revokeCommitting {
+					t.Error("autocommitting is not blocked while committing in revoke")
+				}
+				attempts = append(attempts, offsets)
+				if len(attempts) > 1 {
+					onDone(cl, nil, respond(offsets, -1, 0), nil)
+					return
+				}
+				if test.bumpGen {
+					g.memberGen.store("m", 4)
+				}
+				onDone(cl, nil, respond(offsets, 1, kerr.RebalanceInProgress.Code), nil)
+			})
+
+			if len(attempts) != test.expAttempts {
+				t.Fatalf("got %d commit attempts != exp %d", len(attempts), test.expAttempts)
+			}
+			if test.expAttempts > 1 {
+				if exp := map[string]map[int32]EpochOffset{"t": {1: {1, 20}}}; !reflect.DeepEqual(attempts[1], exp) {
+					t.Errorf("retried %v != exp %v", attempts[1], exp)
+				}
+			}
+			if len(callbacks) != 1 {
+				t.Fatalf("got %d commit callbacks != exp 1", len(callbacks))
+			}
+			var finalCode int16
+			for _, rt := range callbacks[0].Topics {
+				for _, rp := range rt.Partitions {
+					if rp.ErrorCode != 0 {
+						finalCode = rp.ErrorCode
+					}
+				}
+			}
+			if finalCode != test.expFinalCode {
+				t.Errorf("final callback error code %d != exp %d", finalCode, test.expFinalCode)
+			}
+			if g.revokeCommitting {
+				t.Error("autocommitting is still blocked after committing in revoke")
+			}
+		})
+	}
+}
+
+func TestCommitMetadata(t *testing.T) {
+	memberID := "m"
+	for _, test := range []struct {
+		name string
+		opts []Opt
+		exp  string
+	}{
+		{"default member id", nil, "m"},
+		{"custom", []Opt{CommitMetadata(func(topic string, partition int32, eo EpochOffset) string {
+			return fmt.Sprintf("%s/%d@%d", topic, partition, eo.Offset)
+		})}, "t/3@10"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			cl, err := NewClient(append([]Opt{SeedBrokers("127.0.0.1:1"), ConsumerGroup("g"), ConsumeTopics("t")}, test.opts...)...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer cl.Close()
+			got := cl.consumer.g.commitMetadata(&memberID, "t", 3, EpochOffset{1, 10})
+			if got == nil || *got != test.exp {
+				t.Errorf("got metadata %v != exp %q", got, test.exp)
+			}
+		})
+	}
+}
+
+func TestUpdateCommittedPriorGeneration(t *testing.T) {
+	cl, err := NewClient(SeedBrokers("127.0.0.1:1"), ConsumerGroup("g"), ConsumeTopics("t"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+	g := cl.consumer.g
+
+	commit := func(generation int32, offsets map[int32]int64) (*kmsg.OffsetCommitRequest, *kmsg.OffsetCommitResponse, time.Duration) {
+		req := kmsg.NewPtrOffsetCommitRequest()
+		req.Generation = generation
+		resp := kmsg.NewPtrOffsetCommitResponse()
+		reqTopic := kmsg.NewOffsetCommitRequestTopic()
+		reqTopic.Topic = "t"
+		respTopic := kmsg.NewOffsetCommitResponseTopic()
+		respTopic.Topic = "t"
+		for p, o := range offsets {
+			reqPart := kmsg.NewOffsetCommitRequestTopicPartition()
+			reqPart.Partition = p
+			reqPart.Offset = o
+			reqTopic.Partitions = append(reqTopic.Partitions, reqPart)
+			respPart := kmsg.NewOffsetCommitResponseTopicPartition()
+			respPart.Partition = p
+			respTopic.Partitions = append(respTopic.Partitions, respPart)
+		}
+		req.Topics = append(req.Topics, reqTopic)
+		resp.Topics = append(resp.Topics, respTopic)
+		return req, resp, time.Millisecond
+	}
+	reset := func(cooperative bool) {
+		g.cooperative.Store(cooperative)
+		g.memberGen.store("m", 2)
+		g.nowAssigned.store(map[string][]int32{"t": {0, 2}})
+		g.uncommitted = uncommitted{"t": {
+			0: {committed: EpochOffset{-1, 5}},
+			1: {committed: EpochOffset{-1, 5}},
+			2: {committed: EpochOffset{-1, 30}},
+		}}
+	}
+	committed := func(p int32) int64 { return g.uncommitted["t"][p].committed.Offset }
+
+	// A cooperative member tracks a commit from generation 1 for
+	// partitions it still owns, unless a newer commit already landed.
+	reset(true)
+	g.updateCommitted(commit(1, map[int32]int64{0: 10, 1: 10, 2: 20}))
+	if got := committed(0); got != 10 {
+		t.Errorf("still owned partition: got committed %d != exp 10", got)
+	}
+	if got := committed(1); got != 5 {
+		t.Errorf("partition no longer owned: got committed %d != exp 5", got)
+	}
+	if got := committed(2); got != 30 {
+		t.Errorf("partition with a newer commit: got committed %d != exp 30", got)
+	}
+
+	// A cooperative member that lost everything in the rebalance
+	// tracks nothing from the stale commit.
+	reset(true)
+	g.nowAssigned.store(nil)
+	g.updateCommitted(commit(1, map[int32]int64{0: 10}))
+	if got := committed(0); got != 5 {
+		t.Errorf("nothing owned: got committed %d != exp 5", got)
+	}
+
+	// An eager member ignores commits from prior generations.
+	reset(false)
+	g.updateCommitted(commit(1, map[int32]int64{0: 10}))
+	if got := committed(0); got != 5 {
+		t.Errorf("eager: got committed %d != exp 5", got)
+	}
+}
+
+func TestCurrentAssignment(t *testing.T) {
+	direct, err := NewClient(SeedBrokers("127.0.0.1:1"), ConsumeTopics("t"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer direct.Close()
+	if got := direct.CurrentAssignment(); got != nil {
+		t.Errorf("direct consumer: got %v, exp nil", got)
+	}
+
+	cl, err := NewClient(SeedBrokers("127.0.0.1:1"), ConsumerGroup("g"), ConsumeTopics("t"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+	g := cl.consumer.g
+
+	if got := cl.CurrentAssignment(); got == nil || len(got) != 0 {
+		t.Errorf("unassigned: got %#v, exp empty non-nil", got)
+	}
+
+	g.nowAssigned.store(map[string][]int32{"t": {0, 1}})
+	got := cl.CurrentAssignment()
+	if exp := map[string][]int32{"t": {0, 1}}; !reflect.DeepEqual(got, exp) {
+		t.Errorf("got %v != exp %v", got, exp)
+	}
+	got["t"][0] = 5
+	if now := g.nowAssigned.read(); now["t"][0] != 0 {
+		t.Errorf("modifying the returned assignment modified the group's: %v", now)
+	}
+}
+
+func TestOnPartitionsRevokedDrain(t *testing.T) {
+	if _, err := NewClient(
+		ConsumerGroup("g"),
+		OnPartitionsRevoked(func(context.Context, *Client, map[string][]int32) {}),
+		OnPartitionsRevokedDrain(func(context.Context, *Client, map[string][]int32, func()) {}),
+	); err == nil {
+		t.Error("expected an error setting both revoke functions")
+	}
+
+	var drainNow bool
+	var deadline time.Time
+	cl, err := NewClient(
+		SeedBrokers("127.0.0.1:1"),
+		ConsumerGroup("g"),
+		ConsumeTopics("t"),
+		RebalanceTimeout(time.Second),
+		OnPartitionsRevokedDrain(func(ctx context.Context, _ *Client, _ map[string][]int32, drained func()) {
+			deadline, _ = ctx.Deadline()
+			if drainNow {
+				go func() {
+					time.Sleep(20 * time.Millisecond)
+					drained()
+					drained() // extra calls are ignored
+				}()
+			}
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+	g := cl.consumer.g
+
+	for _, test := range []struct {
+		drain    bool
+		min, max time.Duration
+	}{
+		{true, 20 * time.Millisecond, 500 * time.Millisecond},
+		{false, 900 * time.Millisecond, 2 * time.Second},
+	} {
+		drainNow = test.drain
+		start := time.Now()
+		g.cfg.onRevoked(context.Background(), cl, map[string][]int32{"t": {0}})
+		elapsed := time.Since(start)
+		if elapsed < test.min || elapsed > test.max {
+			t.Errorf("drain %v: revoke took %v, expected between %v and %v", test.drain, elapsed, test.min, test.max)
+		}
+		if d := deadline.Sub(start); d > 950*time.Millisecond || d < 850*time.Millisecond {
+			t.Errorf("drain %v: got deadline %v after start, expected ~900ms", test.drain, d)
+		}
+	}
+}
+
+func TestOnHeartbeat(t *testing.T) {
+	var errs []error
+	cl, err := NewClient(
+		SeedBrokers("127.0.0.1:1"),
+		ConsumerGroup("g"),
+		ConsumeTopics("t"),
+		OnHeartbeat(func(err error) { errs = append(errs, err) }),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+	g := cl.consumer.g
+
+	g.recordHeartbeat(time.Now(), nil)
+	g.recordHeartbeat(time.Now(), kerr.RebalanceInProgress)
+	if exp := []error{nil, kerr.RebalanceInProgress}; !reflect.DeepEqual(errs, exp) {
+		t.Errorf("got %v != exp %v", errs, exp)
+	}
+}
+
+func TestCommitOffsetsChainStress(t *testing.T) {
+	cl, err := NewClient(
+		SeedBrokers("127.0.0.1:1"),
+		ConsumerGroup("g"),
+		ConsumeTopics("t"),
+		DisableAutoCommit(),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+
+	const n = 300
+	var (
+		mu    sync.Mutex
+		calls = make(map[int]int, n)
+		wg    sync.WaitGroup
+	)
+	wg.Add(n)
+	for i := 0; i < n; i++ {
+		i := i
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(rand.Intn(20))*time.Millisecond)
+		if rand.Intn(4) == 0 {
+			cancel() // some are canceled before even being issued
+		}
+		go func() {
+			cl.CommitOffsets(ctx, map[string]map[int32]EpochOffset{"t": {0: {-1, int64(i)}}}, func(*Client, *kmsg.OffsetCommitRequest, *kmsg.OffsetCommitResponse, error) {
+				defer cancel()
+				mu.Lock()
+				defer mu.Unlock()
+				calls[i]++
+				if calls[i] == 1 {
+					wg.Done()
+				}
+			})
+		}()
+	}
+
+	done := make(chan struct{})
+	go func() { wg.Wait(); close(done) }()
+	select {
+	case <-done:
+	case <-time.After(20 * time.Second):
+		mu.Lock()
+		t.Fatalf("commit chain stalled: only %d of %d commits finished", len(calls), n)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	for i, c := range calls {
+		if c != 1 {
+			t.Errorf("commit %d: onDone called %d times", i, c)
+		}
+	}
+
+	// The chain must still be usable after all of that.
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	finished := make(chan struct{})
+	cl.CommitOffsets(ctx, map[string]map[int32]EpochOffset{"t": {0: {-1, 1}}}, func(*Client, *kmsg.OffsetCommitRequest, *kmsg.OffsetCommitResponse, error) {
+		close(finished)
+	})
+	select {
+	case <-finished:
+	case <-time.After(5 * time.Second):
+		t.Fatal("commit after stress never finished")
+	}
+}
+
+func TestJitterTicker(t *testing.T) {
+	for _, test := range []struct {
+		d, limit time.Duration
+		frac     float64
+		min, max time.Duration
+	}{
+		{time.Second, 0, 0, time.Second, time.Second},
+		{time.Second, 0, 0.1, 900 * time.Millisecond, 1100 * time.Millisecond},
+		{time.Second, 1050 * time.Millisecond, 0.1, 900 * time.Millisecond, 1050 * time.Millisecond},
+		{time.Second, 500 * time.Millisecond, 0.5, 500 * time.Millisecond, time.Second}, // limit below the interval: never above the interval
+	} {
+		tk := &jitterTicker{d: test.d, frac: test.frac, limit: test.limit}
+		for i := 0; i < 1000; i++ {
+			if got := tk.interval(); got < test.min || got > test.max {
+				t.Fatalf("%+v: got interval %v outside [%v, %v]", test, got, test.min, test.max)
+			}
+		}
+	}
+
+	if _, err := NewClient(ConsumerGroup("g"), HeartbeatJitter(0.6)); err == nil {
+		t.Error("expected an error for too much heartbeat jitter")
+	}
+}
+
+func TestIsTransientHeartbeatErr(t *testing.T) {
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}
+	for _, test := range []struct {
+		err       error
+		transient bool
+	}{
+		{nil, false},
+		{context.Canceled, false},
+		{ErrClientClosed, false},
+		{kerr.RebalanceInProgress, false},
+		{kerr.IllegalGeneration, false},
+		{kerr.UnknownMemberID, false},
+		{kerr.FencedInstanceID, false},
+		{groupManageErr(GroupStageHeartbeat, kerr.UnknownMemberID), false},
+
+		{kerr.NotCoordinator, true},
+		{kerr.CoordinatorNotAvailable, true},
+		{refused, true},
+		{context.DeadlineExceeded, true},
+		{groupManageErr(GroupStageHeartbeat, kerr.NotCoordinator), true},
+		{groupManageErr(GroupStageHeartbeat, refused), true},
+	} {
+		if got := isTransientHeartbeatErr(test.err); got != test.transient {
+			t.Errorf("isTransientHeartbeatErr(%v) = %v, exp %v", test.err, got, test.transient)
+		}
+	}
+}
+
+func TestResetOffsetFunc(t *testing.T) {
+	cl, err := NewClient(
+		SeedBrokers("127.0.0.1:1"),
+		ConsumerGroup("g"),
+		ConsumeTopics("config", "events"),
+		ConsumeResetOffset(NewOffset().AtEnd()),
+		ResetOffsetFunc(func(topic string, _ int32) Offset {
+			if topic == "config" {
+				return NewOffset().AtStart()
+			}
+			return Offset{}
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+	g := cl.consumer.g
+
+	if got := g.resetOffsetFor("config", 0); got != NewOffset().AtStart() {
+		t.Errorf("config: got %v, exp the start", got)
+	}
+	if got := g.resetOffsetFor("events", 0); got != NewOffset().AtEnd() {
+		t.Errorf("events: got %v, exp the configured reset at the end", got)
+	}
+}
+
+func TestDescribedGroup(t *testing.T) {
+	meta := kmsg.NewConsumerMemberMetadata()
+	meta.Topics = []string{"t", "u"}
+	assignment := kmsg.NewConsumerMemberAssignment()
+	assignment.Topics = []kmsg.ConsumerMemberAssignmentTopic{{Topic: "t", Partitions: []int32{0, 1}}}
+
+	rg := kmsg.NewDescribeGroupsResponseGroup()
+	rg.Group = "g"
+	rg.State = "Stable"
+	rg.ProtocolType = "consumer"
+	rg.Protocol = "cooperative-sticky"
+	for _, id := range []string{"m2", "m1"} {
+		rm := kmsg.NewDescribeGroupsResponseGroupMember()
+		rm.MemberID = id
+		rm.ProtocolMetadata = meta.AppendTo(nil)
+		if id == "m1" {
+			rm.MemberAssignment = assignment.AppendTo(nil)
+		}
+		rg.Members = append(rg.Members, rm)
+	}
+
+	d, err := describedGroup(&rg, []GroupBalancer{CooperativeStickyBalancer()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Group != "g" || d.State != "Stable" || d.Protocol != "cooperative-sticky" || len(d.Members) != 2 {
+		t.Fatalf("got %+v", d)
+	}
+	m1, m2 := d.Members[0], d.Members[1]
+	if m1.MemberID != "m1" || !reflect.DeepEqual(m1.Topics, meta.Topics) || !reflect.DeepEqual(m1.Assigned, map[string][]int32{"t": {0, 1}}) {
+		t.Errorf("first member: got %+v", m1)
+	}
+	if m2.MemberID != "m2" || m2.Assigned != nil {
+		t.Errorf("second member: got %+v, exp no assignment", m2)
+	}
+
+	rg.ErrorCode = kerr.GroupAuthorizationFailed.Code
+	if _, err := describedGroup(&rg, nil); !errors.Is(err, kerr.GroupAuthorizationFailed) {
+		t.Errorf("got err %v, exp GROUP_AUTHORIZATION_FAILED", err)
+	}
+
+	cl, err := NewClient(SeedBrokers("127.0.0.1:1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+	if _, err := cl.DescribeGroup(context.Background()); err == nil {
+		t.Error("describing without a group did not error")
+	}
+}
+
+func TestAutoCommitOnCloseBounded(t *testing.T) {
+	// A broker that accepts connections and never replies would block an
+	// unbounded final commit forever.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	accepted := make(chan struct{})
+	go func() {
+		defer close(accepted)
+		var conns []net.Conn
+		defer func() {
+			for _, conn := range conns {
+				conn.Close()
+			}
+		}()
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conns = append(conns, conn)
+		}
+	}()
+	closeBroker := func() { ln.Close(); <-accepted }
+
+	committed := make(chan error, 1)
+	cl, err := NewClient(
+		SeedBrokers(ln.Addr().String()),
+		ConsumerGroup("g"),
+		ConsumeTopics("t"),
+		AutoCommitOnClose(300*time.Millisecond),
+		AutoCommitCallback(func(_ *Client, _ *kmsg.OffsetCommitRequest, _ *kmsg.OffsetCommitResponse, err error) {
+			committed <- err
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+	defer closeBroker() // before closing the client, so leaving the group does not hang
+	g := cl.consumer.g
+	g.mu.Lock()
+	g.uncommitted = uncommitted{"t": {0: {head: EpochOffset{-1, 10}, committed: EpochOffset{-1, 5}}}}
+	g.mu.Unlock()
+
+	start := time.Now()
+	g.commitOnLeave()
+	if elapsed := time.Since(start); elapsed < 250*time.Millisecond || elapsed > 5*time.Second {
+		t.Errorf("final commit took %v, exp about the 300ms timeout", elapsed)
+	}
+	select {
+	case err := <-committed:
+		if err == nil {
+			t.Error("commit to an unresponsive broker unexpectedly succeeded")
+		}
+	default:
+		t.Error("commit callback was not called")
+	}
+
+	// Once leaving, the default revoke leaves the final commit to
+	// commitOnLeave rather than committing again without a bound.
+	start = time.Now()
+	g.defaultRevoke(context.Background(), cl, nil)
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Errorf("default revoke while leaving took %v, exp to skip committing", elapsed)
+	}
+}
+
+func TestCommitOnLeave(t *testing.T) {
+	newGroup := func(opts ...Opt) (*Client, *groupConsumer, chan error) {
+		committed := make(chan error, 1)
+		cl, err := NewClient(append([]Opt{
+			SeedBrokers("127.0.0.1:1"),
+			ConsumerGroup("g"),
+			ConsumeTopics("t"),
+			RequestRetries(0),
+			AutoCommitCallback(func(_ *Client, _ *kmsg.OffsetCommitRequest, _ *kmsg.OffsetCommitResponse, err error) {
+				committed <- err
+			}),
+		}, opts...)...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		g := cl.consumer.g
+		g.mu.Lock()
+		g.uncommitted = uncommitted{"t": {0: {head: EpochOffset{-1, 10}, committed: EpochOffset{-1, 5}}}}
+		g.mu.Unlock()
+		return cl, g, committed
+	}
+
+	t.Run("default_revoke", func(t *testing.T) {
+		cl, g, committed := newGroup()
+		defer cl.Close()
+
+		// Until commitOnLeave takes over, the default revoke commits
+		// even if the group context is canceled.
+		g.cancel()
+		g.defaultRevoke(context.Background(), cl, nil)
+		select {
+		case <-committed:
+		default:
+			t.Error("default revoke did not commit before commitOnLeave ran")
+		}
+
+		// The final commit must not begin until the autocommit loop
+		// quits, so that a last tick cannot race with it.
+		g.commitLoopDone = make(chan struct{})
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			g.commitOnLeave()
+		}()
+		select {
+		case <-done:
+			t.Fatal("final commit did not wait for the autocommit loop to quit")
+		case <-time.After(50 * time.Millisecond):
+		}
+		close(g.commitLoopDone)
+		select {
+		case <-done:
+		case <-time.After(10 * time.Second):
+			t.Fatal("final commit did not finish")
+		}
+		select {
+		case <-committed:
+		default:
+			t.Error("final commit was not issued")
+		}
+
+		// The default revoke leaves the commit to commitOnLeave
+		// once leaving, rather than committing a second time.
+		g.defaultRevoke(context.Background(), cl, nil)
+		select {
+		case <-committed:
+			t.Error("default revoke unexpectedly committed while leaving")
+		default:
+		}
+	})
+
+	t.Run("custom_revoke", func(t *testing.T) {
+		cl, g, committed := newGroup(OnPartitionsRevoked(func(context.Context, *Client, map[string][]int32) {}))
+		defer cl.Close()
+
+		g.commitLoopDone = make(chan struct{}) // never closed: we must not wait
+		g.commitOnLeave()
+		select {
+		case <-committed:
+			t.Error("final commit unexpectedly issued with a custom revoke")
+		default:
+		}
+	})
+}
+
+func TestGroupErrorClears(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		joins   int
+		release = make(chan struct{})
+		b       *fakeBroker
+	)
+	b = newFakeBroker(t, func(req kmsg.Request) kmsg.Response {
+		switch req := req.(type) {
+		case *kmsg.MetadataRequest:
+			resp := b.metadata(req)
+			rt := kmsg.NewMetadataResponseTopic()
+			rt.Topic = kmsg.StringPtr("t")
+			rp := kmsg.NewMetadataResponseTopicPartition()
+			rp.Replicas = []int32{0}
+			rp.ISR = []int32{0}
+			rt.Partitions = append(rt.Partitions, rp)
+			resp.Topics = append(resp.Topics, rt)
+			return resp
+
+		case *kmsg.JoinGroupRequest:
+			mu.Lock()
+			joins++
+			n := joins
+			mu.Unlock()
+			resp := req.ResponseKind().(*kmsg.JoinGroupResponse)
+			if n == 1 {
+				resp.ErrorCode = kerr.GroupAuthorizationFailed.Code
+				return resp
+			}
+			<-release // hold the rejoin until we checked the error
+			resp.MemberID = "me"
+			resp.LeaderID = "other"
+			resp.Generation = 1
+			resp.Protocol = kmsg.StringPtr("range")
+			return resp
+
+		case *kmsg.SyncGroupRequest:
+			resp := req.ResponseKind().(*kmsg.SyncGroupResponse)
+			assignment := kmsg.NewConsumerMemberAssignment()
+			resp.MemberAssignment = assignment.AppendTo(nil)
+			return resp
+
+		case *kmsg.HeartbeatRequest:
+			return req.ResponseKind()
+		}
+		return nil
+	})
+	cl, err := NewClient(
+		SeedBrokers(b.addr()),
+		ConsumerGroup("g"),
+		ConsumeTopics("t"),
+		Balancers(RangeBalancer()),
+		GroupErrorBackoff(func(int) time.Duration { return time.Millisecond }),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+	defer b.close()
+	defer close(release)
+
+	waitFor := func(cond func() bool, what string) {
+		for deadline := time.Now().Add(5 * time.Second); !cond(); time.Sleep(5 * time.Millisecond) {
+			if time.Now().After(deadline) {
+				t.Fatalf("timed out waiting for %s", what)
+			}
+		}
+	}
+
+	waitFor(func() bool { return cl.GroupError() != nil }, "the join error")
+	if err := cl.GroupError(); !errors.Is(err, kerr.GroupAuthorizationFailed) {
+		t.Errorf("got group error %v, exp GROUP_AUTHORIZATION_FAILED", err)
+	}
+	if err := cl.FatalGroupError(); err != nil {
+		t.Errorf("got fatal error %v, exp the authorization failure to be retried", err)
+	}
+
+	release <- struct{}{}
+	waitFor(func() bool { return cl.GroupError() == nil }, "the group error to clear after rejoining")
+}
+
+func TestGroupStatusState(t *testing.T) {
+	cl, err := NewClient(SeedBrokers("127.0.0.1:1"), ConsumerGroup("g"), ConsumeTopics("t"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+	g := cl.consumer.g
+
+	check := func(exp GroupMemberState) GroupStatus {
+		t.Helper()
+		s := cl.GroupStatus()
+		if s.State != exp {
+			t.Fatalf("got state %v, exp %v", s.State, exp)
+		}
+		if state, since, err := cl.GroupState(); state != s.State || !since.Equal(s.StateSince) || err != s.Err {
+			t.Fatalf("GroupState %v %v %v != GroupStatus %+v", state, since, err, s)
+		}
+		return s
+	}
+
+	if s := check(GroupMemberUnjoined); s.StateSince.IsZero() || s.Err != nil {
+		t.Errorf("initial state %+v, exp a time and no error", s)
+	}
+	g.setState(GroupMemberJoining, nil)
+	check(GroupMemberJoining)
+	g.setState(GroupMemberSyncing, nil)
+	check(GroupMemberSyncing)
+	g.setConsuming(true)
+	check(GroupMemberStable)
+
+	// Joining and syncing during a rebalance keep the time the
+	// rebalance began.
+	g.setState(GroupMemberRebalancing, nil)
+	rebalancing := check(GroupMemberRebalancing)
+	g.setConsuming(false)
+	g.setState(GroupMemberJoining, nil)
+	g.setState(GroupMemberSyncing, nil)
+	if s := check(GroupMemberRebalancing); !s.StateSince.Equal(rebalancing.StateSince) {
+		t.Errorf("rebalance start moved from %v to %v", rebalancing.StateSince, s.StateSince)
+	}
+	g.setConsuming(true)
+	check(GroupMemberStable)
+
+	sessionErr := errors.New("session broke")
+	g.setState(GroupMemberUnjoined, sessionErr)
+	if s := check(GroupMemberUnjoined); s.Err != sessionErr {
+		t.Errorf("got err %v, exp %v", s.Err, sessionErr)
+	}
+
+	fatal := &ErrGroupFatal{Err: kerr.GroupAuthorizationFailed}
+	g.setState(GroupMemberDead, fatal)
+	g.setState(GroupMemberJoining, nil)
+	if s := check(GroupMemberDead); s.Err != fatal {
+		t.Errorf("got err %v, exp %v", s.Err, fatal)
+	}
+
+	ncl, err := NewClient(SeedBrokers("127.0.0.1:1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ncl.Close()
+	if s := ncl.GroupStatus(); s.State != GroupMemberUnknown || !s.StateSince.IsZero() || s.Err != nil {
+		t.Errorf("got %+v for a client not in a group, exp the zero status", s)
+	}
+	if state, since, err := ncl.GroupState(); state != GroupMemberUnknown || !since.IsZero() || err != nil {
+		t.Errorf("got GroupState %v %v %v for a client not in a group, exp unknown", state, since, err)
+	}
+}
+
+func TestEagerRebalancingRevokesAll(t *testing.T) {
+	var revoked map[string][]int32
+	cl, err := NewClient(
+		SeedBrokers("127.0.0.1:1"),
+		ConsumerGroup("g"),
+		ConsumeTopics("t"),
+		EagerRebalancing(),
+		OnPartitionsRevoked(func(_ context.Context, _ *Client, r map[string][]int32) { revoked = r }),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+	g := cl.consumer.g
+
+	var protocols []string
+	for _, b := range g.cfg.balancers {
+		if b.IsCooperative() {
+			t.Errorf("balancer %s is cooperative", b.ProtocolName())
+		}
+		protocols = append(protocols, b.ProtocolName())
+	}
+	if exp := []string{"range", "roundrobin"}; !reflect.DeepEqual(protocols, exp) {
+		t.Errorf("got balancers %v != exp %v", protocols, exp)
+	}
+
+	// Whether we revoke eagerly is decided by the protocol the join
+	// response chose. Start from cooperative so that the join is what
+	// switches us to eager.
+	g.cooperative.Store(true)
+	join := kmsg.NewPtrJoinGroupResponse()
+	join.MemberID = "me"
+	join.LeaderID = "other"
+	join.Generation = 1
+	join.Protocol = kmsg.StringPtr("range")
+	if restart, protocol, _, err := g.handleJoinResp(join); restart || protocol != "range" || err != nil {
+		t.Fatalf("got join restart %v, protocol %q, err %v; exp no restart, range, no err", restart, protocol, err)
+	}
+	if g.cooperative.Load() {
+		t.Fatal("still cooperative after joining with the range protocol")
+	}
+
+	var cursors []*cursor
+	g.c.mu.Lock()
+	for p := int32(0); p < 2; p++ {
+		c := &cursor{topic: "t", partition: p}
+		c.setOffset(cursorOffset{offset: 10, lastConsumedEpoch: -1})
+		c.useState.Store(true)
+		g.c.usingCursors.use(c)
+		cursors = append(cursors, c)
+	}
+	g.c.mu.Unlock()
+	g.nowAssigned.store(map[string][]int32{"t": {0, 1}})
+	g.mu.Lock()
+	g.uncommitted = uncommitted{"t": {0: {head: EpochOffset{-1, 10}, committed: EpochOffset{-1, 5}}}}
+	g.mu.Unlock()
+
+	// A rebalance, not leaving the group: the eager consumer still
+	// revokes and invalidates everything.
+	g.revoke(revokeThisSession, nil, false)
+
+	if exp := map[string][]int32{"t": {0, 1}}; !reflect.DeepEqual(revoked, exp) {
+		t.Errorf("got revoked %v != exp %v", revoked, exp)
+	}
+	for _, c := range cursors {
+		if c.usable() || c.offset != -1 {
+			t.Errorf("partition %d was not invalidated: usable %v, offset %d", c.partition, c.usable(), c.offset)
+		}
+	}
+	g.c.mu.Lock()
+	using := len(g.c.usingCursors)
+	g.c.mu.Unlock()
+	if using != 0 {
+		t.Errorf("still using %d cursors after revoking", using)
+	}
+	if assigned := g.nowAssigned.read(); len(assigned) != 0 {
+		t.Errorf("still assigned %v after revoking", assigned)
+	}
+	g.mu.Lock()
+	uncommitted := g.uncommitted
+	g.mu.Unlock()
+	if uncommitted != nil {
+		t.Errorf("uncommitted not cleared after revoking: %v", uncommitted)
+	}
+}
+
+type supersededHook struct{ n chan int64 }
+
+func (h supersededHook) OnGroupCommitSuperseded(_ string, n int64) { h.n <- n }
+
+func TestCommitSuperseded(t *testing.T) {
+	// A broker that never replies keeps the first commit in flight
+	// until the second commit cancels it.
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	accepted := make(chan struct{})
+	go func() {
+		defer close(accepted)
+		var conns []net.Conn
+		defer func() {
+			for _, conn := range conns {
+				conn.Close()
+			}
+		}()
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conns = append(conns, conn)
+		}
+	}()
+	closeBroker := func() { ln.Close(); <-accepted }
+
+	hook := supersededHook{make(chan int64, 1)}
+	cl, err := NewClient(
+		SeedBrokers(ln.Addr().String()),
+		ConsumerGroup("g"),
+		ConsumeTopics("t"),
+		DisableAutoCommit(),
+		WithHooks(hook),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+	defer closeBroker()
+
+	first := make(chan error, 1)
+	cl.CommitOffsets(context.Background(), map[string]map[int32]EpochOffset{"t": {0: {-1, 1}}}, func(_ *Client, _ *kmsg.OffsetCommitRequest, _ *kmsg.OffsetCommitResponse, err error) {
+		first <- err
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	second := make(chan error, 1)
+	cl.CommitOffsets(ctx, map[string]map[int32]EpochOffset{"t": {0: {-1, 2}}}, func(_ *Client, _ *kmsg.OffsetCommitRequest, _ *kmsg.OffsetCommitResponse, err error) {
+		second <- err
+	})
+
+	select {
+	case err := <-first:
+		if !errors.Is(err, ErrCommitSuperseded) || !errors.Is(err, context.Canceled) {
+			t.Errorf("got first commit err %v, exp ErrCommitSuperseded", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("first commit was not superseded")
+	}
+	select {
+	case n := <-hook.n:
+		if n != 1 {
+			t.Errorf("got %d superseded commits, exp 1", n)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("superseded hook was not called")
+	}
+
+	// Our own cancelation is not reported as superseded.
+	cancel()
+	select {
+	case err := <-second:
+		if !errors.Is(err, context.Canceled) || errors.Is(err, ErrCommitSuperseded) {
+			t.Errorf("got second commit err %v, exp a plain context.Canceled", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("second commit did not finish after canceling")
+	}
+}
+
+func TestCommitPartitionErrors(t *testing.T) {
+	b := newFakeBroker(t, func(req kmsg.Request) kmsg.Response {
+		commit, ok := req.(*kmsg.OffsetCommitRequest)
+		if !ok {
+			return nil
+		}
+		resp := commit.ResponseKind().(*kmsg.OffsetCommitResponse)
+		for _, rt := range commit.Topics {
+			respT := kmsg.NewOffsetCommitResponseTopic()
+			respT.Topic = rt.Topic
+			for _, rp := range rt.Partitions {
+				respP := kmsg.NewOffsetCommitResponseTopicPartition()
+				respP.Partition = rp.Partition
+				respP.ErrorCode = kerr.OffsetMetadataTooLarge.Code
+				respT.Partitions = append(respT.Partitions, respP)
+			}
+			resp.Topics = append(resp.Topics, respT)
+		}
+		return resp
+	})
+	cl, err := NewClient(SeedBrokers(b.addr()), ConsumerGroup("g"), ConsumeTopics("t"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+	defer b.close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// CommitSync returns which partition failed ...
+	err = cl.CommitSync(ctx, map[string]map[int32]EpochOffset{"t": {3: {-1, 10}}})
+	var pe *ErrPartition
+	if !errors.As(err, &pe) {
+		t.Fatalf("got %v, not an *ErrPartition", err)
+	}
+	if pe.Topic != "t" || pe.Partition != 3 || !errors.Is(err, kerr.OffsetMetadataTooLarge) {
+		t.Errorf("got %v, exp t/3 failing with %v", pe, kerr.OffsetMetadataTooLarge)
+	}
+
+	// ... while the older commit functions return the kerr error itself.
+	err = cl.CommitRecords(ctx, &Record{Topic: "t", Partition: 3, Offset: 10, LeaderEpoch: -1})
+	if err != kerr.OffsetMetadataTooLarge { //nolint:errorlint // testing direct comparisons
+		t.Errorf("got %v != exp %v", err, kerr.OffsetMetadataTooLarge)
+	}
+}
+
+func TestSetConsumeTopicsRejoinsOnce(t *testing.T) {
+	cl, err := NewClient(SeedBrokers("127.0.0.1:1"), ConsumerGroup("g"), ConsumeTopics("a", "b"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+
+	c := &cl.consumer
+	g := c.g
+	g.mu.Lock()
+	g.using = map[string]int{"a": 1, "b": 1}
+	g.managing = true // pretend we are in the group; metadata never loads here
+	g.mu.Unlock()
+	defer func() {
+		g.mu.Lock()
+		g.managing = false
+		g.mu.Unlock()
+	}()
+
+	rejoins := func() (n int) {
+		for {
+			select {
+			case <-g.rejoinCh:
+				n++
+			default:
+				return n
+			}
+		}
+	}
+
+	cl.SetConsumeTopics("b", "c")
+
+	topics := cl.GetConsumeTopics()
+	sort.Strings(topics)
+	if exp := []string{"b", "c"}; !reflect.DeepEqual(topics, exp) {
+		t.Errorf("topics: got %v != exp %v", topics, exp)
+	}
+	g.mu.Lock()
+	using := g.using
+	g.mu.Unlock()
+	if exp := map[string]int{"b": 1}; !reflect.DeepEqual(using, exp) {
+		t.Errorf("using: got %v != exp %v", using, exp)
+	}
+	if n := rejoins(); n != 0 {
+		t.Errorf("rejoined %d times before metadata loaded the new topics", n)
+	}
+
+	// The next metadata update rejoins once, even though c does not exist
+	// and there is thus no new topic to consume.
+	for i := 0; i < 2; i++ {
+		c.mu.Lock()
+		g.findNewAssignments()
+		c.mu.Unlock()
+	}
+	if n := rejoins(); n != 1 {
+		t.Errorf("got %d rejoins after metadata updates, exp 1", n)
+	}
+}
+
+type recordLogger struct {
+	mu   sync.Mutex
+	msgs []string
+}
+
+func (*recordLogger) Level() LogLevel { return LogLevelWarn }
+func (l *recordLogger) Log(_ LogLevel, msg string, _ ...any) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.msgs = append(l.msgs, msg)
+}
+
+func (l *recordLogger) count(substr string) (n int) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for _, msg := range l.msgs {
+		if strings.Contains(msg, substr) {
+			n++
+		}
+	}
+	return n
+}
+
+func TestPauseAutoCommit(t *testing.T) {
+	logger := new(recordLogger)
+	cl, err := NewClient(
+		SeedBrokers("127.0.0.1:1"),
+		ConsumerGroup("g"),
+		ConsumeTopics("t"),
+		AutoCommitPauseWait(10*time.Millisecond),
+		WithLogger(logger),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+	g := cl.consumer.g
+
+	// Pauses nest, and an unmatched resume is ignored with a warning.
+	cl.PauseAutoCommit()
+	cl.PauseAutoCommit()
+	if depth, since := cl.AutoCommitPaused(); depth != 2 || since.IsZero() {
+		t.Errorf("got depth %d since %v, exp 2 since now", depth, since)
+	}
+	cl.ResumeAutoCommit()
+	if depth, _ := cl.AutoCommitPaused(); depth != 1 {
+		t.Errorf("got depth %d after one resume, exp 1", depth)
+	}
+
+	// While paused, revoking waits the pause wait and then gives up.
+	if g.waitAutoResumed() {
+		t.Error("waitAutoResumed returned true while paused")
+	}
+
+	// Resuming while waiting unblocks the wait.
+	g.cfg.autocommitPauseWait = 5 * time.Second
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		cl.ResumeAutoCommit()
+	}()
+	if !g.waitAutoResumed() {
+		t.Error("waitAutoResumed returned false after resuming")
+	}
+	if depth, since := cl.AutoCommitPaused(); depth != 0 || !since.IsZero() {
+		t.Errorf("got depth %d since %v, exp 0 and the zero time", depth, since)
+	}
+	cl.ResumeAutoCommit()
+	if n := logger.count("without a matching PauseAutoCommit"); n != 1 {
+		t.Errorf("got %d unmatched resume warnings, exp 1", n)
+	}
+
+	// A pause longer than the session timeout warns once per pause.
+	const longPause = "paused for longer than the session timeout"
+	for i := 0; i < 2; i++ {
+		cl.PauseAutoCommit()
+		g.mu.Lock()
+		g.autoPausedAt = time.Now().Add(-2 * g.cfg.sessionTimeout)
+		g.warnLongAutoPauseLocked()
+		g.warnLongAutoPauseLocked()
+		g.mu.Unlock()
+		cl.ResumeAutoCommit()
+		if n := logger.count(longPause); n != i+1 {
+			t.Errorf("pause %d: got %d long pause warnings, exp %d", i, n, i+1)
+		}
+	}
+}
+
+func TestCheckInstanceIDOnce(t *testing.T) {
+	var (
+		mu        sync.Mutex
+		describes int
+		groupErr  int16
+		members   []kmsg.DescribeGroupsResponseGroupMember
+	)
+	b := newFakeBroker(t, func(req kmsg.Request) kmsg.Response {
+		describe, ok := req.(*kmsg.DescribeGroupsRequest)
+		if !ok {
+			return nil
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		describes++
+		resp := describe.ResponseKind().(*kmsg.DescribeGroupsResponse)
+		rg := kmsg.NewDescribeGroupsResponseGroup()
+		rg.Group = "g"
+		rg.ErrorCode = groupErr
+		rg.Members = members
+		resp.Groups = append(resp.Groups, rg)
+		return resp
+	})
+	member := func(memberID, instanceID string) kmsg.DescribeGroupsResponseGroupMember {
+		m := kmsg.NewDescribeGroupsResponseGroupMember()
+		m.MemberID = memberID
+		m.InstanceID = kmsg.StringPtr(instanceID)
+		m.ClientID = "c"
+		m.ClientHost = "/127.0.0.1"
+		return m
+	}
+	set := func(code int16, ms ...kmsg.DescribeGroupsResponseGroupMember) {
+		mu.Lock()
+		defer mu.Unlock()
+		groupErr, members = code, ms
+	}
+
+	cl, err := NewClient(
+		SeedBrokers(b.addr()),
+		ClientID("c"),
+		ConsumerGroup("g"),
+		ConsumeTopics("t"),
+		InstanceID("i"),
+		CheckInstanceIDConflict(),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+	defer b.close()
+	g := cl.consumer.g
+	g.memberGen.store("me", 1)
+
+	// A failed describe is logged and retried after the next join.
+	set(kerr.GroupAuthorizationFailed.Code)
+	if err := g.checkInstanceIDOnce(); err != nil || g.instanceIDChecked {
+		t.Fatalf("failed describe: got err %v, checked %v; exp no error and not checked", err, g.instanceIDChecked)
+	}
+
+	// Only us, and members with other instance IDs, is not a conflict.
+	set(0, member("me", "i"), member("other", "j"))
+	if err := g.checkInstanceIDOnce(); err != nil || !g.instanceIDChecked {
+		t.Fatalf("no conflict: got err %v, checked %v; exp no error and checked", err, g.instanceIDChecked)
+	}
+
+	// We only check once.
+	set(0, member("me", "i"), member("other", "i"))
+	if err := g.checkInstanceIDOnce(); err != nil {
+		t.Fatalf("second check: got unexpected err %v", err)
+	}
+	mu.Lock()
+	if describes != 2 {
+		t.Errorf("got %d describes, exp 2", describes)
+	}
+	mu.Unlock()
+
+	// Another member with our instance ID is a fatal conflict.
+	g.instanceIDChecked = false
+	err = g.checkInstanceIDOnce()
+	var fe *ErrGroupFatal
+	var ce *ErrInstanceIDConflict
+	if !errors.As(err, &fe) || !errors.As(err, &ce) {
+		t.Fatalf("got %v, exp an *ErrGroupFatal wrapping *ErrInstanceIDConflict", err)
+	}
+	exp := &ErrInstanceIDConflict{
+		InstanceID: "i",
+		MemberID:   "me",
+		Members:    []string{"me c /127.0.0.1", "other c /127.0.0.1"},
+	}
+	if !reflect.DeepEqual(ce, exp) {
+		t.Errorf("got %+v != exp %+v", ce, exp)
+	}
+}
+
+func TestCommitStatuses(t *testing.T) {
+	b := newFakeBroker(t, func(req kmsg.Request) kmsg.Response {
+		commit, ok := req.(*kmsg.OffsetCommitRequest)
+		if !ok {
+			return nil
+		}
+		time.Sleep(5 * time.Millisecond) // some latency to report
+		resp := commit.ResponseKind().(*kmsg.OffsetCommitResponse)
+		for _, rt := range commit.Topics {
+			respT := kmsg.NewOffsetCommitResponseTopic()
+			respT.Topic = rt.Topic
+			for _, rp := range rt.Partitions {
+				respP := kmsg.NewOffsetCommitResponseTopicPartition()
+				respP.Partition = rp.Partition
+				respT.Partitions = append(respT.Partitions, respP)
+			}
+			resp.Topics = append(resp.Topics, respT)
+		}
+		return resp
+	})
+	cl, err := NewClient(SeedBrokers(b.addr()), ConsumerGroup("g"), ConsumeTopics("t"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+	defer b.close()
+
+	if statuses := cl.CommitStatuses(); statuses != nil {
+		t.Errorf("got %v before consuming, exp nil", statuses)
+	}
+
+	// Partition 0 has polled past its fetched commit, partition 1 has not.
+	g := cl.consumer.g
+	g.mu.Lock()
+	g.uncommitted = uncommitted{"t": {
+		0: {dirty: EpochOffset{-1, 10}, head: EpochOffset{-1, 10}, committed: EpochOffset{-1, 3}},
+		1: {dirty: EpochOffset{-1, 5}, head: EpochOffset{-1, 5}, committed: EpochOffset{-1, 5}},
+	}}
+	g.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	start := time.Now()
+	if err := cl.CommitUncommittedOffsets(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	statuses := cl.CommitStatuses()
+	s0, s1 := statuses["t"][0], statuses["t"][1]
+	if s0.Committed != (EpochOffset{-1, 10}) || s0.LastCommit.Before(start) || s0.LastCommitLatency < 5*time.Millisecond {
+		t.Errorf("committed partition: got %+v, exp offset 10 committed after %v with at least 5ms latency", s0, start)
+	}
+	if s1 != (CommitStatus{Committed: EpochOffset{-1, 5}}) {
+		t.Errorf("uncommitted partition: got %+v, exp only the fetched offset 5", s1)
+	}
+}
+
+func TestRegexRefreshInterval(t *testing.T) {
+	for _, refresh := range []time.Duration{0, 20 * time.Millisecond} {
+		var created atomic.Bool
+		var b *fakeBroker
+		b = newFakeBroker(t, func(req kmsg.Request) kmsg.Response {
+			meta, ok := req.(*kmsg.MetadataRequest)
+			if !ok || !created.Load() {
+				return nil
+			}
+			resp := b.metadata(meta)
+			rt := kmsg.NewMetadataResponseTopic()
+			rt.Topic = kmsg.StringPtr("t1")
+			rp := kmsg.NewMetadataResponseTopicPartition()
+			rp.Replicas, rp.ISR = []int32{0}, []int32{0}
+			rt.Partitions = append(rt.Partitions, rp)
+			resp.Topics = append(resp.Topics, rt)
+			return resp
+		})
+		opts := []Opt{
+			SeedBrokers(b.addr()),
+			ConsumerGroup("g"),
+			ConsumeRegex(),
+			ConsumeTopics("^t"),
+			MetadataMinAge(10 * time.Millisecond),
+			MetadataMaxAge(time.Hour),
+		}
+		if refresh > 0 {
+			opts = append(opts, RegexRefreshInterval(refresh))
+		}
+		cl, err := NewClient(opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		// Let the initial metadata load see no topics, then create
+		// one: only periodic refreshes can discover it.
+		time.Sleep(50 * time.Millisecond)
+		created.Store(true)
+		var found bool
+		for start := time.Now(); time.Since(start) < 500*time.Millisecond && !found; time.Sleep(10 * time.Millisecond) {
+			found = len(cl.GetConsumeTopics()) > 0
+		}
+		if found != (refresh > 0) {
+			t.Errorf("refresh %v: got topic found %v, exp %v", refresh, found, refresh > 0)
+		}
+
+		b.close()
+		cl.Close()
+	}
+}
+
+// cannedOffsetFetch replies to an offset fetch with offset 100+partition and
+// the given metadata for every requested partition.
+func cannedOffsetFetch(req *kmsg.OffsetFetchRequest, metadata string) *kmsg.OffsetFetchResponse {
+	resp := req.ResponseKind().(*kmsg.OffsetFetchResponse)
+	if len(req.Groups) == 0 { // v0-v7
+		for _, rt := range req.Topics {
+			respT := kmsg.NewOffsetFetchResponseTopic()
+			respT.Topic = rt.Topic
+			for _, p := range rt.Partitions {
+				respP := kmsg.NewOffsetFetchResponseTopicPartition()
+				respP.Partition = p
+				respP.Offset = 100 + int64(p)
+				respP.Metadata = kmsg.StringPtr(metadata)
+				respT.Partitions = append(respT.Partitions, respP)
+			}
+			resp.Topics = append(resp.Topics, respT)
+		}
+		return resp
+	}
+	for _, rg := range req.Groups {
+		respG := kmsg.NewOffsetFetchResponseGroup()
+		respG.Group = rg.Group
+		for _, rt := range rg.Topics {
+			respT := kmsg.NewOffsetFetchResponseGroupTopic()
+			respT.Topic = rt.Topic
+			for _, p := range rt.Partitions {
+				respP := kmsg.NewOffsetFetchResponseGroupTopicPartition()
+				respP.Partition = p
+				respP.Offset = 100 + int64(p)
+				respP.Metadata = kmsg.StringPtr(metadata)
+				respT.Partitions = append(respT.Partitions, respP)
+			}
+			respG.Topics = append(respG.Topics, respT)
+		}
+		resp.Groups = append(resp.Groups, respG)
+	}
+	return resp
+}
+
+func TestFetchOffsetsMergesChunks(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		fetches int
+	)
+	b := newFakeBroker(t, func(req kmsg.Request) kmsg.Response {
+		fetch, ok := req.(*kmsg.OffsetFetchRequest)
+		if !ok {
+			return nil
+		}
+		mu.Lock()
+		fetches++
+		mu.Unlock()
+		return cannedOffsetFetch(fetch, "")
+	})
+	var fetched *kmsg.OffsetFetchResponse
+	cl, err := NewClient(
+		SeedBrokers(b.addr()),
+		ConsumerGroup("g"),
+		ConsumeTopics("t"),
+		OffsetRequestChunkSize(2),
+		OnOffsetsFetched(func(_ context.Context, _ *Client, resp *kmsg.OffsetFetchResponse) error {
+			fetched = resp
+			return nil
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+	defer b.close()
+
+	g := cl.consumer.g
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := g.fetchOffsets(ctx, map[string][]int32{"t": {0, 1, 2}}); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	if fetches != 2 {
+		t.Errorf("got %d offset fetches, exp 2 chunks", fetches)
+	}
+	mu.Unlock()
+	if fetched == nil || len(fetched.Topics) != 1 || len(fetched.Topics[0].Partitions) != 3 {
+		t.Fatalf("got fetched response %+v, exp one topic with all three partitions", fetched)
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for p := int32(0); p < 3; p++ {
+		if got, exp := g.uncommitted["t"][p].committed, (EpochOffset{-1, 100 + int64(p)}); got != exp {
+			t.Errorf("partition %d: got committed %v != exp %v", p, got, exp)
+		}
+	}
+}
+
+func TestCommitMergesChunks(t *testing.T) {
+	var inflight, maxInflight atomic.Int32
+	issueChunks(4*maxOffsetChunksInFlight, func(int) {
+		n := inflight.Add(1)
+		for {
+			prior := maxInflight.Load()
+			if n <= prior || maxInflight.CompareAndSwap(prior, n) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond)
+		inflight.Add(-1)
+	})
+	if got := maxInflight.Load(); got > maxOffsetChunksInFlight {
+		t.Errorf("got %d chunks in flight > max %d", got, maxOffsetChunksInFlight)
+	}
+
+	committed := func(commit *kmsg.OffsetCommitRequest) *kmsg.OffsetCommitResponse {
+		resp := commit.ResponseKind().(*kmsg.OffsetCommitResponse)
+		for _, t := range commit.Topics {
+			respT := kmsg.NewOffsetCommitResponseTopic()
+			respT.Topic = t.Topic
+			for _, p := range t.Partitions {
+				respP := kmsg.NewOffsetCommitResponseTopicPartition()
+				respP.Partition = p.Partition
+				respT.Partitions = append(respT.Partitions, respP)
+			}
+			resp.Topics = append(resp.Topics, respT)
+		}
+		return resp
+	}
+	b := newFakeBroker(t, func(req kmsg.Request) kmsg.Response {
+		if commit, ok := req.(*kmsg.OffsetCommitRequest); ok {
+			return committed(commit)
+		}
+		return nil
+	})
+	cl, err := NewClient(
+		SeedBrokers(b.addr()),
+		ConsumerGroup("g"),
+		ConsumeTopics("a", "b"),
+		OffsetRequestChunkSize(2),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+	defer b.close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	var (
+		req  *kmsg.OffsetCommitRequest
+		resp *kmsg.OffsetCommitResponse
+	)
+	cl.CommitOffsetsSync(ctx, map[string]map[int32]EpochOffset{
+		"a": {0: {-1, 1}, 1: {-1, 1}, 2: {-1, 1}},
+		"b": {0: {-1, 1}, 1: {-1, 1}, 2: {-1, 1}},
+	}, func(_ *Client, r *kmsg.OffsetCommitRequest, rr *kmsg.OffsetCommitResponse, err error) {
+		if err != nil {
+			t.Errorf("unexpected commit err: %v", err)
+		}
+		req, resp = r, rr
+	})
+	if resp == nil {
+		t.Fatal("missing commit response")
+	}
+
+	// Six partitions in chunks of two split at least one topic across
+	// chunks; the response must have each topic once, in request order.
+	if len(resp.Topics) != len(req.Topics) {
+		t.Fatalf("got %d response topics != exp %d", len(resp.Topics), len(req.Topics))
+	}
+	for i, rt := range resp.Topics {
+		if rt.Topic != req.Topics[i].Topic || len(rt.Partitions) != 3 {
+			t.Errorf("response topic %d: got %s with %d partitions, exp %s with 3", i, rt.Topic, len(rt.Partitions), req.Topics[i].Topic)
+		}
+	}
+
+	// If a chunk fails, the merged response keeps the committed
+	// partitions of the other chunks and fails only the failed chunk's.
+	chunks := chunkOffsetCommit(req, 2)
+	merged := mergeCommitChunks([]*kmsg.OffsetCommitResponse{
+		failedCommitChunk(chunks[0], kerr.CoordinatorLoadInProgress),
+		failedCommitChunk(chunks[1], context.DeadlineExceeded),
+		committed(chunks[2]),
+	})
+	codes := make(map[int16]int)
+	for _, rt := range merged.Topics {
+		for _, rp := range rt.Partitions {
+			codes[rp.ErrorCode]++
+		}
+	}
+	if exp := map[int16]int{kerr.CoordinatorLoadInProgress.Code: 2, kerr.NetworkException.Code: 2, 0: 2}; !reflect.DeepEqual(codes, exp) {
+		t.Errorf("got partition error codes %v != exp %v", codes, exp)
+	}
+}
+
+func TestFetchOffsetsCommitMetadata(t *testing.T) {
+	b := newFakeBroker(t, func(req kmsg.Request) kmsg.Response {
+		if fetch, ok := req.(*kmsg.OffsetFetchRequest); ok {
+			return cannedOffsetFetch(fetch, "meta")
+		}
+		return nil
+	})
+	var adjusted map[string]map[int32]Offset
+	cl, err := NewClient(
+		SeedBrokers(b.addr()),
+		ConsumerGroup("g"),
+		ConsumeTopics("t"),
+		AdjustFetchOffsetsFn(func(_ context.Context, offsets map[string]map[int32]Offset) (map[string]map[int32]Offset, error) {
+			adjusted = offsets
+			return offsets, nil
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+	defer b.close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := cl.consumer.g.fetchOffsets(ctx, map[string][]int32{"t": {0, 1}}); err != nil {
+		t.Fatal(err)
+	}
+	if len(adjusted["t"]) != 2 {
+		t.Fatalf("got adjusted offsets %v, exp partitions 0 and 1 of t", adjusted)
+	}
+	for p, o := range adjusted["t"] {
+		if o.EpochOffset().Offset != 100+int64(p) || o.CommitMetadata() != "meta" {
+			t.Errorf("partition %d: got offset %d metadata %q, exp %d %q", p, o.EpochOffset().Offset, o.CommitMetadata(), 100+p, "meta")
+		}
+	}
+}
+
+func TestCommitOffsetsWithMetadataRoundTrip(t *testing.T) {
+	type committed struct {
+		offset   int64
+		metadata string
+	}
+	var (
+		mu     sync.Mutex
+		stored = make(map[int32]committed) // topic "t" only
+	)
+	b := newFakeBroker(t, func(req kmsg.Request) kmsg.Response {
+		mu.Lock()
+		defer mu.Unlock()
+		switch req := req.(type) {
+		case *kmsg.OffsetCommitRequest:
+			resp := req.ResponseKind().(*kmsg.OffsetCommitResponse)
+			for _, rt := range req.Topics {
+				respT := kmsg.NewOffsetCommitResponseTopic()
+				respT.Topic = rt.Topic
+				for _, rp := range rt.Partitions {
+					var metadata string
+					if rp.Metadata != nil {
+						metadata = *rp.Metadata
+					}
+					stored[rp.Partition] = committed{rp.Offset, metadata}
+					respP := kmsg.NewOffsetCommitResponseTopicPartition()
+					respP.Partition = rp.Partition
+					respT.Partitions = append(respT.Partitions, respP)
+				}
+				resp.Topics = append(resp.Topics, respT)
+			}
+			return resp
+		case *kmsg.OffsetFetchRequest: // v8+, fetching everything
+			resp := req.ResponseKind().(*kmsg.OffsetFetchResponse)
+			respG := kmsg.NewOffsetFetchResponseGroup()
+			respG.Group = req.Groups[0].Group
+			respT := kmsg.NewOffsetFetchResponseGroupTopic()
+			respT.Topic = "t"
+			for p, c := range stored {
+				respP := kmsg.NewOffsetFetchResponseGroupTopicPartition()
+				respP.Partition = p
+				respP.Offset = c.offset
+				respP.Metadata = kmsg.StringPtr(c.metadata)
+				respT.Partitions = append(respT.Partitions, respP)
+			}
+			respG.Topics = append(respG.Topics, respT)
+			resp.Groups = append(resp.Groups, respG)
+			return resp
+		}
+		return nil
+	})
+	cl, err := NewClient(
+		SeedBrokers(b.addr()),
+		ConsumerGroup("g"),
+		ConsumeTopics("t"),
+		CommitMetadata(func(_ string, partition int32, _ EpochOffset) string {
+			return fmt.Sprintf("fn-%d", partition)
+		}),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+	defer b.close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Explicit metadata takes precedence over CommitMetadata, and empty
+	// metadata falls back to it.
+	var commitErr error
+	done := make(chan struct{})
+	onDone := firstCommitErr(&commitErr)
+	cl.CommitOffsetsWithMetadata(ctx, map[string]map[int32]EpochOffsetMetadata{"t": {
+		0: {EpochOffset{-1, 10}, "explicit"},
+		1: {EpochOffset{-1, 20}, ""},
+	}}, func(cl *Client, req *kmsg.OffsetCommitRequest, resp *kmsg.OffsetCommitResponse, err error) {
+		defer close(done)
+		onDone(cl, req, resp, err)
+	})
+	<-done
+	if commitErr != nil {
+		t.Fatal(commitErr)
+	}
+
+	fetched, err := cl.FetchCommittedOffsetsWithMetadata(ctx, "t")
+	if err != nil {
+		t.Fatal(err)
+	}
+	exp := map[string]map[int32]EpochOffsetMetadata{"t": {
+		0: {EpochOffset{-1, 10}, "explicit"},
+		1: {EpochOffset{-1, 20}, "fn-1"},
+	}}
+	if !reflect.DeepEqual(fetched, exp) {
+		t.Errorf("got %v != exp %v", fetched, exp)
+	}
+}
+
+func TestHeartbeatTransientErrors(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		n     int
+		codes func(n int) int16 // heartbeat number (from 1) => error code
+	)
+	b := newFakeBroker(t, func(req kmsg.Request) kmsg.Response {
+		hb, ok := req.(*kmsg.HeartbeatRequest)
+		if !ok {
+			return nil
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		n++
+		resp := hb.ResponseKind().(*kmsg.HeartbeatResponse)
+		resp.ErrorCode = codes(n)
+		return resp
+	})
+	cl, err := NewClient(
+		SeedBrokers(b.addr()),
+		ConsumerGroup("g"),
+		ConsumeTopics("t"),
+		SessionTimeout(300*time.Millisecond),
+		HeartbeatInterval(20*time.Millisecond),
+		RequestRetries(0), // surface NOT_COORDINATOR to the heartbeat loop itself
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+	defer b.close()
+	g := cl.consumer.g
+	g.memberGen.store("me", 1)
+
+	run := func(fn func(int) int16) (int, time.Duration, error) {
+		mu.Lock()
+		n, codes = 0, fn
+		mu.Unlock()
+		start := time.Now()
+		_, err := g.heartbeat(nil, newAssignRevokeSession())
+		mu.Lock()
+		defer mu.Unlock()
+		return n, time.Since(start), err
+	}
+
+	// A transient failure is retried on the next interval, and the loop
+	// only quits on the later non-transient error.
+	heartbeats, _, err := run(func(n int) int16 {
+		switch n {
+		case 2:
+			return kerr.NotCoordinator.Code
+		case 4:
+			return kerr.UnknownMemberID.Code
+		}
+		return 0
+	})
+	if !errors.Is(err, kerr.UnknownMemberID) || heartbeats != 4 {
+		t.Errorf("got err %v after %d heartbeats, exp UNKNOWN_MEMBER_ID after 4", err, heartbeats)
+	}
+
+	// Transient failures are retried only while our session is not at
+	// risk of expiring, after which the transient error is returned.
+	heartbeats, elapsed, err := run(func(n int) int16 {
+		if n == 1 {
+			return 0
+		}
+		return kerr.NotCoordinator.Code
+	})
+	if !errors.Is(err, kerr.NotCoordinator) {
+		t.Errorf("got err %v, exp NOT_COORDINATOR once the session is at risk", err)
+	}
+	if heartbeats < 3 || elapsed < 200*time.Millisecond {
+		t.Errorf("gave up after %d heartbeats in %v, exp to keep trying until the session is at risk", heartbeats, elapsed)
+	}
+}
@@ -0,0 +1,631 @@
+package kgo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kmsg"
+)
+
+func BenchmarkPollFetches(b *testing.B) {
+	cl, err := NewClient(SeedBrokers("127.0.0.1:1"))
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer cl.Close()
+
+	errFake := errors.New("fake")
+	c := &cl.consumer
+	fill := func() {
+		c.sourcesReadyMu.Lock()
+		for i := 0; i < 8; i++ {
+			c.fakeReadyForDraining = append(c.fakeReadyForDraining, Fetch{Topics: []FetchTopic{{
+				Partitions: []FetchPartition{{Err: errFake}},
+			}}})
+		}
+		c.sourcesReadyMu.Unlock()
+	}
+
+	b.Run("poll", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			b.StopTimer()
+			fill()
+			b.StartTimer()
+			if fs := cl.PollFetches(nil); len(fs) != 8 {
+				b.Fatalf("got %d fetches != exp 8", len(fs))
+			}
+		}
+	})
+
+	b.Run("poll_into", func(b *testing.B) {
+		b.ReportAllocs()
+		var fs Fetches
+		for i := 0; i < b.N; i++ {
+			b.StopTimer()
+			fill()
+			b.StartTimer()
+			cl.PollFetchesInto(nil, &fs)
+			if len(fs) != 8 {
+				b.Fatalf("got %d fetches != exp 8", len(fs))
+			}
+		}
+	})
+}
+
+func TestBlockRebalanceOnPollTimeout(t *testing.T) {
+	cl, err := NewClient(
+		SeedBrokers("127.0.0.1:1"),
+		ConsumerGroup("g"),
+		ConsumeTopics("t"),
+		BlockRebalanceOnPoll(),
+		RebalanceTimeout(100*time.Millisecond),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+
+	c := &cl.consumer
+	c.waitAndAddPoller() // as if we polled and never called AllowRebalance
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		c.waitAndAddRebalance()
+		c.unaddRebalance()
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("rebalance blocked past the rebalance timeout")
+	}
+
+	// The forgotten poller was masked out, so the next rebalance does
+	// not block at all.
+	c.waitAndAddRebalance()
+	c.unaddRebalance()
+}
+
+func TestConsumeRegexExpiry(t *testing.T) {
+	cl, err := NewClient(
+		SeedBrokers("127.0.0.1:1"),
+		ConsumeRegex(),
+		ConsumeTopics("^a"),
+		ConsumeRegexExpiry(time.Minute),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+	d := cl.consumer.d
+
+	if keep := cl.consumer.filterMetadataAllTopics([]string{"a1", "b1"}); len(keep) != 1 || keep[0] != "a1" {
+		t.Fatalf("got kept topics %v, exp [a1]", keep)
+	}
+	cl.consumer.filterMetadataAllTopics([]string{"a1"})
+	if _, ok := d.reMissing["b1"]; !ok || len(d.reSeen) != 2 {
+		t.Fatalf("b1 should be tracked as missing but still seen, got seen %v missing %v", d.reSeen, d.reMissing)
+	}
+
+	d.reMissing["b1"] = time.Now().Add(-2 * time.Minute)
+	cl.consumer.filterMetadataAllTopics([]string{"a1"})
+	if _, ok := d.reSeen["b1"]; ok {
+		t.Error("b1 was not expired from the regex cache")
+	}
+	if _, ok := d.reMissing["b1"]; ok {
+		t.Error("b1 was not expired from the missing tracking")
+	}
+	if !d.reSeen["a1"] {
+		t.Error("a1 should still be seen")
+	}
+}
+
+func TestConsumeRegexExclude(t *testing.T) {
+	cl, err := NewClient(
+		SeedBrokers("127.0.0.1:1"),
+		ConsumerGroup("g"),
+		ConsumeRegex(),
+		ConsumeTopics(`^events\.`),
+		ConsumeRegexExclude(`\.dlq$`, `^events\.internal\.`),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+
+	topics := []string{"events.a", "events.a.dlq", "events.internal.b", "other"}
+	keep := cl.consumer.filterMetadataAllTopics(append([]string(nil), topics...))
+	if len(keep) != 1 || keep[0] != "events.a" {
+		t.Errorf("got kept topics %v, exp [events.a]", keep)
+	}
+	exp := map[string]bool{"events.a": true, "events.a.dlq": false, "events.internal.b": false, "other": false}
+	if got := cl.consumer.g.reSeen; !reflect.DeepEqual(got, exp) {
+		t.Errorf("got seen %v, exp %v", got, exp)
+	}
+
+	if _, err := NewClient(ConsumeTopics("t"), ConsumeRegexExclude("x")); err == nil {
+		t.Error("exclusion without regex consuming was not rejected")
+	}
+	if _, err := NewClient(ConsumeRegex(), ConsumeTopics("t"), ConsumeRegexExclude("(")); err == nil {
+		t.Error("invalid exclusion expression was not rejected")
+	}
+}
+
+func TestDiscardBufferedMatching(t *testing.T) {
+	cl, err := NewClient(SeedBrokers("127.0.0.1:1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+
+	s := &source{cl: cl, sem: make(chan struct{})}
+	doneFetch := make(chan struct{}, 1)
+	used := make(usedOffsets)
+	var fetch Fetch
+	ft := FetchTopic{Topic: "t"}
+	cursors := make([]*cursor, 3)
+	for p := int32(0); p < 3; p++ {
+		cursors[p] = &cursor{topic: "t", partition: p, source: s}
+		if used["t"] == nil {
+			used["t"] = make(map[int32]*cursorOffsetNext)
+		}
+		used["t"][p] = &cursorOffsetNext{cursorOffset: cursorOffset{offset: 10}, from: cursors[p]}
+		if p < 2 { // partition 2 has no records, but is still used
+			ft.Partitions = append(ft.Partitions, FetchPartition{
+				Partition: p,
+				Records:   []*Record{{Topic: "t", Partition: p, Value: []byte("value")}},
+			})
+		}
+	}
+	fetch.Topics = append(fetch.Topics, ft)
+	s.buffered = bufferedFetch{fetch: fetch, doneFetch: doneFetch, usedOffsets: used}
+	s.hook(&s.buffered.fetch, true, false)
+
+	before := cl.BufferedFetchBytes()
+	if !s.discardBufferedMatching(map[string]map[int32]Offset{"t": {0: {}, 2: {}}}) {
+		t.Fatal("expected the fetch to still be buffered")
+	}
+	if got := cl.BufferedFetchRecords(); got != 1 {
+		t.Errorf("buffered records: got %d != exp 1", got)
+	}
+	if got := cl.BufferedFetchBytes(); got != before/2 {
+		t.Errorf("buffered bytes: got %d != exp %d", got, before/2)
+	}
+	if ps := s.buffered.fetch.Topics[0].Partitions; len(ps) != 1 || ps[0].Partition != 1 {
+		t.Errorf("kept partitions: got %v, exp only partition 1", ps)
+	}
+	if _, ok := s.buffered.usedOffsets["t"][2]; ok || len(s.buffered.usedOffsets["t"]) != 1 {
+		t.Errorf("used offsets: got %v, exp only partition 1", s.buffered.usedOffsets["t"])
+	}
+	if !cursors[0].usable() || !cursors[2].usable() || cursors[1].usable() {
+		t.Error("expected discarded cursors to be usable and the kept cursor to still be in use")
+	}
+	select {
+	case <-doneFetch:
+		t.Error("fetch was unexpectedly finished")
+	default:
+	}
+
+	if s.discardBufferedMatching(map[string]map[int32]Offset{"t": {1: {}}}) {
+		t.Fatal("expected the fetch to be fully discarded")
+	}
+	if got := cl.BufferedFetchRecords(); got != 0 {
+		t.Errorf("buffered records after full discard: got %d != exp 0", got)
+	}
+	select {
+	case <-doneFetch:
+	default:
+		t.Error("fully discarded fetch was not finished")
+	}
+}
+
+// testFetchBatch returns an uncompressed record batch starting at offset with
+// one record per value.
+func testFetchBatch(offset int64, values ...string) []byte {
+	var records []byte
+	for i, v := range values {
+		r := kmsg.Record{OffsetDelta: int32(i), Value: []byte(v)}
+		r.Length = int32(len(r.AppendTo(nil)) - 1) // a short length is a one byte varint
+		records = r.AppendTo(records)
+	}
+	b := kmsg.RecordBatch{
+		FirstOffset:          offset,
+		PartitionLeaderEpoch: -1,
+		Magic:                2,
+		LastOffsetDelta:      int32(len(values) - 1),
+		ProducerID:           -1,
+		ProducerEpoch:        -1,
+		FirstSequence:        -1,
+		NumRecords:           int32(len(values)),
+		Records:              records,
+	}
+	b.Length = int32(len(b.AppendTo(nil)) - 12)
+	b.CRC = int32(crc32.Checksum(b.AppendTo(nil)[21:], crc32.MakeTable(crc32.Castagnoli)))
+	return b.AppendTo(nil)
+}
+
+func TestFetchPartialPartitionErrors(t *testing.T) {
+	cl, err := NewClient(SeedBrokers("127.0.0.1:1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+
+	s := &source{cl: cl, nodeID: 1}
+	br := &broker{cl: cl}
+	req := &fetchRequest{usedOffsets: usedOffsets{"t": make(map[int32]*cursorOffsetNext)}}
+	resp := kmsg.NewPtrFetchResponse()
+	resp.Version = 12
+	rt := kmsg.NewFetchResponseTopic()
+	rt.Topic = "t"
+	for p := int32(0); p < 3; p++ {
+		c := &cursor{topic: "t", partition: p, source: s}
+		c.leader = 1
+		req.usedOffsets["t"][p] = &cursorOffsetNext{cursorOffset: cursorOffset{offset: 10, lastConsumedEpoch: -1}, from: c}
+		req.numOffsets++
+
+		rp := kmsg.NewFetchResponseTopicPartition()
+		rp.Partition = p
+		if p == 1 {
+			rp.ErrorCode = kerr.NotLeaderForPartition.Code
+		} else {
+			rp.HighWatermark = 12
+			rp.LastStableOffset = 12
+			rp.RecordBatches = testFetchBatch(10, "a", "b")
+		}
+		rt.Partitions = append(rt.Partitions, rp)
+	}
+	resp.Topics = append(resp.Topics, rt)
+
+	// The healthy partitions are returned for buffering immediately, while
+	// the NOT_LEADER partition is stripped and only triggers a metadata
+	// update.
+	f, reload, _, allStripped, updateWhy := s.handleReqResp(br, req, resp)
+	if allStripped {
+		t.Error("all partitions unexpectedly stripped")
+	}
+	if !reload.isEmpty() {
+		t.Errorf("unexpected offset reloads %v", reload)
+	}
+	if len(updateWhy) == 0 || !updateWhy.isOnly(kerr.NotLeaderForPartition) {
+		t.Errorf("update why: got %v, exp only NOT_LEADER_FOR_PARTITION", updateWhy)
+	}
+	if len(f.Topics) != 1 {
+		t.Fatalf("got %d topics != exp 1", len(f.Topics))
+	}
+	ps := f.Topics[0].Partitions
+	if len(ps) != 2 || ps[0].Partition != 0 || ps[1].Partition != 2 {
+		t.Fatalf("got partitions %v, exp only 0 and 2", ps)
+	}
+	for _, p := range ps {
+		if p.Err != nil || len(p.Records) != 2 || p.Records[0].Offset != 10 || string(p.Records[1].Value) != "b" {
+			t.Errorf("partition %d: got err %v and %d records, exp no error and offsets 10 and 11", p.Partition, p.Err, len(p.Records))
+		}
+	}
+	if !f.hasErrorsOrRecords() {
+		t.Error("fetch with records would not be buffered")
+	}
+}
+
+func TestRecordBatchFields(t *testing.T) {
+	cl, err := NewClient(SeedBrokers("127.0.0.1:1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+
+	batch := new(kmsg.RecordBatch)
+	if err := batch.ReadFrom(testFetchBatch(10, "a", "b")); err != nil {
+		t.Fatal(err)
+	}
+	batch.FirstTimestamp, batch.MaxTimestamp = 1000, 2000
+	batch.CRC = int32(crc32.Checksum(batch.AppendTo(nil)[21:], crc32.MakeTable(crc32.Castagnoli)))
+	rp := kmsg.NewFetchResponseTopicPartition()
+	rp.HighWatermark = 12
+	rp.RecordBatches = batch.AppendTo(nil)
+
+	c := &cursor{topic: "t"}
+	o := &cursorOffsetNext{cursorOffset: cursorOffset{offset: 10, lastConsumedEpoch: -1}, from: c}
+	fp := o.processRespPartition(&broker{cl: cl}, &rp, cl.decompressor, cl.cfg.hooks)
+	if fp.Err != nil || len(fp.Records) != 2 {
+		t.Fatalf("got err %v and %d records, exp 2 records", fp.Err, len(fp.Records))
+	}
+	for _, r := range fp.Records {
+		if first, n := r.BatchRange(); first != 10 || n != 2 {
+			t.Errorf("offset %d: got batch range %d, %d, exp 10, 2", r.Offset, first, n)
+		}
+		if ts := r.BatchMaxTimestamp(); !ts.Equal(time.UnixMilli(2000)) {
+			t.Errorf("offset %d: got batch max timestamp %v, exp %v", r.Offset, ts, time.UnixMilli(2000))
+		}
+	}
+
+	var produced Record
+	if first, n := produced.BatchRange(); first != 0 || n != 0 || !produced.BatchMaxTimestamp().IsZero() {
+		t.Error("expected no batch fields on a record that was not consumed")
+	}
+}
+
+func TestRawBatches(t *testing.T) {
+	cl, err := NewClient(SeedBrokers("127.0.0.1:1"), ConsumeRawBatches())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+
+	first, second := testFetchBatch(10, "a", "b"), testFetchBatch(12, "c")
+	rp := kmsg.NewFetchResponseTopicPartition()
+	rp.HighWatermark = 13
+	rp.RecordBatches = append(append([]byte(nil), first...), second...)
+
+	// Asking for offset 11 still returns the whole first batch, and our
+	// next offset advances past both batches.
+	c := &cursor{topic: "t"}
+	o := &cursorOffsetNext{cursorOffset: cursorOffset{offset: 11, lastConsumedEpoch: -1}, from: c}
+	fp := o.processRespPartition(&broker{cl: cl}, &rp, cl.decompressor, cl.cfg.hooks)
+	if fp.Err != nil || len(fp.Records) != 0 || len(fp.RawBatches) != 2 {
+		t.Fatalf("got err %v, %d records, %d raw batches; exp 2 raw batches only", fp.Err, len(fp.Records), len(fp.RawBatches))
+	}
+	if b := fp.RawBatches[0]; b.FirstOffset != 10 || b.NumRecords != 2 || b.NextOffset() != 12 || string(b.Batch) != string(first) {
+		t.Errorf("first batch: got %+v", b.RecordBatchInfo)
+	}
+	if b := fp.RawBatches[1]; b.FirstOffset != 12 || b.NextOffset() != 13 || string(b.Batch) != string(second) {
+		t.Errorf("second batch: got %+v", b.RecordBatchInfo)
+	}
+	if o.offset != 13 {
+		t.Errorf("next offset: got %d != exp 13", o.offset)
+	}
+
+	// Producing rewrites only the producer fields and keeps the records.
+	src := new(kmsg.RecordBatch)
+	if err := src.ReadFrom(first); err != nil {
+		t.Fatal(err)
+	}
+	src.ProducerID, src.ProducerEpoch, src.FirstSequence, src.Attributes = 7, 1, 3, 0b0001_1000
+	src.CRC = int32(crc32.Checksum(src.AppendTo(nil)[21:], crc32.MakeTable(crc32.Castagnoli)))
+	out, err := rawBatchForProduce(src.AppendTo(nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got kmsg.RecordBatch
+	if err := got.ReadFrom(out); err != nil {
+		t.Fatal(err)
+	}
+	if got.FirstOffset != 0 || got.PartitionLeaderEpoch != -1 || got.ProducerID != -1 || got.ProducerEpoch != -1 || got.FirstSequence != -1 || got.Attributes != 0 {
+		t.Errorf("rewritten batch header: got %+v", got)
+	}
+	if crc := int32(crc32.Checksum(out[21:], crc32.MakeTable(crc32.Castagnoli))); crc != got.CRC {
+		t.Errorf("rewritten crc %x != calculated %x", got.CRC, crc)
+	}
+	if string(got.Records) != string(src.Records) || got.NumRecords != 2 {
+		t.Error("rewritten batch lost its records")
+	}
+
+	src.Attributes = 0b0010_0000
+	if _, err := rawBatchForProduce(src.AppendTo(nil)); err == nil {
+		t.Error("control batch was not rejected")
+	}
+	if _, err := rawBatchForProduce(first[:40]); err == nil {
+		t.Error("truncated batch was not rejected")
+	}
+}
+
+func TestFetchRequestStates(t *testing.T) {
+	var b *fakeBroker
+	b = newFakeBroker(t, func(req kmsg.Request) kmsg.Response {
+		meta, ok := req.(*kmsg.MetadataRequest)
+		if !ok {
+			return nil // fetches are left in flight
+		}
+		resp := b.metadata(meta)
+		rt := kmsg.NewMetadataResponseTopic()
+		rt.Topic = kmsg.StringPtr("t")
+		for p := int32(0); p < 2; p++ {
+			rp := kmsg.NewMetadataResponseTopicPartition()
+			rp.Partition = p
+			rp.Replicas = []int32{0}
+			rp.ISR = []int32{0}
+			rt.Partitions = append(rt.Partitions, rp)
+		}
+		resp.Topics = append(resp.Topics, rt)
+		return resp
+	})
+	cl, err := NewClient(SeedBrokers(b.addr()), ConsumePartitions(map[string]map[int32]Offset{
+		"t": {0: NewOffset().At(0), 1: NewOffset().At(0)},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+	defer b.close()
+
+	var states []FetchState
+	for start := time.Now(); time.Since(start) < 5*time.Second; time.Sleep(10 * time.Millisecond) {
+		if states = cl.FetchRequestStates(); len(states) > 0 {
+			break
+		}
+	}
+	if len(states) != 1 {
+		t.Fatalf("got %d fetch states, exp 1", len(states))
+	}
+	s := states[0]
+	if s.Broker != 0 || !s.InFlight || s.InFlightSince.IsZero() || !s.LastResponse.IsZero() {
+		t.Errorf("got %+v, exp an in flight request to broker 0 with no response yet", s)
+	}
+	if exp := map[string][]int32{"t": {0, 1}}; !reflect.DeepEqual(s.Partitions, exp) {
+		t.Errorf("got partitions %v != exp %v", s.Partitions, exp)
+	}
+}
+
+// newRecordsBroker returns a broker that serves topic t with partitions 0 and
+// 1, each holding perPartition records. Records are served two at a time;
+// once everything is consumed, fetches are left in flight.
+func newRecordsBroker(t *testing.T, perPartition int64) *fakeBroker {
+	var b *fakeBroker
+	b = newFakeBroker(t, func(req kmsg.Request) kmsg.Response {
+		switch req := req.(type) {
+		case *kmsg.MetadataRequest:
+			resp := b.metadata(req)
+			rt := kmsg.NewMetadataResponseTopic()
+			rt.Topic = kmsg.StringPtr("t")
+			for p := int32(0); p < 2; p++ {
+				rp := kmsg.NewMetadataResponseTopicPartition()
+				rp.Partition = p
+				rp.Replicas = []int32{0}
+				rp.ISR = []int32{0}
+				rt.Partitions = append(rt.Partitions, rp)
+			}
+			resp.Topics = append(resp.Topics, rt)
+			return resp
+
+		case *kmsg.FetchRequest:
+			resp := req.ResponseKind().(*kmsg.FetchResponse)
+			var any bool
+			for _, rt := range req.Topics {
+				st := kmsg.NewFetchResponseTopic()
+				st.Topic = rt.Topic
+				st.TopicID = rt.TopicID
+				for _, rp := range rt.Partitions {
+					sp := kmsg.NewFetchResponseTopicPartition()
+					sp.Partition = rp.Partition
+					sp.HighWatermark = perPartition
+					if rp.FetchOffset < perPartition {
+						o := rp.FetchOffset
+						sp.RecordBatches = testFetchBatch(o, fmt.Sprint(rp.Partition, o), fmt.Sprint(rp.Partition, o+1))
+						any = true
+					}
+					st.Partitions = append(st.Partitions, sp)
+				}
+				resp.Topics = append(resp.Topics, st)
+			}
+			if !any {
+				return nil // everything is consumed; leave the fetch in flight
+			}
+			return resp
+		}
+		return nil
+	})
+	return b
+}
+
+func TestPollFetchesInto(t *testing.T) {
+	const perPartition = 6
+	b := newRecordsBroker(t, perPartition)
+	defer b.close()
+
+	consume := func(poll func(*Client, context.Context) Fetches) []string {
+		cl, err := NewClient(SeedBrokers(b.addr()), ConsumePartitions(map[string]map[int32]Offset{
+			"t": {0: NewOffset().At(0), 1: NewOffset().At(0)},
+		}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer cl.Close()
+
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		var got []string
+		for len(got) < 2*perPartition {
+			fs := poll(cl, ctx)
+			if ctx.Err() != nil {
+				t.Fatalf("timed out with %d records, exp %d", len(got), 2*perPartition)
+			}
+			fs.EachError(func(_ string, _ int32, err error) { t.Errorf("unexpected fetch error: %v", err) })
+			fs.EachRecord(func(r *Record) {
+				got = append(got, fmt.Sprintf("%s/%d/%d/%s", r.Topic, r.Partition, r.Offset, r.Value))
+			})
+		}
+		sort.Strings(got)
+		return got
+	}
+
+	exp := consume(func(cl *Client, ctx context.Context) Fetches {
+		return cl.PollFetches(ctx)
+	})
+	if len(exp) != 2*perPartition {
+		t.Fatalf("PollFetches: got %d records, exp %d", len(exp), 2*perPartition)
+	}
+
+	// The reused slice starts with a stale fetch that must never be
+	// returned, and with enough capacity that every poll should land in
+	// the same backing array.
+	reuse := make(Fetches, 1, 8)
+	reuse[0] = Fetch{Topics: []FetchTopic{{Topic: "stale"}}}
+	backing := &reuse[:1][0]
+	got := consume(func(cl *Client, ctx context.Context) Fetches {
+		cl.PollFetchesInto(ctx, &reuse)
+		if len(reuse) > 0 && len(reuse) <= 8 && &reuse[0] != backing {
+			t.Error("PollFetchesInto did not reuse the backing array")
+		}
+		for _, f := range reuse {
+			for _, ft := range f.Topics {
+				if ft.Topic == "stale" {
+					t.Error("PollFetchesInto returned a fetch from the prior poll")
+				}
+			}
+		}
+		return reuse
+	})
+	if !reflect.DeepEqual(got, exp) {
+		t.Errorf("PollFetchesInto got %v != PollFetches exp %v", got, exp)
+	}
+}
+
+func TestMaxPollRecords(t *testing.T) {
+	if _, _, _, err := validateCfg(MaxPollRecords(-1)); err == nil {
+		t.Error("expected a negative MaxPollRecords to be invalid")
+	}
+	for _, n := range []int{0, 3} {
+		if _, _, _, err := validateCfg(MaxPollRecords(n)); err != nil {
+			t.Errorf("MaxPollRecords(%d): unexpected error %v", n, err)
+		}
+	}
+
+	const perPartition = 6
+	b := newRecordsBroker(t, perPartition)
+	defer b.close()
+	cl, err := NewClient(SeedBrokers(b.addr()), MaxPollRecords(3), ConsumePartitions(map[string]map[int32]Offset{
+		"t": {0: NewOffset().At(0), 1: NewOffset().At(0)},
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// Each fetch response holds four records (two per partition); wait
+	// for one to be buffered so that the first poll could return more than
+	// the limit.
+	for cl.BufferedFetchRecords() < 4 {
+		if ctx.Err() != nil {
+			t.Fatalf("timed out with %d buffered records", cl.BufferedFetchRecords())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	var total int
+	for total < 2*perPartition {
+		fs := cl.PollFetches(ctx)
+		if ctx.Err() != nil {
+			t.Fatalf("timed out with %d records, exp %d", total, 2*perPartition)
+		}
+		if n := fs.NumRecords(); n > 3 {
+			t.Errorf("poll returned %d records, exp at most 3", n)
+		} else {
+			total += n
+		}
+	}
+	if total != 2*perPartition {
+		t.Errorf("got %d records, exp %d", total, 2*perPartition)
+	}
+}
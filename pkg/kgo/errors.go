@@ -7,6 +7,10 @@ import (
 	"io"
 	"net"
 	"os"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kmsg"
 )
 
 func isRetryableBrokerErr(err error) bool {
@@ -102,6 +106,47 @@ func isContextErr(err error) bool {
 	return errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
 }
 
+// isTransientHeartbeatErr returns whether a heartbeat error is from the
+// transport or from the coordinator moving, rather than an error about our
+// membership itself. Our member is likely still valid broker side for these
+// errors, so there is no need to revoke until the session is at risk.
+func isTransientHeartbeatErr(err error) bool {
+	switch {
+	case err == nil,
+		errors.Is(err, context.Canceled),
+		errors.Is(err, ErrClientClosed),
+		errors.Is(err, kerr.RebalanceInProgress),
+		errors.Is(err, kerr.IllegalGeneration),
+		errors.Is(err, kerr.UnknownMemberID),
+		errors.Is(err, kerr.FencedInstanceID):
+		return false
+	}
+	return kerr.IsRetriable(err) ||
+		isRetryableBrokerErr(err) ||
+		isDialNonTimeoutErr(err) ||
+		errors.Is(err, context.DeadlineExceeded)
+}
+
+// isGroupSessionErr returns whether an error that broke a group session is
+// one that retrying does not fix on its own and is kept for GroupError. This
+// excludes retriable errors, and the membership errors that are part of
+// routinely rejoining a group.
+func isGroupSessionErr(err error) bool {
+	switch {
+	case err == nil,
+		isContextErr(err),
+		errors.Is(err, ErrClientClosed),
+		errors.Is(err, kerr.RebalanceInProgress),
+		errors.Is(err, kerr.IllegalGeneration),
+		errors.Is(err, kerr.UnknownMemberID),
+		errors.Is(err, kerr.MemberIDRequired):
+		return false
+	}
+	return !kerr.IsRetriable(err) &&
+		!isRetryableBrokerErr(err) &&
+		!isAnyDialErr(err)
+}
+
 func isSkippableBrokerErr(err error) bool {
 	// Some broker errors are not retryable for the given broker itself,
 	// but we *could* skip the broker and try again on the next broker. For
@@ -166,6 +211,8 @@ var (
 
 	errNoTopic = errors.New("cannot produce record with no topic and no default topic")
 
+	errNoUsablePartitions = errors.New("unable to partition record due to no usable partitions")
+
 	// Returned for all buffered produce records when a user purges topics.
 	errPurged = errors.New("topic purged while buffered")
 
@@ -204,6 +251,29 @@ var (
 	//
 	// For any request, the request is failed with this error.
 	ErrClientClosed = errors.New("client closed")
+
+	// ErrProducingDisabled fails every produced record if the client was
+	// created with ConsumerOnly.
+	ErrProducingDisabled = errors.New("cannot produce with a consumer only client")
+
+	// ErrConsumingDisabled is returned in a fake fetch from polling if the
+	// client was created with ProducerOnly.
+	ErrConsumingDisabled = errors.New("cannot consume with a producer only client")
+
+	// ErrCommitSuperseded is passed to a commit's onDone function if the
+	// commit was canceled because a newer commit was issued before the
+	// original commit completed. Only the latest commit is allowed to be
+	// in flight, so a slow commit is canceled in favor of a newer one.
+	//
+	// This error wraps context.Canceled, so errors.Is(err,
+	// context.Canceled) continues to be true for superseded commits.
+	//
+	// Commits are not queued: a queued commit would commit offsets that
+	// are already older than the commit behind it, and committing every
+	// intermediate offset only adds load to the group coordinator. If
+	// every commit must complete, wait for each commit's onDone (or use
+	// CommitOffsetsSync) before issuing the next.
+	ErrCommitSuperseded = fmt.Errorf("commit was superseded by a newer commit: %w", context.Canceled)
 )
 
 // ErrFirstReadEOF is returned for responses that immediately error with
@@ -309,7 +379,8 @@ func (e *errUnknownCoordinator) Error() string {
 
 // ErrGroupSession is injected into a poll if an error occurred such that your
 // consumer group member was kicked from the group or was never able to join
-// the group.
+// the group. If the error stopped group management entirely, Err is an
+// *ErrGroupFatal.
 type ErrGroupSession struct {
 	Err error
 }
@@ -319,3 +390,284 @@ func (e *ErrGroupSession) Error() string {
 }
 
 func (e *ErrGroupSession) Unwrap() error { return e.Err }
+
+// GroupStage is a stage of group management, as reported to
+// HookGroupManageErrorStage.
+type GroupStage int8
+
+const (
+	// GroupStageUnknown is the zero GroupStage, reported for errors that
+	// did not occur in any of the stages below, such as a conflict found
+	// with CheckInstanceIDConflict.
+	GroupStageUnknown GroupStage = iota
+	// GroupStageJoin is joining the group (JoinGroup).
+	GroupStageJoin
+	// GroupStageSync is syncing the group (SyncGroup).
+	GroupStageSync
+	// GroupStageHeartbeat is heartbeating once the group is joined.
+	GroupStageHeartbeat
+	// GroupStageFetchOffsets is fetching committed offsets for newly
+	// assigned partitions (OffsetFetch).
+	GroupStageFetchOffsets
+)
+
+func (s GroupStage) String() string {
+	switch s {
+	case GroupStageJoin:
+		return "join"
+	case GroupStageSync:
+		return "sync"
+	case GroupStageHeartbeat:
+		return "heartbeat"
+	case GroupStageFetchOffsets:
+		return "fetch offsets"
+	default:
+		return "unknown"
+	}
+}
+
+// groupManageError tracks the stage of group management that an error occurred
+// in, for HookGroupManageErrorStage. The stage is stripped before the error is
+// passed to the user; see splitGroupManageErr.
+type groupManageError struct {
+	stage GroupStage
+	err   error
+}
+
+func (e *groupManageError) Error() string {
+	return fmt.Sprintf("group %s failed: %v", e.stage, e.err)
+}
+
+func (e *groupManageError) Unwrap() error { return e.err }
+
+// groupManageErr wraps err with the stage it occurred in. Nil errors and
+// context cancelations (from leaving the group or closing the client) are not
+// wrapped.
+func groupManageErr(stage GroupStage, err error) error {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return err
+	}
+	return &groupManageError{stage, err}
+}
+
+// splitGroupManageErr returns the stage err occurred in and the error without
+// the stage wrapping it, which is what the error was before stages were
+// tracked.
+func splitGroupManageErr(err error) (GroupStage, error) {
+	if me, ok := err.(*groupManageError); ok {
+		return me.stage, me.err
+	}
+	return GroupStageUnknown, err
+}
+
+// ErrGroupFatal is returned from FatalGroupError and is injected into a poll
+// (wrapped in ErrGroupSession) if the group management loop stopped because of
+// an error that retrying cannot fix. This client's static instance ID being
+// fenced by another process joining with the same ID (FENCED_INSTANCE_ID) is
+// always fatal. With the StopOnUnrecoverableGroupErrors option, the group
+// being at its max size (GROUP_MAX_SIZE_REACHED) and the client not being
+// authorized to use the group or to fetch offsets for some of the group's
+// topics are fatal as well. Once this is returned, the client no longer tries
+// to join the group; you must fix the cause (ensure only one process uses each
+// instance ID, raise group.max.size, or add the missing ACLs) and create a new
+// client.
+type ErrGroupFatal struct {
+	// Err is the underlying error, e.g. kerr.TopicAuthorizationFailed.
+	Err error
+	// Topics are the topics that failed with Err, if the error was
+	// topic specific.
+	Topics []string
+}
+
+func (e *ErrGroupFatal) Error() string {
+	if len(e.Topics) > 0 {
+		return fmt.Sprintf("fatal group error for topics %v: %v", e.Topics, e.Err)
+	}
+	return fmt.Sprintf("fatal group error: %v", e.Err)
+}
+
+func (e *ErrGroupFatal) Unwrap() error { return e.Err }
+
+// isGroupFatal returns err as an ErrGroupFatal if the error is not retryable
+// in the group management loop, or nil. Max size and group authorization
+// errors are only fatal if stopOnAuth is true (StopOnUnrecoverableGroupErrors).
+// TopicAuthorizationFailed is only fatal when fetching offsets, where
+// fetchOffsets returns it as an ErrGroupFatal directly under the same option.
+func isGroupFatal(err error, stopOnAuth bool) *ErrGroupFatal {
+	var fe *ErrGroupFatal
+	if errors.As(err, &fe) {
+		return fe
+	}
+	if errors.Is(err, kerr.FencedInstanceID) ||
+		stopOnAuth && (errors.Is(err, kerr.GroupMaxSizeReached) ||
+			errors.Is(err, kerr.GroupAuthorizationFailed)) {
+		return &ErrGroupFatal{Err: err}
+	}
+	return nil
+}
+
+// ErrInstanceIDConflict is the error inside an ErrGroupFatal if the
+// CheckInstanceIDConflict option detects that another group member is using
+// this client's instance ID.
+type ErrInstanceIDConflict struct {
+	// InstanceID is the instance ID that is in use by multiple clients.
+	InstanceID string
+	// MemberID is this client's member ID.
+	MemberID string
+	// Members are the members that the broker reports with our instance
+	// ID, with each entry formatted as "member_id client_id client_host".
+	Members []string
+}
+
+func (e *ErrInstanceIDConflict) Error() string {
+	return fmt.Sprintf("instance id %q of member %q is in use by other group members: %v", e.InstanceID, e.MemberID, e.Members)
+}
+
+// ErrPartition is returned from CommitSync and FetchCommittedOffsets if a
+// partition in the response failed. Use errors.Is or errors.As to inspect the
+// underlying kerr error.
+type ErrPartition struct {
+	// Topic and Partition are the first partition that failed.
+	Topic     string
+	Partition int32
+	// Err is the partition's error.
+	Err error
+}
+
+func (e *ErrPartition) Error() string {
+	return fmt.Sprintf("topic %s partition %d: %v", e.Topic, e.Partition, e.Err)
+}
+
+func (e *ErrPartition) Unwrap() error { return e.Err }
+
+// unwrapPartitionErr returns the error inside an ErrPartition, or err itself.
+// CommitRecords and the other commit functions that predate ErrPartition have
+// always returned the partition's kerr error directly, so that it can be
+// compared with ==.
+func unwrapPartitionErr(err error) error {
+	var pe *ErrPartition
+	if errors.As(err, &pe) {
+		return pe.Err
+	}
+	return err
+}
+
+// ErrCommit is returned from CommitError if an offset commit failed, in full
+// or for some partitions.
+type ErrCommit struct {
+	// Err is set if the commit failed for the whole group member rather
+	// than for individual partitions. This is the request error if the
+	// commit was never replied to, or a group error that a partition
+	// failed with: IllegalGeneration, UnknownMemberID,
+	// RebalanceInProgress, FencedInstanceID, StaleMemberEpoch, or
+	// GroupAuthorizationFailed. These errors mean the member cannot
+	// commit anything until it rejoins (or is fixed).
+	Err error
+
+	// Partitions contains every partition that failed and its error,
+	// including partitions that failed with a group error. Errors that
+	// only affect a partition, such as OffsetMetadataTooLarge, are only
+	// found here.
+	Partitions map[string]map[int32]error
+}
+
+func (e *ErrCommit) Error() string {
+	var n int
+	for _, ps := range e.Partitions {
+		n += len(ps)
+	}
+	if e.Err != nil {
+		if n > 0 {
+			return fmt.Sprintf("commit failed for %d partitions: %v", n, e.Err)
+		}
+		return fmt.Sprintf("commit failed: %v", e.Err)
+	}
+	return fmt.Sprintf("commit failed for %d partitions: %v", n, e.Partitions)
+}
+
+// Unwrap returns Err, or if Err is nil, every partition error.
+func (e *ErrCommit) Unwrap() []error {
+	if e.Err != nil {
+		return []error{e.Err}
+	}
+	var errs []error
+	for _, ps := range e.Partitions {
+		for _, err := range ps {
+			errs = append(errs, err)
+		}
+	}
+	return errs
+}
+
+// isGroupCommitErr returns whether a partition commit error is an error for
+// the member as a whole.
+func isGroupCommitErr(err error) bool {
+	return errors.Is(err, kerr.IllegalGeneration) ||
+		errors.Is(err, kerr.UnknownMemberID) ||
+		errors.Is(err, kerr.RebalanceInProgress) ||
+		errors.Is(err, kerr.FencedInstanceID) ||
+		errors.Is(err, kerr.StaleMemberEpoch) ||
+		errors.Is(err, kerr.GroupAuthorizationFailed)
+}
+
+// CommitError returns an *ErrCommit describing every failure in a commit, or
+// nil if the commit succeeded for all partitions. This is meant to be called
+// with the arguments passed to a commit's onDone, so that you do not need to
+// walk the response yourself.
+func CommitError(_ *kmsg.OffsetCommitRequest, resp *kmsg.OffsetCommitResponse, err error) error {
+	if err != nil {
+		return &ErrCommit{Err: err}
+	}
+	if resp == nil {
+		return nil
+	}
+	var ce *ErrCommit
+	for _, t := range resp.Topics {
+		for _, p := range t.Partitions {
+			perr := kerr.ErrorForCode(p.ErrorCode)
+			if perr == nil {
+				continue
+			}
+			if ce == nil {
+				ce = &ErrCommit{Partitions: make(map[string]map[int32]error)}
+			}
+			if ce.Err == nil && isGroupCommitErr(perr) {
+				ce.Err = perr
+			}
+			ps := ce.Partitions[t.Topic]
+			if ps == nil {
+				ps = make(map[int32]error)
+				ce.Partitions[t.Topic] = ps
+			}
+			ps[p.Partition] = perr
+		}
+	}
+	if ce == nil {
+		return nil
+	}
+	return ce
+}
+
+// ErrRetriableErrorBudget is returned for produced records and in fetches when
+// a partition has failed with only retriable errors for longer than allowed by
+// the RetriableErrorBudget option, even after the client escalated by
+// reconnecting and refreshing metadata.
+type ErrRetriableErrorBudget struct {
+	// Topic and Partition are the partition that exhausted its budget.
+	Topic     string
+	Partition int32
+	// Since is when the partition began failing.
+	Since time.Time
+	// Err is the most recent retriable error.
+	Err error
+}
+
+func (e *ErrRetriableErrorBudget) Error() string {
+	return fmt.Sprintf("topic %s partition %d has failed with only retriable errors since %s, latest error: %v",
+		e.Topic, e.Partition, e.Since.Format(time.RFC3339), e.Err)
+}
+
+// Unwrap returns the most recent retriable error. Note that this means
+// kerr.IsRetriable returns true for this error, even though the client is no
+// longer retrying.
+func (e *ErrRetriableErrorBudget) Unwrap() error { return e.Err }
@@ -0,0 +1,249 @@
+package kgo
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kbin"
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kmsg"
+)
+
+// fakeBroker is a minimal single node "cluster" for unit tests that need
+// canned responses rather than a real broker. Every request is passed to
+// handle; if handle returns nil for ApiVersions, Metadata, or FindCoordinator,
+// the broker replies with every version this package supports, or with itself
+// as the only broker and every coordinator. A nil response to any other
+// request leaves the request unanswered.
+//
+// handle is called concurrently from every connection the client opens. It can
+// inject errors by returning a response with an error code, and delays by
+// blocking before returning.
+//
+// Users of this package can test against pkg/kfake, but kgo's own tests cannot
+// import it: kfake is a separate module built on a released kgo.
+type fakeBroker struct {
+	ln     net.Listener
+	handle func(kmsg.Request) kmsg.Response
+
+	mu    sync.Mutex
+	conns []net.Conn
+	wg    sync.WaitGroup
+}
+
+func newFakeBroker(tb testing.TB, handle func(kmsg.Request) kmsg.Response) *fakeBroker {
+	tb.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		tb.Fatal(err)
+	}
+	b := &fakeBroker{ln: ln, handle: handle}
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			b.mu.Lock()
+			b.conns = append(b.conns, conn)
+			b.mu.Unlock()
+			b.wg.Add(1)
+			go func() {
+				defer b.wg.Done()
+				b.serve(conn)
+			}()
+		}
+	}()
+	return b
+}
+
+// addr returns the broker's address, to be used as a seed broker.
+func (b *fakeBroker) addr() string { return b.ln.Addr().String() }
+
+// close stops the broker, closing every connection, and waits for all
+// handlers to return.
+func (b *fakeBroker) close() {
+	b.ln.Close()
+	b.mu.Lock()
+	for _, conn := range b.conns {
+		conn.Close()
+	}
+	b.mu.Unlock()
+	b.wg.Wait()
+}
+
+func (b *fakeBroker) serve(conn net.Conn) {
+	defer conn.Close()
+	for {
+		var size [4]byte
+		if _, err := io.ReadFull(conn, size[:]); err != nil {
+			return
+		}
+		buf := make([]byte, binary.BigEndian.Uint32(size[:]))
+		if _, err := io.ReadFull(conn, buf); err != nil {
+			return
+		}
+
+		r := kbin.Reader{Src: buf}
+		key, version, corr := r.Int16(), r.Int16(), r.Int32()
+		r.NullableString() // client ID
+		req := kmsg.RequestForKey(key)
+		if req == nil {
+			return
+		}
+		req.SetVersion(version)
+		if req.IsFlexible() {
+			kmsg.SkipTags(&r)
+		}
+		if err := req.ReadFrom(r.Src); err != nil {
+			return
+		}
+
+		resp := b.handle(req)
+		if resp == nil {
+			resp = b.defaultResponse(req)
+		}
+		if resp == nil {
+			continue
+		}
+		resp.SetVersion(version)
+
+		out := append(make([]byte, 4, 64), 0, 0, 0, 0)
+		binary.BigEndian.PutUint32(out[4:], uint32(corr))
+		if resp.IsFlexible() && key != kmsg.ApiVersions.Int16() { // ApiVersions responses always use header v0
+			out = append(out, 0)
+		}
+		out = resp.AppendTo(out)
+		binary.BigEndian.PutUint32(out, uint32(len(out)-4))
+		if _, err := conn.Write(out); err != nil {
+			return
+		}
+	}
+}
+
+func (b *fakeBroker) defaultResponse(req kmsg.Request) kmsg.Response {
+	switch req := req.(type) {
+	case *kmsg.ApiVersionsRequest:
+		resp := req.ResponseKind().(*kmsg.ApiVersionsResponse)
+		for key := int16(0); key <= kmsg.MaxKey; key++ {
+			if r := kmsg.RequestForKey(key); r != nil {
+				resp.ApiKeys = append(resp.ApiKeys, kmsg.ApiVersionsResponseApiKey{
+					ApiKey:     key,
+					MaxVersion: r.MaxVersion(),
+				})
+			}
+		}
+		return resp
+	case *kmsg.MetadataRequest:
+		return b.metadata(req)
+	case *kmsg.FindCoordinatorRequest:
+		self := b.metadata(kmsg.NewPtrMetadataRequest()).Brokers[0]
+		resp := req.ResponseKind().(*kmsg.FindCoordinatorResponse)
+		resp.Host, resp.Port = self.Host, self.Port
+		for _, key := range req.CoordinatorKeys {
+			resp.Coordinators = append(resp.Coordinators, kmsg.FindCoordinatorResponseCoordinator{
+				Key:  key,
+				Host: self.Host,
+				Port: self.Port,
+			})
+		}
+		return resp
+	}
+	return nil
+}
+
+// metadata returns a metadata response listing this broker as the only
+// broker and the controller, with no topics.
+func (b *fakeBroker) metadata(req *kmsg.MetadataRequest) *kmsg.MetadataResponse {
+	host, port, _ := net.SplitHostPort(b.addr())
+	p, _ := strconv.Atoi(port)
+	resp := req.ResponseKind().(*kmsg.MetadataResponse)
+	resp.ControllerID = 0
+	resp.Brokers = append(resp.Brokers, kmsg.MetadataResponseBroker{
+		NodeID: 0,
+		Host:   host,
+		Port:   int32(p),
+	})
+	return resp
+}
+
+func TestFakeBroker(t *testing.T) {
+	var (
+		b       *fakeBroker
+		release = make(chan struct{})
+	)
+	b = newFakeBroker(t, func(req kmsg.Request) kmsg.Response {
+		switch req := req.(type) {
+		case *kmsg.HeartbeatRequest:
+			resp := req.ResponseKind().(*kmsg.HeartbeatResponse)
+			resp.ErrorCode = kerr.RebalanceInProgress.Code
+			return resp
+		case *kmsg.LeaveGroupRequest:
+			<-release // a delayed response
+			return req.ResponseKind()
+		}
+		return nil
+	})
+	cl, err := NewClient(SeedBrokers(b.addr()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+	defer b.close()
+	defer close(release)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	// ApiVersions, Metadata, and FindCoordinator are answered by default.
+	meta, err := kmsg.NewPtrMetadataRequest().RequestWith(ctx, cl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(meta.Brokers) != 1 || meta.Brokers[0].NodeID != 0 {
+		t.Errorf("got brokers %v, exp only ourself as node 0", meta.Brokers)
+	}
+	find := kmsg.NewPtrFindCoordinatorRequest()
+	find.CoordinatorKey = "g"
+	if _, err := find.RequestWith(ctx, cl); err != nil {
+		t.Fatal(err)
+	}
+
+	// Anything else is answered by the handler, which can inject errors.
+	hb := kmsg.NewPtrHeartbeatRequest()
+	hb.Group = "g"
+	resp, err := hb.RequestWith(ctx, cl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := kerr.ErrorForCode(resp.ErrorCode); err != kerr.RebalanceInProgress {
+		t.Errorf("got heartbeat err %v, exp REBALANCE_IN_PROGRESS", err)
+	}
+
+	// A handler can delay its response; the request stays in flight.
+	leaveCtx, leaveCancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer leaveCancel()
+	leave := kmsg.NewPtrLeaveGroupRequest()
+	leave.Group = "g"
+	if _, err := leave.RequestWith(leaveCtx, cl); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got leave err %v, exp the delayed response to time out", err)
+	}
+
+	// A nil response to any other request leaves it unanswered.
+	syncReq := kmsg.NewPtrSyncGroupRequest()
+	syncReq.Group = "g"
+	syncCtx, syncCancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer syncCancel()
+	if _, err := syncReq.RequestWith(syncCtx, cl); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("got sync err %v, exp the unanswered request to time out", err)
+	}
+}
@@ -3,6 +3,7 @@ package kgo
 import (
 	"bytes"
 	"fmt"
+	"slices"
 	"sort"
 	"strings"
 
@@ -376,7 +377,7 @@ func (g *groupConsumer) balanceGroup(proto string, members []kmsg.JoinGroupRespo
 			needMeta = true
 			continue
 		}
-		topicPartitionCount[topic] = int32(len(data.load().partitions))
+		topicPartitionCount[topic] = int32(data.load().livePartitions())
 	}
 
 	// If our consumer metadata does not contain all topics, the group is
@@ -467,14 +468,10 @@ func (g *groupConsumer) balanceGroup(proto string, members []kmsg.JoinGroupRespo
 	// If the returned IntoSyncAssignment is a BalancePlan, which it likely
 	// is if the balancer is a ConsumerBalancer, then we can again print
 	// more useful debugging information.
-	var into IntoSyncAssignment
-	if memberBalancerOrErr, ok := memberBalancer.(GroupMemberBalancerOrError); ok {
-		if into, err = memberBalancerOrErr.BalanceOrError(topicPartitionCount); err != nil {
-			g.cl.cfg.logger.Log(LogLevelError, "balance failed", "err", err)
-			return nil, err
-		}
-	} else {
-		into = memberBalancer.Balance(topicPartitionCount)
+	into, err := balanceMembers(memberBalancer, topicPartitionCount)
+	if err != nil {
+		g.cl.cfg.logger.Log(LogLevelError, "balance failed", "err", err)
+		return nil, err
 	}
 
 	if p, ok := into.(*BalancePlan); ok {
@@ -486,6 +483,83 @@ func (g *groupConsumer) balanceGroup(proto string, members []kmsg.JoinGroupRespo
 	return into.IntoSyncAssignment(), nil
 }
 
+// balanceMembers balances with BalanceOrError if the member balancer supports
+// it, and Balance otherwise.
+func balanceMembers(memberBalancer GroupMemberBalancer, topics map[string]int32) (IntoSyncAssignment, error) {
+	if memberBalancerOrErr, ok := memberBalancer.(GroupMemberBalancerOrError); ok {
+		return memberBalancerOrErr.BalanceOrError(topics)
+	}
+	return memberBalancer.Balance(topics), nil
+}
+
+// DryRunMember is a group member to balance in BalanceDryRun.
+type DryRunMember struct {
+	// MemberID is the member's ID, which is what the returned
+	// assignment is keyed by.
+	MemberID string
+	// InstanceID is the member's optional static instance ID.
+	InstanceID *string
+	// Topics are the topics the member is interested in.
+	Topics []string
+	// Owned is the member's current assignment, which sticky balancers
+	// use to keep partitions where they are.
+	Owned map[string][]int32
+	// Generation is the generation the member last had its assignment
+	// in, which sticky balancers use to resolve ownership conflicts.
+	Generation int32
+}
+
+// BalanceDryRun returns what the given balancer would assign to the given
+// members for the given topics and partition counts, without joining a group.
+// The returned map is member ID => topic => partitions; every member is
+// present, even if it is assigned nothing.
+//
+// This uses the same code that the group leader uses, including encoding each
+// member's join metadata and parsing each member's sync assignment, and can be
+// used for capacity planning or to see how a balancer behaves.
+func BalanceDryRun(balancer GroupBalancer, members []DryRunMember, topics map[string]int32) (map[string]map[string][]int32, error) {
+	joinMembers := make([]kmsg.JoinGroupResponseMember, 0, len(members))
+	for _, m := range members {
+		jm := kmsg.NewJoinGroupResponseMember()
+		jm.MemberID = m.MemberID
+		jm.InstanceID = m.InstanceID
+		jm.ProtocolMetadata = balancer.JoinGroupMetadata(m.Topics, m.Owned, m.Generation)
+		joinMembers = append(joinMembers, jm)
+	}
+	sortJoinMembers(joinMembers) // as in balanceGroup
+
+	memberBalancer, _, err := balancer.MemberBalancer(joinMembers)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create group member balancer: %v", err)
+	}
+	into, err := balanceMembers(memberBalancer, topics)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := make(map[string]map[string][]int32, len(members))
+	for _, m := range members {
+		plan[m.MemberID] = make(map[string][]int32)
+	}
+	for _, assignment := range into.IntoSyncAssignment() {
+		assigned, err := balancer.ParseSyncAssignment(assignment.MemberAssignment)
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse assignment for member %s: %v", assignment.MemberID, err)
+		}
+		memberPlan := plan[assignment.MemberID]
+		if memberPlan == nil {
+			memberPlan = make(map[string][]int32)
+			plan[assignment.MemberID] = memberPlan
+		}
+		for topic, partitions := range assigned {
+			if len(partitions) > 0 {
+				memberPlan[topic] = partitions
+			}
+		}
+	}
+	return plan, nil
+}
+
 // helper func; range and roundrobin use v0
 func simpleMemberMetadata(interests []string, generation int32) []byte {
 	meta := kmsg.NewConsumerMemberMetadata()
@@ -721,12 +795,56 @@ func (*rangeBalancer) Balance(b *ConsumerBalancer, topics map[string]int32) Into
 // assigned partitions). This Go sticky balancer is optimal and extra sticky.
 // Thus, the Java balancer will never back out of a strategy from this
 // balancer.
+//
+// To configure the balancer, see NewStickyBalancer.
 func StickyBalancer() GroupBalancer {
-	return &stickyBalancer{cooperative: false}
+	return NewStickyBalancer()
+}
+
+// NewStickyBalancer returns a StickyBalancer configured with the given
+// options.
+func NewStickyBalancer(opts ...StickyBalancerOpt) GroupBalancer {
+	s := &stickyBalancer{cooperative: false}
+	for _, opt := range opts {
+		opt.apply(s)
+	}
+	return s
 }
 
 type stickyBalancer struct {
 	cooperative bool
+	hints       func() map[string][]int32
+}
+
+// StickyBalancerOpt is an option for NewStickyBalancer or
+// NewCooperativeStickyBalancer.
+type StickyBalancerOpt interface {
+	apply(*stickyBalancer)
+}
+
+type stickyBalancerOpt struct{ fn func(*stickyBalancer) }
+
+func (opt stickyBalancerOpt) apply(s *stickyBalancer) { opt.fn(s) }
+
+// StickyPriorAssignment sets a function that returns the partitions this
+// member owned before the process last restarted, which the sticky balancers
+// use as a hint when the member has not yet been assigned anything.
+//
+// A restarted member normally joins with no owned partitions, so the group
+// leader has no record of what the member was consuming and its partitions
+// are free to move to other members. When combined with InstanceID, this
+// option allows a member to advertise its old assignment in the sticky join
+// metadata at the lowest possible generation: the leader will give the
+// partitions back to this member if nobody else is consuming them, which
+// reduces partition movement during rolling deploys. The hint is never used
+// once the member has a real assignment, and partitions actually owned by
+// other members always take priority over the hint.
+//
+// You are responsible for persisting the assignment, for example in
+// OnPartitionsAssigned, OnPartitionsRevoked, and OnPartitionsLost. Only hinted
+// topics that the member is interested in are advertised.
+func StickyPriorAssignment(fn func() map[string][]int32) StickyBalancerOpt {
+	return stickyBalancerOpt{func(s *stickyBalancer) { s.hints = fn }}
 }
 
 func (s *stickyBalancer) ProtocolName() string {
@@ -743,6 +861,14 @@ func (s *stickyBalancer) JoinGroupMetadata(interests []string, currentAssignment
 	meta.Generation = generation
 	stickyMeta := kmsg.NewStickyMemberMetadata()
 	stickyMeta.Generation = generation
+	if len(currentAssignment) == 0 && generation < 0 && s.hints != nil {
+		for topic, partitions := range s.stickyHints(interests) {
+			stickyAssn := kmsg.NewStickyMemberMetadataCurrentAssignment()
+			stickyAssn.Topic = topic
+			stickyAssn.Partitions = partitions
+			stickyMeta.CurrentAssignment = append(stickyMeta.CurrentAssignment, stickyAssn)
+		}
+	}
 	for topic, partitions := range currentAssignment {
 		if s.cooperative {
 			metaPart := kmsg.NewConsumerMemberMetadataOwnedPartition()
@@ -766,6 +892,25 @@ func (s *stickyBalancer) JoinGroupMetadata(interests []string, currentAssignment
 	return meta.AppendTo(nil)
 }
 
+// stickyHints returns the hinted prior assignment for interested topics, with
+// partitions sorted and deduplicated.
+func (s *stickyBalancer) stickyHints(interests []string) map[string][]int32 {
+	hints := make(map[string][]int32)
+	for topic, partitions := range s.hints() {
+		if len(partitions) == 0 {
+			continue
+		}
+		if idx := sort.SearchStrings(interests, topic); idx == len(interests) || interests[idx] != topic {
+			continue // interests are sorted
+		}
+		ps := append([]int32(nil), partitions...)
+		sort.Slice(ps, func(i, j int) bool { return ps[i] < ps[j] })
+		ps = slices.Compact(ps)
+		hints[topic] = ps
+	}
+	return hints
+}
+
 func (*stickyBalancer) ParseSyncAssignment(assignment []byte) (map[string][]int32, error) {
 	return ParseConsumerSyncAssignment(assignment)
 }
@@ -826,8 +971,33 @@ func (s *stickyBalancer) Balance(b *ConsumerBalancer, topics map[string]int32) I
 // continue to be eager and give up all of their partitions every rebalance.
 // However, once a member only has cooperative-sticky, it can begin using this
 // new strategy and things will work correctly. See KIP-429 for more details.
+//
+// Balancing is the same as StickyBalancer: stickiness never wins over
+// balance. If every member consumes the same topics, the final counts always
+// differ by at most one, and only partitions over a member's target count
+// move. Because partitions cannot move directly between members, an
+// imbalanced group converges in two rounds: the first revokes partitions from
+// overloaded members (leaving counts such as 11/9/9 briefly), and the rejoin
+// that follows assigns them (11/10/10). If counts stay imbalanced across many
+// rebalances, a member is not rejoining after revoking.
+//
+// Plans are deterministic: members are ordered by instance ID and then member
+// ID before balancing, and that order breaks ties, so identical inputs always
+// produce identical plans.
+//
+// To configure the balancer, see NewCooperativeStickyBalancer.
 func CooperativeStickyBalancer() GroupBalancer {
-	return &stickyBalancer{cooperative: true}
+	return NewCooperativeStickyBalancer()
+}
+
+// NewCooperativeStickyBalancer returns a CooperativeStickyBalancer configured
+// with the given options.
+func NewCooperativeStickyBalancer(opts ...StickyBalancerOpt) GroupBalancer {
+	s := &stickyBalancer{cooperative: true}
+	for _, opt := range opts {
+		opt.apply(s)
+	}
+	return s
 }
 
 // AdjustCooperative performs the final adjustment to a plan for cooperative
@@ -1,7 +1,10 @@
 package kgo
 
 import (
+	"fmt"
+	"math/rand"
 	"reflect"
+	"sort"
 	"testing"
 
 	"github.com/twmb/franz-go/pkg/kmsg"
@@ -113,3 +116,390 @@ func TestNewConsumerBalancerIssue493(t *testing.T) {
 		t.Errorf("got unexpected error: %v", err)
 	}
 }
+
+func TestMemberMetadataWithRack(t *testing.T) {
+	for _, b := range []GroupBalancer{
+		RoundRobinBalancer(),
+		RangeBalancer(),
+		StickyBalancer(),
+		CooperativeStickyBalancer(),
+	} {
+		orig := b.JoinGroupMetadata([]string{"t"}, map[string][]int32{"t": {0}}, 3)
+		if got := memberMetadataWithRack(orig, ""); !reflect.DeepEqual(got, orig) {
+			t.Errorf("%s: metadata changed with an empty rack", b.ProtocolName())
+		}
+
+		var meta kmsg.ConsumerMemberMetadata
+		if err := meta.ReadFrom(memberMetadataWithRack(orig, "r1")); err != nil {
+			t.Fatalf("%s: unable to read metadata: %v", b.ProtocolName(), err)
+		}
+		if meta.Rack == nil || *meta.Rack != "r1" {
+			t.Errorf("%s: got rack %v, exp r1", b.ProtocolName(), meta.Rack)
+		}
+		if meta.Generation != 3 || !reflect.DeepEqual(meta.Topics, []string{"t"}) {
+			t.Errorf("%s: rack rewrite lost fields: %+v", b.ProtocolName(), meta)
+		}
+	}
+}
+
+func simpleBalancerMember(id string, topics ...string) kmsg.JoinGroupResponseMember {
+	meta := kmsg.NewConsumerMemberMetadata()
+	meta.Topics = topics
+	m := kmsg.NewJoinGroupResponseMember()
+	m.MemberID = id
+	m.ProtocolMetadata = meta.AppendTo(nil)
+	return m
+}
+
+type simpleBalancerTest struct {
+	name    string
+	members []kmsg.JoinGroupResponseMember
+	topics  map[string]int32
+	exp     map[string]map[string][]int32
+}
+
+func runSimpleBalancerTests(t *testing.T, balancer GroupBalancer, tests []simpleBalancerTest) {
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			members := append([]kmsg.JoinGroupResponseMember(nil), test.members...)
+			sortJoinMembers(members) // as in balanceGroup
+			b, _, err := balancer.MemberBalancer(members)
+			if err != nil {
+				t.Fatalf("unable to create balancer: %v", err)
+			}
+			into, err := b.(GroupMemberBalancerOrError).BalanceOrError(test.topics)
+			if err != nil {
+				t.Fatalf("unable to balance: %v", err)
+			}
+			got := into.(*BalancePlan).AsMemberIDMap()
+			for member, topics := range got {
+				if len(topics) == 0 {
+					delete(got, member)
+				}
+			}
+			if !reflect.DeepEqual(got, test.exp) {
+				t.Errorf("got %v != exp %v", got, test.exp)
+			}
+		})
+	}
+}
+
+// These mirror the Java client's RangeAssignorTest.
+func TestRangeBalancer(t *testing.T) {
+	member := simpleBalancerMember
+	runSimpleBalancerTests(t, RangeBalancer(), []simpleBalancerTest{
+		{
+			name:    "one consumer, one topic",
+			members: []kmsg.JoinGroupResponseMember{member("c1", "t1")},
+			topics:  map[string]int32{"t1": 3},
+			exp:     map[string]map[string][]int32{"c1": {"t1": {0, 1, 2}}},
+		},
+		{
+			name:    "two consumers, one topic, three partitions",
+			members: []kmsg.JoinGroupResponseMember{member("c2", "t1"), member("c1", "t1")},
+			topics:  map[string]int32{"t1": 3},
+			exp: map[string]map[string][]int32{
+				"c1": {"t1": {0, 1}},
+				"c2": {"t1": {2}},
+			},
+		},
+		{
+			name:    "two consumers, two topics, six partitions",
+			members: []kmsg.JoinGroupResponseMember{member("c1", "t1", "t2"), member("c2", "t1", "t2")},
+			topics:  map[string]int32{"t1": 3, "t2": 3},
+			exp: map[string]map[string][]int32{
+				"c1": {"t1": {0, 1}, "t2": {0, 1}},
+				"c2": {"t1": {2}, "t2": {2}},
+			},
+		},
+		{
+			name: "mixed topics",
+			members: []kmsg.JoinGroupResponseMember{
+				member("c1", "t1"),
+				member("c2", "t1", "t2"),
+				member("c3", "t1"),
+			},
+			topics: map[string]int32{"t1": 3, "t2": 2},
+			exp: map[string]map[string][]int32{
+				"c1": {"t1": {0}},
+				"c2": {"t1": {1}, "t2": {0, 1}},
+				"c3": {"t1": {2}},
+			},
+		},
+		{
+			name:    "more consumers than partitions",
+			members: []kmsg.JoinGroupResponseMember{member("c1", "t1"), member("c2", "t1")},
+			topics:  map[string]int32{"t1": 1},
+			exp:     map[string]map[string][]int32{"c1": {"t1": {0}}},
+		},
+	})
+}
+
+// These mirror the Java client's RoundRobinAssignorTest.
+func TestRoundRobinBalancer(t *testing.T) {
+	member := simpleBalancerMember
+	runSimpleBalancerTests(t, RoundRobinBalancer(), []simpleBalancerTest{
+		{
+			name:    "two consumers, one topic, three partitions",
+			members: []kmsg.JoinGroupResponseMember{member("c2", "t1"), member("c1", "t1")},
+			topics:  map[string]int32{"t1": 3},
+			exp: map[string]map[string][]int32{
+				"c1": {"t1": {0, 2}},
+				"c2": {"t1": {1}},
+			},
+		},
+		{
+			name:    "two consumers, two topics, six partitions",
+			members: []kmsg.JoinGroupResponseMember{member("c1", "t1", "t2"), member("c2", "t1", "t2")},
+			topics:  map[string]int32{"t1": 3, "t2": 3},
+			exp: map[string]map[string][]int32{
+				"c1": {"t1": {0, 2}, "t2": {1}},
+				"c2": {"t1": {1}, "t2": {0, 2}},
+			},
+		},
+		{
+			name: "mixed topics",
+			members: []kmsg.JoinGroupResponseMember{
+				member("c1", "t1"),
+				member("c2", "t1", "t2"),
+				member("c3", "t1"),
+			},
+			topics: map[string]int32{"t1": 3, "t2": 2},
+			exp: map[string]map[string][]int32{
+				"c1": {"t1": {0}},
+				"c2": {"t1": {1}, "t2": {0, 1}},
+				"c3": {"t1": {2}},
+			},
+		},
+		{
+			name: "only subscribed topics",
+			members: []kmsg.JoinGroupResponseMember{
+				member("c1", "t1"),
+			},
+			topics: map[string]int32{"t1": 3, "other": 3},
+			exp:    map[string]map[string][]int32{"c1": {"t1": {0, 1, 2}}},
+		},
+	})
+}
+
+func TestBalanceDryRun(t *testing.T) {
+	members := []DryRunMember{
+		{MemberID: "c2", Topics: []string{"t1"}},
+		{MemberID: "c1", Topics: []string{"t1"}},
+		{MemberID: "c3", Topics: []string{"t2"}},
+	}
+	topics := map[string]int32{"t1": 3, "t2": 0}
+
+	got, err := BalanceDryRun(RangeBalancer(), members, topics)
+	if err != nil {
+		t.Fatalf("unable to dry run: %v", err)
+	}
+	exp := map[string]map[string][]int32{
+		"c1": {"t1": {0, 1}},
+		"c2": {"t1": {2}},
+		"c3": {},
+	}
+	if !reflect.DeepEqual(got, exp) {
+		t.Errorf("got %v != exp %v", got, exp)
+	}
+
+	// A cooperative sticky dry run keeps owned partitions in place.
+	members[0].Owned = map[string][]int32{"t1": {0, 1, 2}}
+	members[0].Generation = 1
+	got, err = BalanceDryRun(CooperativeStickyBalancer(), members, topics)
+	if err != nil {
+		t.Fatalf("unable to dry run: %v", err)
+	}
+	if n := len(got["c2"]["t1"]); n < 1 {
+		t.Errorf("c2 lost all owned partitions: %v", got)
+	}
+}
+
+// The unconfigured sticky constructors keep their original signatures so that
+// they can still be used as values.
+var (
+	_ func() GroupBalancer = StickyBalancer
+	_ func() GroupBalancer = CooperativeStickyBalancer
+)
+
+func TestStickyPriorAssignmentRestart(t *testing.T) {
+	topics := map[string]int32{"t": 6}
+	prior := map[string]map[string][]int32{
+		"a": {"t": {0, 1}},
+		"b": {"t": {4, 5}},
+		"c": {"t": {2, 3}},
+	}
+
+	// "a" stayed up at generation 5, while "b" and "c" restarted and
+	// rejoined as static members with nothing owned.
+	balance := func(hinted bool) map[string]map[string][]int32 {
+		var members []kmsg.JoinGroupResponseMember
+		for _, id := range []string{"a", "b", "c"} {
+			owned, gen := prior[id], int32(5)
+			b := CooperativeStickyBalancer()
+			if id != "a" {
+				owned, gen = nil, -1
+				if hinted {
+					hint := prior[id]
+					b = NewCooperativeStickyBalancer(StickyPriorAssignment(func() map[string][]int32 { return hint }))
+				}
+			}
+			m := kmsg.NewJoinGroupResponseMember()
+			m.MemberID = id
+			m.ProtocolMetadata = b.JoinGroupMetadata([]string{"t"}, owned, gen)
+			members = append(members, m)
+		}
+		b := CooperativeStickyBalancer()
+		mb, _, err := b.MemberBalancer(members)
+		if err != nil {
+			t.Fatal(err)
+		}
+		into, err := balanceMembers(mb, topics)
+		if err != nil {
+			t.Fatal(err)
+		}
+		plan := make(map[string]map[string][]int32)
+		for _, assignment := range into.IntoSyncAssignment() {
+			assigned, err := b.ParseSyncAssignment(assignment.MemberAssignment)
+			if err != nil {
+				t.Fatal(err)
+			}
+			plan[assignment.MemberID] = assigned
+		}
+		return plan
+	}
+
+	if got := balance(true); !reflect.DeepEqual(got, prior) {
+		t.Errorf("hinted restart: got %v, exp %v", got, prior)
+	}
+	if got := balance(false); reflect.DeepEqual(got, prior) {
+		t.Log("unhinted restart happened to keep the prior assignment")
+	}
+
+	// Hints for topics we are not interested in are not advertised, and
+	// hints are ignored once we own something.
+	b := NewStickyBalancer(StickyPriorAssignment(func() map[string][]int32 {
+		return map[string][]int32{"t": {1, 0, 1}, "other": {0}}
+	}))
+	for _, test := range []struct {
+		owned map[string][]int32
+		gen   int32
+		exp   []int32
+	}{
+		{nil, -1, []int32{0, 1}},
+		{map[string][]int32{"t": {3}}, 2, []int32{3}},
+	} {
+		var meta kmsg.ConsumerMemberMetadata
+		if err := meta.ReadFrom(b.JoinGroupMetadata([]string{"t"}, test.owned, test.gen)); err != nil {
+			t.Fatal(err)
+		}
+		var sticky kmsg.StickyMemberMetadata
+		if err := sticky.ReadFrom(meta.UserData); err != nil {
+			t.Fatal(err)
+		}
+		if len(sticky.CurrentAssignment) != 1 || sticky.CurrentAssignment[0].Topic != "t" || !reflect.DeepEqual(sticky.CurrentAssignment[0].Partitions, test.exp) {
+			t.Errorf("gen %d: got %+v, exp t => %v", test.gen, sticky.CurrentAssignment, test.exp)
+		}
+	}
+}
+
+// TestCooperativeStickyProperties checks, over random prior assignments where
+// every member consumes the same topic, that cooperative-sticky balancing
+//
+//   - is deterministic regardless of the order members are given in,
+//   - converges within two rounds to counts differing by at most one, and
+//   - moves the minimum number of partitions necessary to do so.
+func TestCooperativeStickyProperties(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for iter := 0; iter < 200; iter++ {
+		nmembers := 2 + rng.Intn(7)
+		nparts := 1 + rng.Intn(100)
+
+		// Randomly (and likely unevenly) distribute partitions, leaving
+		// some unowned.
+		prior := make(map[string]string) // "t/p" => member
+		owned := make(map[string][]int32)
+		for p := int32(0); p < int32(nparts); p++ {
+			n := rng.Intn(nmembers + 1)
+			if n == nmembers {
+				continue
+			}
+			id := fmt.Sprintf("m%d", n)
+			prior[fmt.Sprint(p)] = id
+			owned[id] = append(owned[id], p)
+		}
+
+		members := make([]DryRunMember, 0, nmembers)
+		for i := 0; i < nmembers; i++ {
+			id := fmt.Sprintf("m%d", i)
+			members = append(members, DryRunMember{
+				MemberID:   id,
+				Topics:     []string{"t"},
+				Owned:      map[string][]int32{"t": owned[id]},
+				Generation: 1,
+			})
+		}
+		topics := map[string]int32{"t": int32(nparts)}
+
+		balance := func(members []DryRunMember) map[string]map[string][]int32 {
+			plan, err := BalanceDryRun(CooperativeStickyBalancer(), members, topics)
+			if err != nil {
+				t.Fatalf("iter %d: %v", iter, err)
+			}
+			return plan
+		}
+
+		// Round one: revocations only; round two: assign what was revoked.
+		plan := balance(members)
+		shuffled := append([]DryRunMember(nil), members...)
+		rng.Shuffle(len(shuffled), func(i, j int) { shuffled[i], shuffled[j] = shuffled[j], shuffled[i] })
+		if again := balance(shuffled); !reflect.DeepEqual(plan, again) {
+			t.Fatalf("iter %d: balancing is not deterministic: %v != %v", iter, plan, again)
+		}
+		for i := range members {
+			members[i].Owned = plan[members[i].MemberID]
+			members[i].Generation = 2
+		}
+		plan = balance(members)
+
+		var counts []int
+		var moved int
+		for id, assigned := range plan {
+			counts = append(counts, len(assigned["t"]))
+			for _, p := range assigned["t"] {
+				if was, ok := prior[fmt.Sprint(p)]; ok && was != id {
+					moved++
+				}
+			}
+		}
+		sort.Ints(counts)
+		if len(counts) != nmembers {
+			counts = append(make([]int, nmembers-len(counts)), counts...)
+		}
+		if counts[len(counts)-1]-counts[0] > 1 {
+			t.Errorf("iter %d: imbalanced counts %v", iter, counts)
+		}
+
+		// The minimum movement gives the (nparts % nmembers) members
+		// that own the most one more than the rest, and moves
+		// everything over that target.
+		var priorCounts []int
+		for i := 0; i < nmembers; i++ {
+			priorCounts = append(priorCounts, len(owned[fmt.Sprintf("m%d", i)]))
+		}
+		sort.Sort(sort.Reverse(sort.IntSlice(priorCounts)))
+		var minMoved int
+		for i, c := range priorCounts {
+			target := nparts / nmembers
+			if i < nparts%nmembers {
+				target++
+			}
+			if c > target {
+				minMoved += c - target
+			}
+		}
+		if moved != minMoved {
+			t.Errorf("iter %d: moved %d partitions, minimum is %d", iter, moved, minMoved)
+		}
+	}
+}
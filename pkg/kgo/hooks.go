@@ -203,6 +203,97 @@ type HookGroupManageError interface {
 	OnGroupManageError(error)
 }
 
+// HookGroupManageErrorStage is called alongside HookGroupManageError with the
+// stage of group management that the error occurred in, which distinguishes,
+// for example, an UNKNOWN_MEMBER_ID while heartbeating from one while syncing.
+type HookGroupManageErrorStage interface {
+	// OnGroupManageErrorStage is passed the stage that failed and the
+	// same error that is passed to OnGroupManageError.
+	OnGroupManageErrorStage(GroupStage, error)
+}
+
+// HookGroupCommitSuperseded is called whenever an in-flight commit is
+// canceled because a newer commit was issued. The canceled commit's onDone is
+// called with ErrCommitSuperseded.
+type HookGroupCommitSuperseded interface {
+	// OnGroupCommitSuperseded is passed the group and the total number of
+	// commits that have been superseded in the life of the client,
+	// including this one.
+	OnGroupCommitSuperseded(group string, superseded int64)
+}
+
+// HookRetriableErrorBudget is called when a partition has failed producing or
+// fetching with only retriable errors for longer than the RetriableErrorBudget.
+// This is called once when the client escalates (exhausted is false) and once
+// more if the client stops retrying internally (exhausted is true).
+type HookRetriableErrorBudget interface {
+	// OnRetriableErrorBudget is passed the partition and the most
+	// recent retriable errors for it, oldest first.
+	OnRetriableErrorBudget(topic string, partition int32, exhausted bool, errs []error)
+}
+
+// HookTopicPartitionsUpdated is called when a metadata update changes the
+// number of partitions in a topic being produced to or consumed from. The
+// initial metadata load of a topic is not reported, nor are loads that fail
+// for the whole topic: a topic that is briefly missing from metadata keeps
+// its prior partitions and is not reported as shrinking to zero.
+//
+// This is called within the metadata update, immediately after the update is
+// stored. Producers that partition by key can use this to flush or re-key
+// once the new partitions exist. This hook must not block for long, since it
+// blocks the metadata update.
+type HookTopicPartitionsUpdated interface {
+	// OnTopicPartitionsUpdated is passed the topic, whether the update is
+	// for producing (false means consuming), and the prior and current
+	// number of partitions.
+	OnTopicPartitionsUpdated(topic string, isProduce bool, prior, current int32)
+}
+
+// TransactionSummary describes a transaction that was ended with an EndTxn
+// request; see HookTransactionEnd.
+type TransactionSummary struct {
+	// TransactionalID is the client's transactional ID.
+	TransactionalID string
+	// ProducerID and ProducerEpoch are the producer ID and epoch that the
+	// transaction was ended with.
+	ProducerID    int64
+	ProducerEpoch int16
+
+	// Commit is whether the transaction was ended with a commit (true) or
+	// an abort (false). If Err is non-nil, the outcome of the EndTxn
+	// request is unknown.
+	Commit bool
+	// Err is the error from ending the transaction, if any.
+	Err error
+	// AbortReason, if non-empty, is why a transaction that was intended
+	// to be committed in a GroupTransactSession was aborted instead.
+	AbortReason string
+
+	// Partitions are the partitions that were produced to in the
+	// transaction.
+	Partitions map[string][]int32
+	// Records is the number of records that were successfully produced
+	// in the transaction. If the transaction is aborted, these records
+	// are not visible to read committed consumers.
+	Records int64
+	// OffsetsGroup is the group whose offsets were committed as a part of
+	// the transaction, or empty if no offsets were committed.
+	OffsetsGroup string
+
+	// Duration is how long the transaction was open, from beginning the
+	// transaction to the end of the EndTxn request.
+	Duration time.Duration
+}
+
+// HookTransactionEnd is called after every EndTxn request, i.e. whenever a
+// transaction that contained produced records or committed offsets is ended.
+// This is called with the transactional state of the client locked; it is
+// invalid to begin or end transactions in this hook.
+type HookTransactionEnd interface {
+	// OnTransactionEnd is passed a summary of the ended transaction.
+	OnTransactionEnd(TransactionSummary)
+}
+
 ///////////////////////////////
 // PRODUCE & CONSUME BATCHES //
 ///////////////////////////////
@@ -407,6 +498,11 @@ func implementsAnyHook(h Hook) bool {
 		HookBrokerE2E,
 		HookBrokerThrottle,
 		HookGroupManageError,
+		HookGroupManageErrorStage,
+		HookGroupCommitSuperseded,
+		HookTransactionEnd,
+		HookRetriableErrorBudget,
+		HookTopicPartitionsUpdated,
 		HookProduceBatchWritten,
 		HookFetchBatchRead,
 		HookProduceRecordBuffered,
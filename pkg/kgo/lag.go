@@ -0,0 +1,178 @@
+package kgo
+
+import (
+	"context"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kmsg"
+)
+
+// PartitionLag is the lag for a single partition, as returned from Lag.
+type PartitionLag struct {
+	// Offset is the input offset that lag was calculated against.
+	Offset int64
+
+	// End is the end offset of the partition: the high watermark, or the
+	// last stable offset if the client is consuming with the
+	// ReadCommitted isolation level.
+	End int64
+
+	// Lag is End minus Offset, or End if Offset is negative. Lag is never
+	// negative.
+	Lag int64
+
+	// FromFetch is true if End was the most recent end offset seen in a
+	// fetch response, rather than from a ListOffsets request.
+	FromFetch bool
+
+	// EndAge is how long ago End was seen in a fetch response. This is
+	// zero if FromFetch is false, in which case End was loaded just now.
+	EndAge time.Duration
+
+	// Err is non-nil if the end offset could not be loaded for this
+	// partition. If Err is non-nil, End and Lag are -1.
+	Err error
+}
+
+// Lag returns the lag of the input offsets against the end offsets of each
+// partition, for example to export the lag of committed offsets.
+//
+// If the client is actively consuming a partition, the end offset is taken
+// from the most recent fetch response for that partition as long as that
+// response was seen within maxAge. All other partitions have their end offsets
+// loaded with a single (sharded) ListOffsets request. Each partition in the
+// return indicates where its end offset came from and how old it is, so that
+// you can decide whether the lag is current enough. A maxAge of zero always
+// issues ListOffsets.
+//
+// The end offset is the high watermark, or the last stable offset if the
+// client is consuming with the ReadCommitted isolation level. This returns an
+// error only if the ListOffsets request itself fails; per-partition errors are
+// returned in each PartitionLag.
+func (cl *Client) Lag(ctx context.Context, offsets map[string]map[int32]int64, maxAge time.Duration) (map[string]map[int32]PartitionLag, error) {
+	lags, list := cl.observedLags(offsets, maxAge)
+	if len(list) == 0 {
+		return lags, nil
+	}
+
+	req := kmsg.NewPtrListOffsetsRequest()
+	req.ReplicaID = -1
+	req.IsolationLevel = cl.cfg.isolationLevel
+	for topic, ps := range list {
+		rt := kmsg.NewListOffsetsRequestTopic()
+		rt.Topic = topic
+		for _, p := range ps {
+			rp := kmsg.NewListOffsetsRequestTopicPartition()
+			rp.Partition = p
+			rp.CurrentLeaderEpoch = -1
+			rp.Timestamp = -1 // latest
+			rt.Partitions = append(rt.Partitions, rp)
+		}
+		req.Topics = append(req.Topics, rt)
+	}
+	resp, err := req.RequestWith(ctx, cl)
+	if err != nil {
+		return nil, err
+	}
+	listedLags(lags, offsets, list, resp)
+	return lags, nil
+}
+
+// observedLags returns the lag of every partition whose end offset was seen
+// in a fetch response within maxAge, and the partitions that need their end
+// offsets listed.
+func (cl *Client) observedLags(offsets map[string]map[int32]int64, maxAge time.Duration) (map[string]map[int32]PartitionLag, map[string][]int32) {
+	var (
+		now  = monoNow()
+		lags = make(map[string]map[int32]PartitionLag, len(offsets))
+		list = make(map[string][]int32)
+	)
+	for topic, ps := range offsets {
+		tlags := make(map[int32]PartitionLag, len(ps))
+		lags[topic] = tlags
+		for p, offset := range ps {
+			if c := cl.consumedCursor(topic, p); c != nil && maxAge > 0 {
+				if at := c.observedEndAt.Load(); at > 0 {
+					if age := time.Duration(now - at); age <= maxAge {
+						tlags[p] = newPartitionLag(offset, c.observedEnd.Load(), true, age)
+						continue
+					}
+				}
+			}
+			list[topic] = append(list[topic], p)
+		}
+	}
+	return lags, list
+}
+
+// listedLags fills in lags for the listed partitions from a ListOffsets
+// response.
+func listedLags(lags map[string]map[int32]PartitionLag, offsets map[string]map[int32]int64, list map[string][]int32, resp *kmsg.ListOffsetsResponse) {
+	for _, rt := range resp.Topics {
+		tlags := lags[rt.Topic]
+		if tlags == nil {
+			continue
+		}
+		for _, rp := range rt.Partitions {
+			offset, ok := offsets[rt.Topic][rp.Partition]
+			if !ok {
+				continue
+			}
+			if err := kerr.ErrorForCode(rp.ErrorCode); err != nil {
+				tlags[rp.Partition] = PartitionLag{Offset: offset, End: -1, Lag: -1, Err: err}
+				continue
+			}
+			tlags[rp.Partition] = newPartitionLag(offset, rp.Offset, false, 0)
+		}
+	}
+
+	// Any partition missing from the response (which should not happen)
+	// is marked as unknown.
+	for topic, ps := range list {
+		for _, p := range ps {
+			if _, ok := lags[topic][p]; !ok {
+				lags[topic][p] = PartitionLag{Offset: offsets[topic][p], End: -1, Lag: -1, Err: kerr.UnknownTopicOrPartition}
+			}
+		}
+	}
+}
+
+func newPartitionLag(offset, end int64, fromFetch bool, age time.Duration) PartitionLag {
+	lag := end
+	if offset >= 0 {
+		lag = end - offset
+	}
+	if lag < 0 {
+		lag = 0
+	}
+	return PartitionLag{
+		Offset:    offset,
+		End:       end,
+		Lag:       lag,
+		FromFetch: fromFetch,
+		EndAge:    age,
+	}
+}
+
+// consumedCursor returns the cursor for a partition being consumed, or nil.
+func (cl *Client) consumedCursor(topic string, partition int32) *cursor {
+	var tps *topicsPartitions
+	if cl.consumer.g != nil {
+		tps = cl.consumer.g.tps
+	} else if cl.consumer.d != nil {
+		tps = cl.consumer.d.tps
+	}
+	if tps == nil {
+		return nil
+	}
+	t := tps.load()[topic]
+	if t == nil {
+		return nil
+	}
+	tv := t.load()
+	if partition < 0 || int(partition) >= len(tv.partitions) {
+		return nil
+	}
+	return tv.partitions[partition].cursor
+}
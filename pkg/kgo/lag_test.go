@@ -0,0 +1,90 @@
+package kgo
+
+import (
+	"errors"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kmsg"
+)
+
+func TestLagObservedAndListed(t *testing.T) {
+	cl, err := NewClient(SeedBrokers("127.0.0.1:1"), ConsumeTopics("t"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+
+	// Partition 0 saw its end offset just now, partition 1 a minute ago,
+	// and partition 2 has not been fetched.
+	tps := cl.consumer.d.tps
+	tps.storeTopics([]string{"t"})
+	d := &topicPartitionsData{topic: "t"}
+	for p := int32(0); p < 3; p++ {
+		d.partitions = append(d.partitions, &topicPartition{cursor: &cursor{topic: "t", partition: p}})
+	}
+	d.partitions[0].cursor.observedEnd.Store(100)
+	d.partitions[0].cursor.observedEndAt.Store(monoNow())
+	d.partitions[1].cursor.observedEnd.Store(100)
+	d.partitions[1].cursor.observedEndAt.Store(monoNow() - int64(time.Minute))
+	tps.load()["t"].v.Store(d)
+
+	offsets := map[string]map[int32]int64{
+		"t": {0: 40, 1: 40, 2: -1, 3: 10},
+		"u": {0: 5},
+	}
+
+	lags, list := cl.observedLags(offsets, 10*time.Second)
+	l := lags["t"][0]
+	if !l.FromFetch || l.End != 100 || l.Lag != 60 || l.EndAge > 10*time.Second {
+		t.Errorf("partition 0: got %+v, exp a lag of 60 from a recent fetch", l)
+	}
+	for _, ps := range list {
+		slices.Sort(ps)
+	}
+	if exp := map[string][]int32{"t": {1, 2, 3}, "u": {0}}; !reflect.DeepEqual(list, exp) {
+		t.Errorf("got partitions to list %v, exp %v", list, exp)
+	}
+
+	// With no max age, every partition is listed.
+	if _, list := cl.observedLags(offsets, 0); len(list["t"]) != 4 {
+		t.Errorf("with no max age, got partitions to list %v, exp all of t", list)
+	}
+
+	resp := kmsg.NewPtrListOffsetsResponse()
+	rt := kmsg.NewListOffsetsResponseTopic()
+	rt.Topic = "t"
+	for _, p := range []struct {
+		p   int32
+		end int64
+		err int16
+	}{
+		{1, 50, 0},
+		{2, 30, 0},
+		{3, -1, kerr.NotLeaderForPartition.Code},
+	} {
+		rp := kmsg.NewListOffsetsResponseTopicPartition()
+		rp.Partition = p.p
+		rp.Offset = p.end
+		rp.ErrorCode = p.err
+		rt.Partitions = append(rt.Partitions, rp)
+	}
+	resp.Topics = append(resp.Topics, rt)
+	listedLags(lags, offsets, list, resp)
+
+	if exp := (PartitionLag{Offset: 40, End: 50, Lag: 10}); lags["t"][1] != exp {
+		t.Errorf("partition 1: got %+v, exp %+v", lags["t"][1], exp)
+	}
+	if exp := (PartitionLag{Offset: -1, End: 30, Lag: 30}); lags["t"][2] != exp {
+		t.Errorf("partition 2: got %+v, exp %+v", lags["t"][2], exp)
+	}
+	if l := lags["t"][3]; !errors.Is(l.Err, kerr.NotLeaderForPartition) || l.End != -1 || l.Lag != -1 {
+		t.Errorf("partition 3: got %+v, exp the partition error", l)
+	}
+	if l := lags["u"][0]; !errors.Is(l.Err, kerr.UnknownTopicOrPartition) {
+		t.Errorf("missing partition: got %+v, exp UnknownTopicOrPartition", l)
+	}
+}
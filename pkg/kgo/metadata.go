@@ -46,25 +46,9 @@ func (cl *Client) PartitionLeader(topic string, partition int32) (leader, leader
 		return -1, -1, errors.New("invalid negative partition")
 	}
 
-	var t *topicPartitions
-
-	m := cl.producer.topics.load()
-	if len(m) > 0 {
-		t = m[topic]
-	}
+	t := cl.loadedTopic(topic)
 	if t == nil {
-		if cl.consumer.g != nil {
-			if m = cl.consumer.g.tps.load(); len(m) > 0 {
-				t = m[topic]
-			}
-		} else if cl.consumer.d != nil {
-			if m = cl.consumer.d.tps.load(); len(m) > 0 {
-				t = m[topic]
-			}
-		}
-		if t == nil {
-			return -1, -1, nil
-		}
+		return -1, -1, nil
 	}
 
 	tv := t.load()
@@ -75,6 +59,55 @@ func (cl *Client) PartitionLeader(topic string, partition int32) (leader, leader
 	return p.leader, p.leaderEpoch, p.loadErr
 }
 
+// TopicLeaderRacks returns a map of each partition in the topic to the rack of
+// the partition's current leader. Partitions whose leader is unknown, or whose
+// leader broker does not advertise a rack, are not included in the map. This
+// returns nil if the topic has not been loaded, i.e. if the topic is not being
+// produced to or consumed from.
+//
+// The returned map is built from the client's most recent metadata and is
+// always current as of the call: as leaders move, subsequent calls reflect the
+// new leaders. This can be used alongside the client's Rack option to prefer
+// producing to topics or partitions whose leaders are in the local rack.
+func (cl *Client) TopicLeaderRacks(topic string) map[int32]string {
+	t := cl.loadedTopic(topic)
+	if t == nil {
+		return nil
+	}
+	tv := t.load()
+
+	cl.brokersMu.RLock()
+	racks := make(map[int32]string, len(cl.brokers))
+	for _, b := range cl.brokers {
+		if b.meta.Rack != nil {
+			racks[b.meta.NodeID] = *b.meta.Rack
+		}
+	}
+	cl.brokersMu.RUnlock()
+
+	leaderRacks := make(map[int32]string, len(tv.partitions))
+	for i, p := range tv.partitions {
+		if rack, ok := racks[p.leader]; ok {
+			leaderRacks[int32(i)] = rack
+		}
+	}
+	return leaderRacks
+}
+
+// loadedTopic returns the topic's partitions from the producer, or from the
+// consumer if the producer does not have the topic, or nil.
+func (cl *Client) loadedTopic(topic string) *topicPartitions {
+	if t := cl.producer.topics.load()[topic]; t != nil {
+		return t
+	}
+	if cl.consumer.g != nil {
+		return cl.consumer.g.tps.load()[topic]
+	} else if cl.consumer.d != nil {
+		return cl.consumer.d.tps.load()[topic]
+	}
+	return nil
+}
+
 // waitmeta returns immediately if metadata was updated within the last second,
 // otherwise this waits for up to wait for a metadata update to complete.
 func (cl *Client) waitmeta(ctx context.Context, wait time.Duration, why string) {
@@ -368,10 +401,16 @@ func (cl *Client) updateMetadata() (retryWhy multiUpdateWhy, err error) {
 		// testing locally) Kafka can originally broadcast a newly
 		// created topic exists and then fail to broadcast that info
 		// again for a while.
+		//
+		// Purging removes the topic from what the group is using and
+		// rejoins (so that the leader can rebalance away the dead
+		// partitions, whether or not we are the leader), drops the
+		// topic's uncommitted offsets, and clears the regex evaluation
+		// of the topic so that a recreated topic is matched again.
 		var purgeTopics []string
 		for topic, tps := range tpsConsumerLoad {
 			if _, ok := latest[topic]; !ok {
-				if td := tps.load(); td.when != 0 && time.Since(time.Unix(td.when, 0)) > cl.cfg.missingTopicDelete {
+				if td := tps.load(); td.when != 0 && monoSince(td.when) > cl.cfg.missingTopicDelete {
 					purgeTopics = append(purgeTopics, td.topic)
 				} else {
 					retryWhy.add(topic, -1, errMissingTopic)
@@ -383,7 +422,7 @@ func (cl *Client) updateMetadata() (retryWhy multiUpdateWhy, err error) {
 			// metadata fn; this will wait for our current
 			// execution to finish then purge.
 			cl.cfg.logger.Log(LogLevelInfo, "regex consumer purging topics that were previously consumed because they are missing in a metadata response, we are assuming they are deleted", "topics", purgeTopics)
-			go cl.PurgeTopicsFromClient(purgeTopics...)
+			go cl.purgeTopicsFromClient(purgeTopics, true)
 		}
 	}
 
@@ -427,7 +466,7 @@ func (cl *Client) updateMetadata() (retryWhy multiUpdateWhy, err error) {
 		var bumpFail []string
 		for _, tps := range missingProduceTopics {
 			if all {
-				if td := tps.load(); td.when != 0 && time.Since(time.Unix(td.when, 0)) > cl.cfg.missingTopicDelete {
+				if td := tps.load(); td.when != 0 && monoSince(td.when) > cl.cfg.missingTopicDelete {
 					bumpFail = append(bumpFail, td.topic)
 				} else {
 					retryWhy.add(td.topic, -1, errMissingTopic)
@@ -471,7 +510,7 @@ func (mt *metadataTopic) newPartitions(cl *Client, isProduce bool) *topicPartiti
 		partitions:         make([]*topicPartition, 0, n),
 		writablePartitions: make([]*topicPartition, 0, n),
 		topic:              mt.topic,
-		when:               time.Now().Unix(),
+		when:               monoNow(),
 	}
 	for i := range mt.partitions {
 		p := mt.partitions[i].newPartition(cl, isProduce)
@@ -660,13 +699,31 @@ func (cl *Client) mergeTopicPartitions(
 
 	// Producers must store the update through a special function that
 	// manages unknown topic waiting, whereas consumers can just simply
-	// store the update.
-	if isProduce {
-		hadPartitions := len(lv.partitions) != 0
-		defer func() { cl.storePartitionsUpdate(topic, l, &lv, hadPartitions) }()
-	} else {
-		defer l.v.Store(&lv)
-	}
+	// store the update. After storing, we let hooks know if the number
+	// of partitions changed.
+	//
+	// A load error keeps our stale partitions, so we only compare
+	// against the count from the last successful load and only report
+	// successful loads: a topic briefly missing while metadata
+	// propagates should not be reported as N => 0 => N.
+	hadPartitions := len(lv.partitions) != 0
+	prior := lv
+	prior.loadErr = nil
+	priorPartitions := prior.livePartitions()
+	defer func() {
+		if isProduce {
+			cl.storePartitionsUpdate(topic, l, &lv, hadPartitions)
+		} else {
+			l.v.Store(&lv)
+		}
+		if current := lv.livePartitions(); hadPartitions && r.loadErr == nil && current != priorPartitions {
+			cl.cfg.hooks.each(func(h Hook) {
+				if h, ok := h.(HookTopicPartitionsUpdated); ok {
+					h.OnTopicPartitionsUpdated(topic, isProduce, int32(priorPartitions), int32(current))
+				}
+			})
+		}
+	}()
 
 	lv.loadErr = r.loadErr
 	lv.isInternal = r.isInternal
@@ -0,0 +1,28 @@
+package kgo
+
+import "time"
+
+// monoEpoch is the reference point for monoNow. Because it is from time.Now,
+// it carries a monotonic clock reading, and durations since it are immune to
+// the wall clock being stepped (NTP, manual changes, VM migration, ...).
+var monoEpoch = time.Now()
+
+// monoNow returns a monotonic timestamp in nanoseconds that can be stored in
+// an atomic, unlike time.Now().UnixNano(), which is a wall clock reading and
+// jumps when the system clock is stepped. A stepped clock previously could
+// make throttles sleep far longer than the broker asked, or make connections
+// appear idle early. The result is always positive so that zero can be used
+// to mean unset.
+func monoNow() int64 {
+	return int64(time.Since(monoEpoch)) + 1
+}
+
+// monoSince returns the time elapsed since a monoNow timestamp.
+func monoSince(mono int64) time.Duration {
+	return time.Duration(monoNow() - mono)
+}
+
+// monoUntil returns the time until a monoNow timestamp.
+func monoUntil(mono int64) time.Duration {
+	return time.Duration(mono - monoNow())
+}
@@ -72,6 +72,61 @@ type TopicBackupIter interface {
 	Rem() int
 }
 
+// TopicLoadPartitioner is an optional extension interface to TopicPartitioner
+// that can partition by per-partition load signals. This is a superset of
+// TopicBackupPartitioner: in addition to the number of buffered records, the
+// load includes the buffered bytes, whether the partition's leader has been
+// responding successfully, and the recent produce ack latency.
+//
+// If a partitioner implements this interface, neither Partition nor
+// PartitionByBackup will be called.
+type TopicLoadPartitioner interface {
+	TopicPartitioner
+
+	// PartitionByLoad is similar to Partition, but has an additional
+	// loadIter. This iterator will return the load per partition index.
+	// The iterator's Next function can only be called up to n times,
+	// calling it any more will panic.
+	PartitionByLoad(r *Record, n int, loadIter TopicLoadIter) int
+}
+
+// TopicLoadIter iterates through partition indices.
+type TopicLoadIter interface {
+	// Next returns the next partition index and the load for the
+	// partition. If Rem returns 0, calling this function again will
+	// panic.
+	Next() (int, PartitionLoad)
+	// Rem returns the number of elements left to iterate through.
+	Rem() int
+}
+
+// PartitionLoad contains signals about how loaded a partition is from the
+// perspective of the producer. All fields are read atomically and
+// independently, meaning the load is a best effort snapshot.
+type PartitionLoad struct {
+	// BufferedRecords is the number of records currently buffered for
+	// the partition, including records that are in flight.
+	BufferedRecords int64
+
+	// BufferedBytes is the number of bytes currently buffered for the
+	// partition, including records that are in flight. This uses the same
+	// sizing as MaxBufferedBytes.
+	BufferedBytes int64
+
+	// LeaderHealthy is false if the most recent produce request for this
+	// partition failed, either because the request itself could not be
+	// issued or because the leader replied with a retryable error. This is
+	// true until a request for the partition fails, and is reset to true
+	// once a produce to the partition succeeds.
+	LeaderHealthy bool
+
+	// AckLatency is an exponentially weighted moving average of how long
+	// produce requests containing this partition took from being issued to
+	// being acknowledged. This is zero until the first successful produce
+	// to the partition.
+	AckLatency time.Duration
+}
+
 ////////////
 // SIMPLE // - BasicConsistent, Manual, RoundRobin
 ////////////
@@ -208,6 +263,19 @@ func (i *leastBackupInput) Rem() int {
 	return len(i.mapping)
 }
 
+type partitionLoadInput struct{ mapping []*topicPartition }
+
+func (i *partitionLoadInput) Next() (int, PartitionLoad) {
+	last := len(i.mapping) - 1
+	load := i.mapping[last].records.load()
+	i.mapping = i.mapping[:last]
+	return last, load
+}
+
+func (i *partitionLoadInput) Rem() int {
+	return len(i.mapping)
+}
+
 func (*leastBackupPartitioner) ForTopic(string) TopicPartitioner {
 	return &leastBackupTopicPartitioner{
 		onPart: -1,
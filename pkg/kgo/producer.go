@@ -5,6 +5,7 @@ import (
 	"errors"
 	"fmt"
 	"math"
+	"sort"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -78,6 +79,14 @@ type producer struct {
 	// EndAndBegin; if nothing more was produced to, we ensure we finish
 	// the started txn.
 	readded bool
+
+	// Bookkeeping for the current transaction, reported in
+	// HookTransactionEnd. txnStart and txnAbortReason are protected by
+	// txnMu; txnRecords is incremented as records are successfully
+	// produced.
+	txnStart       time.Time
+	txnRecords     atomicI64
+	txnAbortReason string
 }
 
 // BufferedProduceRecords returns the number of records currently buffered for
@@ -103,8 +112,9 @@ func (cl *Client) BufferedProduceBytes() int64 {
 
 type unknownTopicProduces struct {
 	buffered []promisedRec
-	wait     chan error // retryable errors
-	fatal    chan error // must-signal quit errors; capacity 1
+	together map[int]int // index in buffered => number of records produced together
+	wait     chan error  // retryable errors
+	fatal    chan error  // must-signal quit errors; capacity 1
 }
 
 func (p *producer) init(cl *Client) {
@@ -265,6 +275,115 @@ func (cl *Client) ProduceSync(ctx context.Context, rs ...*Record) ProduceResults
 	return results
 }
 
+// ProduceTogether produces all records to the same partition, back to back,
+// calling promise for each record once it is produced or fails. All records
+// must be for the same topic. The partition is chosen once by the topic's
+// partitioner using the first record, and every record is produced to that
+// partition regardless of its key. This can be used to keep a burst of
+// related records with different keys in order, without manually
+// partitioning.
+//
+// The records are buffered together without any other record in between,
+// and if they fit within ProducerBatchMaxBytes, they are produced in a single
+// batch. If they do not fit, they are split into consecutive batches for the
+// same partition.
+//
+// If any record fails before it is buffered -- for example, because the
+// records are for different topics, a record is too large
+// (kerr.MessageTooLarge), the records together exceed the maximum buffered
+// records or bytes (ErrMaxBuffered), the topic's partitions cannot be loaded,
+// or the context is canceled while waiting for buffer space -- every record
+// is failed with that same error and none are produced. Once buffered, the
+// records are treated the same as records from Produce: if they span multiple
+// batches, one batch may fail while another succeeds.
+//
+// As with Produce, if the topic's partitions are not yet known, the records
+// are held until a metadata load learns them, and this blocks while the
+// client has the maximum number of records or bytes buffered, unless the
+// client is configured with ManualFlushing. If the topic's partitioner
+// implements TopicPartitionerOnNewBatch, it is consulted as with Produce.
+func (cl *Client) ProduceTogether(
+	ctx context.Context,
+	rs []*Record,
+	promise func(*Record, error),
+) {
+	if len(rs) == 0 {
+		return
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	if promise == nil {
+		promise = noPromise
+	}
+
+	p := &cl.producer
+	prs := make([]promisedRec, 0, len(rs))
+	var (
+		size     int64
+		tooLarge bool
+	)
+	for _, r := range rs {
+		if r.Context == nil {
+			r.Context = ctx
+		}
+		if r.Topic == "" {
+			r.Topic = cl.cfg.defaultProduceTopic
+		}
+		if p.hooks != nil && len(p.hooks.buffered) > 0 {
+			for _, h := range p.hooks.buffered {
+				h.OnProduceRecordBuffered(r)
+			}
+		}
+		userSize := r.userSize()
+		size += userSize
+		tooLarge = tooLarge || cl.cfg.maxBufferedBytes > 0 && userSize > cl.cfg.maxBufferedBytes
+		prs = append(prs, promisedRec{ctx, promise, r})
+	}
+
+	failBeforeBuf := func(err error) {
+		p.promiseBatch(batchPromise{recs: prs, beforeBuf: true, err: err})
+	}
+	topic := rs[0].Topic
+	switch {
+	case cl.cfg.consumerOnly:
+		failBeforeBuf(ErrProducingDisabled)
+		return
+	case topic == "":
+		failBeforeBuf(errNoTopic)
+		return
+	case cl.cfg.txnID != nil && !p.producingTxn.Load():
+		failBeforeBuf(errNotInTransaction)
+		return
+	case tooLarge:
+		failBeforeBuf(kerr.MessageTooLarge)
+		return
+	case int64(len(rs)) > cl.cfg.maxBufferedRecords,
+		cl.cfg.maxBufferedBytes > 0 && size > cl.cfg.maxBufferedBytes:
+		failBeforeBuf(ErrMaxBuffered)
+		return
+	}
+	for _, r := range rs[1:] {
+		if r.Topic != topic {
+			failBeforeBuf(fmt.Errorf("cannot produce records together to different topics %q and %q", topic, r.Topic))
+			return
+		}
+	}
+
+	if err := cl.reserveBuffered(ctx, int64(len(rs)), size, true); err != nil {
+		failBeforeBuf(err)
+		return
+	}
+
+	// Past this point, the records are accounted for as buffered and
+	// failing them releases that space.
+	parts, partsData := cl.partitionsForTopicProduce(prs)
+	if parts == nil { // saved in unknownTopics
+		return
+	}
+	cl.doPartitionRecords(parts, partsData, prs)
+}
+
 // FirstErrPromise is a helper type to capture only the first failing error
 // when producing a batch of records with this type's Promise function.
 //
@@ -406,6 +525,10 @@ func (cl *Client) produce(
 	}
 
 	// We can now fail the rec after the buffered hook.
+	if cl.cfg.consumerOnly {
+		p.promiseRecordBeforeBuf(promisedRec{ctx, promise, r}, ErrProducingDisabled)
+		return
+	}
 	if r.Topic == "" {
 		p.promiseRecordBeforeBuf(promisedRec{ctx, promise, r}, errNoTopic)
 		return
@@ -421,7 +544,21 @@ func (cl *Client) produce(
 		return
 	}
 
-	// We have to grab the produce lock to check if this record will exceed
+	if err := cl.reserveBuffered(ctx, 1, userSize, block); err != nil {
+		p.promiseRecordBeforeBuf(promisedRec{ctx, promise, r}, err)
+		return
+	}
+
+	cl.partitionRecord(promisedRec{ctx, promise, r})
+}
+
+// reserveBuffered accounts for nrecs records of size bytes being buffered,
+// blocking until there is space if block is true and the client is not
+// manually flushing. If this returns an error, nothing was reserved.
+func (cl *Client) reserveBuffered(ctx context.Context, nrecs, size int64, block bool) error {
+	p := &cl.producer
+
+	// We have to grab the produce lock to check if these records will exceed
 	// configured limits. We try to keep the logic tight since this is
 	// effectively a global lock around producing.
 	var (
@@ -429,8 +566,8 @@ func (cl *Client) produce(
 		overMaxRecs, overMaxBytes bool
 
 		calcNums = func() {
-			nextBufRecs = p.bufferedRecords + 1
-			nextBufBytes = p.bufferedBytes + userSize
+			nextBufRecs = p.bufferedRecords + nrecs
+			nextBufBytes = p.bufferedBytes + size
 			overMaxRecs = nextBufRecs > cl.cfg.maxBufferedRecords
 			overMaxBytes = cl.cfg.maxBufferedBytes > 0 && nextBufBytes > cl.cfg.maxBufferedBytes
 		}
@@ -440,8 +577,7 @@ func (cl *Client) produce(
 	if overMaxRecs || overMaxBytes {
 		if !block || cl.cfg.manualFlushing {
 			p.mu.Unlock()
-			p.promiseRecordBeforeBuf(promisedRec{ctx, promise, r}, ErrMaxBuffered)
-			return
+			return ErrMaxBuffered
 		}
 
 		// Before we potentially unlinger, add that we are blocked to
@@ -450,7 +586,7 @@ func (cl *Client) produce(
 		// also used when finishing promises to see if we need to be
 		// notified.
 		p.blocked.Add(1)
-		p.blockedBytes += userSize
+		p.blockedBytes += size
 		p.mu.Unlock()
 
 		cl.cfg.logger.Log(LogLevelDebug, "blocking Produce because we are either over max buffered records or max buffered bytes",
@@ -476,10 +612,10 @@ func (cl *Client) produce(
 				calcNums()
 			}
 			p.blocked.Add(-1)
-			p.blockedBytes -= userSize
+			p.blockedBytes -= size
 		}()
 
-		drainBuffered := func(err error) {
+		drainBuffered := func(err error) error {
 			// The expected case here is that a context was
 			// canceled while we we waiting for space, so we are
 			// exiting and need to kill the goro above.
@@ -498,27 +634,25 @@ func (cl *Client) produce(
 			}()
 			<-wait // we wait for the goroutine to exit, then unlock again (since the goroutine leaves the mutex locked)
 			p.mu.Unlock()
-			p.promiseRecordBeforeBuf(promisedRec{ctx, promise, r}, err)
+			return err
 		}
 
 		select {
 		case <-wait:
 			cl.cfg.logger.Log(LogLevelDebug, "Produce block awoken, we now have space to produce, continuing to partition and produce")
 		case <-cl.ctx.Done():
-			drainBuffered(ErrClientClosed)
 			cl.cfg.logger.Log(LogLevelDebug, "client ctx canceled while blocked in Produce, returning")
-			return
+			return drainBuffered(ErrClientClosed)
 		case <-ctx.Done():
-			drainBuffered(ctx.Err())
 			cl.cfg.logger.Log(LogLevelDebug, "produce ctx canceled while blocked in Produce, returning")
-			return
+			return drainBuffered(ctx.Err())
 		}
 	}
 	p.bufferedRecords = nextBufRecs
 	p.bufferedBytes = nextBufBytes
 	p.mu.Unlock()
+	return nil
 
-	cl.partitionRecord(promisedRec{ctx, promise, r})
 }
 
 type batchPromise struct {
@@ -551,9 +685,19 @@ func (p *producer) finishPromises(b batchPromise) {
 	var more bool
 start:
 	p.promisesMu.Lock()
+	if cl.cfg.txnID != nil && b.err == nil {
+		p.txnRecords.Add(int64(len(b.recs)))
+	}
+	var advanced string // topic, if this batch advanced the partition's acked offset
+	if fn := cl.cfg.onOffsetAdvanced; fn != nil && b.err == nil && b.baseOffset >= 0 && len(b.recs) > 0 {
+		advanced = b.recs[0].Topic
+	}
 	for i, pr := range b.recs {
 		pr.LeaderEpoch = 0
 		pr.Offset = b.baseOffset + int64(i)
+		if b.baseOffset < 0 {
+			pr.Offset = -1 // unknown, e.g. an old duplicate sequence number response
+		}
 		pr.Partition = b.partition
 		pr.ProducerID = b.pid
 		pr.ProducerEpoch = b.epoch
@@ -562,6 +706,9 @@ start:
 		b.recs[i] = promisedRec{}
 	}
 	p.promisesMu.Unlock()
+	if advanced != "" {
+		cl.cfg.onOffsetAdvanced(advanced, b.partition, b.baseOffset+int64(len(b.recs)))
+	}
 	if cap(b.recs) > 4 {
 		cl.prsPool.put(b.recs)
 	}
@@ -611,7 +758,7 @@ func (cl *Client) finishRecordPromise(pr promisedRec, err error, beforeBuffering
 // the topic does not currently exist, the record is buffered in unknownTopics
 // for a metadata update to deal with.
 func (cl *Client) partitionRecord(pr promisedRec) {
-	parts, partsData := cl.partitionsForTopicProduce(pr)
+	parts, partsData := cl.partitionsForTopicProduce([]promisedRec{pr})
 	if parts == nil { // saved in unknownTopics
 		return
 	}
@@ -628,30 +775,14 @@ func (cl *Client) doPartitionRecord(parts *topicPartitions, partsData *topicPart
 
 	parts.partsMu.Lock()
 	defer parts.partsMu.Unlock()
-	if parts.partitioner == nil {
-		parts.partitioner = cl.cfg.partitioner.ForTopic(pr.Topic)
-	}
 
-	mapping := partsData.writablePartitions
-	if parts.partitioner.RequiresConsistency(pr.Record) {
-		mapping = partsData.partitions
-	}
+	mapping := cl.lockedPartitionMapping(parts, partsData, pr.Record)
 	if len(mapping) == 0 {
-		cl.producer.promiseRecord(pr, errors.New("unable to partition record due to no usable partitions"))
+		cl.producer.promiseRecord(pr, errNoUsablePartitions)
 		return
 	}
 
-	var pick int
-	tlp, _ := parts.partitioner.(TopicBackupPartitioner)
-	if tlp != nil {
-		if parts.lb == nil {
-			parts.lb = new(leastBackupInput)
-		}
-		parts.lb.mapping = mapping
-		pick = tlp.PartitionByBackup(pr.Record, len(mapping), parts.lb)
-	} else {
-		pick = parts.partitioner.Partition(pr.Record, len(mapping))
-	}
+	pick := parts.lockedPick(mapping, pr.Record)
 	if pick < 0 || pick >= len(mapping) {
 		cl.producer.promiseRecord(pr, fmt.Errorf("invalid record partitioning choice of %d from %d available", pick, len(mapping)))
 		return
@@ -665,12 +796,7 @@ func (cl *Client) doPartitionRecord(parts *topicPartitions, partsData *topicPart
 	if !processed {
 		onNewBatch.OnNewBatch()
 
-		if tlp != nil {
-			parts.lb.mapping = mapping
-			pick = tlp.PartitionByBackup(pr.Record, len(mapping), parts.lb)
-		} else {
-			pick = parts.partitioner.Partition(pr.Record, len(mapping))
-		}
+		pick = parts.lockedPick(mapping, pr.Record)
 
 		if pick < 0 || pick >= len(mapping) {
 			cl.producer.promiseRecord(pr, fmt.Errorf("invalid record partitioning choice of %d from %d available", pick, len(mapping)))
@@ -681,6 +807,84 @@ func (cl *Client) doPartitionRecord(parts *topicPartitions, partsData *topicPart
 	}
 }
 
+// doPartitionRecords is doPartitionRecord for records produced together: the
+// partitioner picks one partition using the first record, and every record is
+// buffered to that partition back to back.
+func (cl *Client) doPartitionRecords(parts *topicPartitions, partsData *topicPartitionsData, prs []promisedRec) {
+	if partsData.loadErr != nil && !kerr.IsRetriable(partsData.loadErr) {
+		cl.producer.promiseBatch(batchPromise{recs: prs, err: partsData.loadErr})
+		return
+	}
+
+	parts.partsMu.Lock()
+	defer parts.partsMu.Unlock()
+
+	r := prs[0].Record
+	mapping := cl.lockedPartitionMapping(parts, partsData, r)
+	if len(mapping) == 0 {
+		cl.producer.promiseBatch(batchPromise{recs: prs, err: errNoUsablePartitions})
+		return
+	}
+
+	pick := parts.lockedPick(mapping, r)
+	if pick < 0 || pick >= len(mapping) {
+		cl.producer.promiseBatch(batchPromise{recs: prs, err: fmt.Errorf("invalid record partitioning choice of %d from %d available", pick, len(mapping))})
+		return
+	}
+
+	partition := mapping[pick]
+
+	onNewBatch, _ := parts.partitioner.(TopicPartitionerOnNewBatch)
+	abortOnNewBatch := onNewBatch != nil
+	processed := partition.records.bufferRecords(prs, abortOnNewBatch) // KIP-480
+	if !processed {
+		onNewBatch.OnNewBatch()
+
+		pick = parts.lockedPick(mapping, r)
+
+		if pick < 0 || pick >= len(mapping) {
+			cl.producer.promiseBatch(batchPromise{recs: prs, err: fmt.Errorf("invalid record partitioning choice of %d from %d available", pick, len(mapping))})
+			return
+		}
+		partition = mapping[pick]
+		partition.records.bufferRecords(prs, false) // KIP-480
+	}
+}
+
+// lockedPartitionMapping returns the partitions a record can be produced to,
+// initializing the topic's partitioner if necessary. This must be called with
+// partsMu held.
+func (cl *Client) lockedPartitionMapping(parts *topicPartitions, partsData *topicPartitionsData, r *Record) []*topicPartition {
+	if parts.partitioner == nil {
+		parts.partitioner = cl.cfg.partitioner.ForTopic(r.Topic)
+	}
+	if parts.partitioner.RequiresConsistency(r) {
+		return partsData.partitions
+	}
+	return partsData.writablePartitions
+}
+
+// lockedPick returns the index into mapping that the topic's partitioner
+// chooses for a record. This must be called with partsMu held.
+func (parts *topicPartitions) lockedPick(mapping []*topicPartition, r *Record) int {
+	switch p := parts.partitioner.(type) {
+	case TopicLoadPartitioner:
+		if parts.ld == nil {
+			parts.ld = new(partitionLoadInput)
+		}
+		parts.ld.mapping = mapping
+		return p.PartitionByLoad(r, len(mapping), parts.ld)
+	case TopicBackupPartitioner:
+		if parts.lb == nil {
+			parts.lb = new(leastBackupInput)
+		}
+		parts.lb.mapping = mapping
+		return p.PartitionByBackup(r, len(mapping), parts.lb)
+	default:
+		return p.Partition(r, len(mapping))
+	}
+}
+
 // ProducerID returns, loading if necessary, the current producer ID and epoch.
 // This returns an error if the producer ID could not be loaded, if the
 // producer ID has fatally errored, or if the context is canceled.
@@ -706,6 +910,106 @@ func (cl *Client) ProducerID(ctx context.Context) (int64, int16, error) {
 	}
 }
 
+// ProducePartitionState is a snapshot of the client's idempotent produce
+// bookkeeping for a partition, as returned from ProducePartitionStates. This
+// is meant for debugging sequence number errors.
+type ProducePartitionState struct {
+	// Partition is the partition this state is for.
+	Partition int32
+	// ProducerID and ProducerEpoch are the producer ID and epoch the
+	// client is currently using, or -1 if none are loaded.
+	ProducerID    int64
+	ProducerEpoch int16
+	// NextSequence is the sequence number of the next batch to be sent.
+	NextSequence int32
+	// FirstUnackedSequence is the sequence number of the oldest batch
+	// that has not yet been acked.
+	FirstUnackedSequence int32
+	// LastAckedOffset is one past the offset of the last acked record,
+	// or -1 if nothing has been acked.
+	LastAckedOffset int64
+	// InflightRequests is the number of produce requests in flight that
+	// contain a batch for this partition.
+	InflightRequests int
+	// BufferedBatches and BufferedRecords are the number of batches and
+	// records buffered for the partition, including those in flight.
+	BufferedBatches int
+	BufferedRecords int64
+}
+
+// ProducePartitionStates returns the produce bookkeeping for every partition
+// of the topic that the client has produced to, sorted by partition. This
+// returns nil if the client has not produced to the topic.
+//
+// Each partition is read under that partition's lock only, which briefly
+// contends with producing to that partition.
+func (cl *Client) ProducePartitionStates(topic string) []ProducePartitionState {
+	tps := cl.producer.topics.load()[topic]
+	if tps == nil {
+		return nil
+	}
+	id, epoch := int64(-1), int16(-1)
+	if pid := cl.producer.id.Load().(*producerID); pid.err == nil {
+		id, epoch = pid.id, pid.epoch
+	}
+
+	parts := tps.load().partitions
+	states := make([]ProducePartitionState, 0, len(parts))
+	for _, tp := range parts {
+		recBuf := tp.records
+		recBuf.mu.Lock()
+		states = append(states, ProducePartitionState{
+			Partition:            recBuf.partition,
+			ProducerID:           id,
+			ProducerEpoch:        epoch,
+			NextSequence:         recBuf.seq,
+			FirstUnackedSequence: recBuf.batch0Seq,
+			LastAckedOffset:      recBuf.lastAckedOffset,
+			InflightRequests:     int(recBuf.inflight),
+			BufferedBatches:      len(recBuf.batches),
+			BufferedRecords:      recBuf.buffered.Load(),
+		})
+		recBuf.mu.Unlock()
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Partition < states[j].Partition })
+	return states
+}
+
+// ProducedOffsets returns, for every topic and partition the client has
+// successfully produced to, the offset one past the last acked record. Every
+// record this client produced to the partition before that offset is durable,
+// which allows checkpointing "everything up to X is written" without tracking
+// individual record promises.
+//
+// The client acks batches for a partition in order (with idempotency, the
+// broker enforces this via sequence numbers; without, at most one request is
+// in flight per partition if MaxProduceRequestsInflightPerBroker is 1), so the
+// returned offsets only increase. Records that fail are reported to their
+// promises and do not hold back the offset. Partitions that have not had a
+// successful ack are not included. See ProducerOnOffsetAdvanced to be notified
+// as offsets advance.
+func (cl *Client) ProducedOffsets() map[string]map[int32]int64 {
+	offsets := make(map[string]map[int32]int64)
+	for topic, tps := range cl.producer.topics.load() {
+		for _, tp := range tps.load().partitions {
+			recBuf := tp.records
+			recBuf.mu.Lock()
+			acked := recBuf.lastAckedOffset
+			recBuf.mu.Unlock()
+			if acked < 0 {
+				continue
+			}
+			ps := offsets[topic]
+			if ps == nil {
+				ps = make(map[int32]int64)
+				offsets[topic] = ps
+			}
+			ps[tp.records.partition] = acked
+		}
+	}
+	return offsets
+}
+
 type producerID struct {
 	id    int64
 	epoch int16
@@ -896,9 +1200,9 @@ func (cl *Client) doInitProducerID(ctxFn func() context.Context, lastID int64, l
 // partitionsForTopicProduce returns the topic partitions for a record.
 // If the topic is not loaded yet, this buffers the record and returns
 // nil, nil.
-func (cl *Client) partitionsForTopicProduce(pr promisedRec) (*topicPartitions, *topicPartitionsData) {
+func (cl *Client) partitionsForTopicProduce(prs []promisedRec) (*topicPartitions, *topicPartitionsData) {
 	p := &cl.producer
-	topic := pr.Topic
+	topic := prs[0].Topic
 
 	topics := p.topics.load()
 	parts, exists := topics[topic]
@@ -922,7 +1226,7 @@ func (cl *Client) partitionsForTopicProduce(pr promisedRec) (*topicPartitions, *
 			defer p.unknownTopicsMu.Unlock()
 
 			p.topics.storeTopics([]string{topic})
-			cl.addUnknownTopicRecord(pr)
+			cl.addUnknownTopicRecords(prs)
 			cl.triggerUpdateMetadataNow("forced load because we are producing to a topic for the first time")
 			return nil, nil
 		}
@@ -937,15 +1241,17 @@ func (cl *Client) partitionsForTopicProduce(pr promisedRec) (*topicPartitions, *
 	if v := parts.load(); len(v.partitions) > 0 {
 		return parts, v
 	}
-	cl.addUnknownTopicRecord(pr)
+	cl.addUnknownTopicRecords(prs)
 	cl.triggerUpdateMetadata(false, "reload trigger due to produce topic still not known")
 
 	return nil, nil // our record is buffered waiting for metadata update; nothing to return
 }
 
-// addUnknownTopicRecord adds a record to a topic whose partitions are
-// currently unknown. This is always called with the unknownTopicsMu held.
-func (cl *Client) addUnknownTopicRecord(pr promisedRec) {
+// addUnknownTopicRecords adds records to a topic whose partitions are
+// currently unknown; more than one record means the records are produced
+// together. This is always called with the unknownTopicsMu held.
+func (cl *Client) addUnknownTopicRecords(prs []promisedRec) {
+	pr := prs[0]
 	unknown := cl.producer.unknownTopics[pr.Topic]
 	if unknown == nil {
 		unknown = &unknownTopicProduces{
@@ -955,8 +1261,14 @@ func (cl *Client) addUnknownTopicRecord(pr promisedRec) {
 		}
 		cl.producer.unknownTopics[pr.Topic] = unknown
 	}
-	unknown.buffered = append(unknown.buffered, pr)
-	if len(unknown.buffered) == 1 {
+	if len(prs) > 1 {
+		if unknown.together == nil {
+			unknown.together = make(map[int]int)
+		}
+		unknown.together[len(unknown.buffered)] = len(prs)
+	}
+	unknown.buffered = append(unknown.buffered, prs...)
+	if len(unknown.buffered) == len(prs) {
 		go cl.waitUnknownTopic(pr.ctx, pr.Record.Context, pr.Topic, unknown)
 	}
 }
@@ -0,0 +1,391 @@
+package kgo
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kmsg"
+)
+
+func TestProduceTogetherFailsAll(t *testing.T) {
+	cl, err := NewClient(SeedBrokers("127.0.0.1:1"), MaxBufferedRecords(3), MaxBufferedBytes(100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+
+	canceled, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	for _, test := range []struct {
+		name string
+		ctx  context.Context
+		rs   []*Record
+		exp  error // if nil, any error
+	}{
+		{
+			name: "mixed topics",
+			ctx:  context.Background(),
+			rs:   []*Record{{Topic: "a"}, {Topic: "a"}, {Topic: "b"}},
+		},
+		{
+			name: "more than max buffered",
+			ctx:  context.Background(),
+			rs:   []*Record{{Topic: "a"}, {Topic: "a"}, {Topic: "a"}, {Topic: "a"}},
+			exp:  ErrMaxBuffered,
+		},
+		{
+			name: "record too large",
+			ctx:  context.Background(),
+			rs:   []*Record{{Topic: "a"}, {Topic: "a", Value: make([]byte, 101)}},
+			exp:  kerr.MessageTooLarge,
+		},
+		{
+			name: "more than max buffered bytes",
+			ctx:  context.Background(),
+			rs:   []*Record{{Topic: "a", Value: make([]byte, 60)}, {Topic: "a", Value: make([]byte, 60)}},
+			exp:  ErrMaxBuffered,
+		},
+		{
+			name: "canceled waiting for partitions",
+			ctx:  canceled,
+			rs:   []*Record{{Topic: "a"}, {Topic: "a"}},
+			exp:  context.Canceled,
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			var (
+				wg   sync.WaitGroup
+				mu   sync.Mutex
+				errs []error
+			)
+			wg.Add(len(test.rs))
+			cl.ProduceTogether(test.ctx, test.rs, func(_ *Record, err error) {
+				mu.Lock()
+				defer mu.Unlock()
+				errs = append(errs, err)
+				wg.Done()
+			})
+			wg.Wait()
+
+			for i, err := range errs {
+				if err == nil || test.exp != nil && !errors.Is(err, test.exp) {
+					t.Errorf("record %d: got err %v, exp %v", i, err, test.exp)
+				}
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if err := cl.Flush(ctx); err != nil {
+				t.Errorf("flush: %v", err)
+			}
+			if n := cl.BufferedProduceRecords(); n != 0 {
+				t.Errorf("got %d buffered records after failing, exp 0", n)
+			}
+		})
+	}
+}
+
+// roundRobinNewBatchPartitioner picks partitions round robin, tracking how
+// often it is asked to pick and how often OnNewBatch is called.
+type roundRobinNewBatchPartitioner struct {
+	mu         sync.Mutex
+	picks      int
+	newBatches int
+}
+
+func (p *roundRobinNewBatchPartitioner) ForTopic(string) TopicPartitioner { return p }
+func (*roundRobinNewBatchPartitioner) RequiresConsistency(*Record) bool   { return false }
+
+func (p *roundRobinNewBatchPartitioner) Partition(_ *Record, n int) int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.picks++
+	return (p.picks - 1) % n
+}
+
+func (p *roundRobinNewBatchPartitioner) OnNewBatch() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.newBatches++
+}
+
+func TestProduceTogether(t *testing.T) {
+	var (
+		b       *fakeBroker
+		ready   = make(chan struct{})
+		batchMu sync.Mutex
+		batches = make(map[int32][]int32) // partition => records per batch
+	)
+	b = newFakeBroker(t, func(req kmsg.Request) kmsg.Response {
+		switch req := req.(type) {
+		case *kmsg.MetadataRequest:
+			<-ready // the topic is unknown until the test says otherwise
+			resp := b.metadata(req)
+			rt := kmsg.NewMetadataResponseTopic()
+			rt.Topic = kmsg.StringPtr("t")
+			for p := int32(0); p < 3; p++ {
+				rp := kmsg.NewMetadataResponseTopicPartition()
+				rp.Partition = p
+				rp.Replicas = []int32{0}
+				rp.ISR = []int32{0}
+				rt.Partitions = append(rt.Partitions, rp)
+			}
+			resp.Topics = append(resp.Topics, rt)
+			return resp
+
+		case *kmsg.ProduceRequest:
+			resp := req.ResponseKind().(*kmsg.ProduceResponse)
+			for _, rt := range req.Topics {
+				st := kmsg.NewProduceResponseTopic()
+				st.Topic = rt.Topic
+				for _, rp := range rt.Partitions {
+					var batch kmsg.RecordBatch
+					if err := batch.ReadFrom(rp.Records); err != nil {
+						t.Errorf("unable to read produced batch: %v", err)
+					}
+					batchMu.Lock()
+					batches[rp.Partition] = append(batches[rp.Partition], batch.NumRecords)
+					batchMu.Unlock()
+					sp := kmsg.NewProduceResponseTopicPartition()
+					sp.Partition = rp.Partition
+					st.Partitions = append(st.Partitions, sp)
+				}
+				resp.Topics = append(resp.Topics, st)
+			}
+			return resp
+		}
+		return nil
+	})
+	release := sync.OnceFunc(func() { close(ready) })
+	defer b.close()
+	defer release() // unblock the broker if we fail early
+
+	p := new(roundRobinNewBatchPartitioner)
+	cl, err := NewClient(
+		SeedBrokers(b.addr()),
+		DisableIdempotentWrite(),
+		RequiredAcks(LeaderAck()),
+		RecordPartitioner(p),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+
+	var (
+		wg      sync.WaitGroup
+		mu      sync.Mutex
+		results []*Record
+	)
+	rs := []*Record{
+		{Topic: "t", Key: []byte("a")},
+		{Topic: "t", Key: []byte("b")},
+		{Topic: "t", Key: []byte("c")},
+	}
+	wg.Add(len(rs))
+	returned := make(chan struct{})
+	go func() {
+		defer close(returned)
+		cl.ProduceTogether(context.Background(), rs, func(r *Record, err error) {
+			defer wg.Done()
+			if err != nil {
+				t.Errorf("unexpected produce error: %v", err)
+			}
+			mu.Lock()
+			defer mu.Unlock()
+			results = append(results, r)
+		})
+	}()
+	select {
+	case <-returned:
+	case <-time.After(5 * time.Second):
+		t.Fatal("ProduceTogether blocked waiting for the topic's partitions")
+	}
+	release()
+	wg.Wait()
+
+	// Partition 0 is picked first, but it would start a new batch:
+	// OnNewBatch is called once and partition 1 is picked for every
+	// record.
+	p.mu.Lock()
+	if p.picks != 2 || p.newBatches != 1 {
+		t.Errorf("got %d picks and %d new batches, exp 2 and 1", p.picks, p.newBatches)
+	}
+	p.mu.Unlock()
+	for i, r := range results {
+		if r != rs[i] || r.Partition != 1 || r.Offset != int64(i) {
+			t.Errorf("result %d: got key %s partition %d offset %d, exp key %s partition 1 offset %d", i, r.Key, r.Partition, r.Offset, rs[i].Key, i)
+		}
+	}
+	batchMu.Lock()
+	defer batchMu.Unlock()
+	if exp := map[int32][]int32{1: {3}}; !reflect.DeepEqual(batches, exp) {
+		t.Errorf("got batches %v, exp one batch of three records to partition 1", batches)
+	}
+}
+
+func TestProducerOnOffsetAdvanced(t *testing.T) {
+	type advance struct {
+		topic     string
+		partition int32
+		offset    int64
+	}
+	advanced := make(chan advance, 10)
+	cl, err := NewClient(SeedBrokers("127.0.0.1:1"), ProducerOnOffsetAdvanced(func(topic string, partition int32, offset int64) {
+		advanced <- advance{topic, partition, offset}
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+
+	promised := make(chan int64, 10)
+	recs := func(n int) []promisedRec {
+		var prs []promisedRec
+		for i := 0; i < n; i++ {
+			prs = append(prs, promisedRec{
+				ctx:     context.Background(),
+				promise: func(r *Record, _ error) { promised <- r.Offset },
+				Record:  &Record{Topic: "t"},
+			})
+		}
+		return prs
+	}
+	for _, b := range []batchPromise{
+		{baseOffset: 10, partition: 2, recs: recs(3)},
+		{baseOffset: 13, partition: 2, recs: recs(1), err: errors.New("failed")}, // does not advance
+		{baseOffset: -1, partition: 2, recs: recs(1)},                            // unknown offsets do not advance
+		{baseOffset: 20, partition: 2, recs: recs(2)},
+	} {
+		b.beforeBuf = true // avoid buffered accounting
+		cl.producer.promiseBatch(b)
+	}
+
+	for _, exp := range []advance{{"t", 2, 13}, {"t", 2, 22}} {
+		select {
+		case got := <-advanced:
+			if got != exp {
+				t.Errorf("got %v != exp %v", got, exp)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for the offset to advance")
+		}
+	}
+	if len(promised) != 7 {
+		t.Errorf("got %d finished promises before the last advance, exp 7", len(promised))
+	}
+	select {
+	case got := <-advanced:
+		t.Errorf("unexpected extra advance %v", got)
+	default:
+	}
+}
+
+func TestDuplicateSequenceUnknownOffset(t *testing.T) {
+	cl, err := NewClient(SeedBrokers("127.0.0.1:1"), RetriableErrorBudget(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+
+	promised := make(chan int64, 2)
+	owner := &recBuf{cl: cl, topic: "t", lastAckedOffset: 10}
+	owner.retryBudget.fail(time.Minute, kerr.NotLeaderForPartition, time.Now())
+	batch := &recBatch{owner: owner}
+	for i := 0; i < 2; i++ {
+		batch.records = append(batch.records, promisedRec{
+			ctx:     context.Background(),
+			promise: func(r *Record, _ error) { promised <- r.Offset },
+			Record:  &Record{Topic: "t"},
+		})
+	}
+	owner.batches = []*recBatch{batch}
+	owner.batchDrainIdx = 1
+
+	s := &sink{cl: cl}
+	rp := &kmsg.ProduceResponseTopicPartition{
+		ErrorCode:  kerr.DuplicateSequenceNumber.Code,
+		BaseOffset: -1,
+	}
+	retry, didProduce := s.handleReqRespBatch(nil, new(kip951move), new(kmsg.ProduceResponse), "t", rp, seqRecBatch{0, batch}, 1, 0)
+	if retry || !didProduce {
+		t.Fatalf("got retry %v, produced %v; exp no retry and a successful produce", retry, didProduce)
+	}
+
+	if !owner.okOnSink {
+		t.Error("partition not marked ok on the sink")
+	}
+	if owner.lastAckedOffset != 12 {
+		t.Errorf("got last acked offset %d, exp 12", owner.lastAckedOffset)
+	}
+	if len(owner.retryBudget.errs) != 0 || !owner.retryBudget.since.IsZero() {
+		t.Errorf("retry budget not reset: %+v", owner.retryBudget)
+	}
+	for i := 0; i < 2; i++ {
+		select {
+		case offset := <-promised:
+			if offset != -1 {
+				t.Errorf("got record offset %d, exp -1 (unknown)", offset)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for the record promise")
+		}
+	}
+}
+
+type loadPartitioner struct {
+	loads []PartitionLoad
+}
+
+func (*loadPartitioner) RequiresConsistency(*Record) bool { return false }
+func (*loadPartitioner) Partition(*Record, int) int {
+	panic("Partition called on a TopicLoadPartitioner")
+}
+
+func (p *loadPartitioner) PartitionByLoad(_ *Record, n int, it TopicLoadIter) int {
+	p.loads = make([]PartitionLoad, n)
+	least := -1
+	for it.Rem() > 0 {
+		idx, load := it.Next()
+		p.loads[idx] = load
+		if least == -1 || load.BufferedBytes < p.loads[least].BufferedBytes {
+			least = idx
+		}
+	}
+	return least
+}
+
+func TestTopicLoadPartitioner(t *testing.T) {
+	lp := new(loadPartitioner)
+	parts := &topicPartitions{partitioner: lp}
+	var mapping []*topicPartition
+	for i, bytes := range []int64{300, 100, 200} {
+		recBuf := &recBuf{partition: int32(i)}
+		recBuf.buffered.Store(int64(i + 1))
+		recBuf.bufferedBytes.Store(bytes)
+		mapping = append(mapping, &topicPartition{records: recBuf})
+	}
+	mapping[2].records.unhealthy.Store(true)
+	mapping[0].records.observeAckLatency(8 * time.Millisecond)
+	mapping[0].records.observeAckLatency(16 * time.Millisecond)
+
+	if pick := parts.lockedPick(mapping, &Record{}); pick != 1 {
+		t.Errorf("got pick %d, exp the partition with the least buffered bytes (1)", pick)
+	}
+	exp := []PartitionLoad{
+		{BufferedRecords: 1, BufferedBytes: 300, LeaderHealthy: true, AckLatency: 9 * time.Millisecond},
+		{BufferedRecords: 2, BufferedBytes: 100, LeaderHealthy: true},
+		{BufferedRecords: 3, BufferedBytes: 200, LeaderHealthy: false},
+	}
+	for i := range exp {
+		if lp.loads[i] != exp[i] {
+			t.Errorf("partition %d: got load %+v, exp %+v", i, lp.loads[i], exp[i])
+		}
+	}
+}
@@ -0,0 +1,116 @@
+package kgo
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+
+	"github.com/twmb/franz-go/pkg/kerr"
+	"github.com/twmb/franz-go/pkg/kmsg"
+)
+
+// ProduceRawBatch writes an already encoded record batch, such as one
+// returned in FetchPartition.RawBatches with ConsumeRawBatches, verbatim to
+// the given partition and returns the base offset the broker assigned to it.
+// The records are not decompressed or re-encoded. This is an unsafe API meant
+// for mirroring; normal producing should use Produce.
+//
+// Only what the protocol requires is rewritten: the base offset and partition
+// leader epoch are reset, as are the producer ID, epoch, and sequence number
+// (the source producer means nothing on the destination). The transactional
+// and log append time attributes are cleared, and the CRC is recomputed.
+// Control batches cannot be produced.
+//
+// The batch is issued in its own request directly to the partition leader
+// with the client's RequiredAcks and ProduceRequestTimeout. It is not
+// buffered, retried on partition errors, or part of any transaction, and does
+// not go through the client's idempotency. If the leader moved, the error is
+// returned and the next call uses fresh metadata. With acks of 0, the
+// returned offset is -1.
+func (cl *Client) ProduceRawBatch(ctx context.Context, topic string, partition int32, batch []byte) (int64, error) {
+	batch, err := rawBatchForProduce(batch)
+	if err != nil {
+		return -1, err
+	}
+
+	mapping, err := cl.fetchMappedMetadata(ctx, []string{topic}, true)
+	if err != nil {
+		return -1, err
+	}
+	t, ok := mapping[topic]
+	if !ok {
+		return -1, kerr.UnknownTopicOrPartition
+	}
+	if err := kerr.ErrorForCode(t.t.ErrorCode); err != nil {
+		cl.maybeDeleteMappedMetadata(errors.Is(err, kerr.UnknownTopicOrPartition), topic)
+		return -1, err
+	}
+	p, ok := t.ps[partition]
+	if !ok {
+		return -1, kerr.UnknownTopicOrPartition
+	}
+	if err := kerr.ErrorForCode(p.ErrorCode); err != nil {
+		cl.maybeDeleteMappedMetadata(false, topic)
+		return -1, err
+	}
+
+	req := kmsg.NewPtrProduceRequest()
+	req.Acks = cl.cfg.acks.val
+	req.TimeoutMillis = int32(cl.cfg.produceTimeout.Milliseconds())
+	reqTopic := kmsg.NewProduceRequestTopic()
+	reqTopic.Topic = topic
+	reqPartition := kmsg.NewProduceRequestTopicPartition()
+	reqPartition.Partition = partition
+	reqPartition.Records = batch
+	reqTopic.Partitions = append(reqTopic.Partitions, reqPartition)
+	req.Topics = append(req.Topics, reqTopic)
+
+	kresp, err := cl.Broker(int(p.Leader)).RetriableRequest(ctx, req)
+	if err != nil {
+		return -1, err
+	}
+	if req.Acks == 0 {
+		return -1, nil
+	}
+	resp := kresp.(*kmsg.ProduceResponse)
+	if len(resp.Topics) != 1 || len(resp.Topics[0].Partitions) != 1 {
+		return -1, fmt.Errorf("produce response has %d topics, expected 1 topic with 1 partition", len(resp.Topics))
+	}
+	rp := &resp.Topics[0].Partitions[0]
+	if err := kerr.ErrorForCode(rp.ErrorCode); err != nil {
+		cl.maybeDeleteMappedMetadata(false, topic)
+		return -1, err
+	}
+	return rp.BaseOffset, nil
+}
+
+// rawBatchForProduce validates an encoded v2 record batch and returns a copy
+// with the fields a producer must not carry over reset.
+func rawBatchForProduce(batch []byte) ([]byte, error) {
+	const headerLen = 61 // through NumRecords
+	if len(batch) < headerLen {
+		return nil, fmt.Errorf("raw batch length %d is too short to contain a record batch header", len(batch))
+	}
+	if magic := batch[16]; magic != 2 {
+		return nil, fmt.Errorf("raw batch has magic %d, only record batches (magic 2) can be produced", magic)
+	}
+	if length := int(binary.BigEndian.Uint32(batch[8:])); length+12 != len(batch) {
+		return nil, fmt.Errorf("raw batch encoded length %d does not match the %d bytes following the length", length, len(batch)-12)
+	}
+	attrs := binary.BigEndian.Uint16(batch[21:])
+	if attrs&0b0010_0000 != 0 {
+		return nil, errors.New("raw batch is a control batch, which cannot be produced")
+	}
+
+	b := append([]byte(nil), batch...)
+	binary.BigEndian.PutUint64(b[0:], 0)                               // FirstOffset
+	binary.BigEndian.PutUint32(b[12:], 0xffffffff)                     // PartitionLeaderEpoch
+	binary.BigEndian.PutUint16(b[21:], attrs&^0b0001_1000)             // Attributes: not transactional, CreateTime
+	binary.BigEndian.PutUint64(b[43:], 0xffffffffffffffff)             // ProducerID
+	binary.BigEndian.PutUint16(b[51:], 0xffff)                         // ProducerEpoch
+	binary.BigEndian.PutUint32(b[53:], 0xffffffff)                     // FirstSequence
+	binary.BigEndian.PutUint32(b[17:], crc32.Checksum(b[21:], crc32c)) // CRC
+	return b, nil
+}
@@ -134,6 +134,10 @@ type Record struct {
 	// LeaderEpoch. Clients use the LeaderEpoch for data loss detection.
 	LeaderEpoch int32
 
+	// batchOffsetDelta is this record's offset delta within the batch it
+	// was consumed from; it sits in what would otherwise be padding.
+	batchOffsetDelta int32
+
 	// Offset is the offset that a record is written as.
 	//
 	// For producing, this is left unset. This will be set by the client
@@ -149,6 +153,83 @@ type Record struct {
 	// producer hooks. It can also be set in a consumer hook to propagate
 	// enrichment to consumer clients.
 	Context context.Context
+
+	// For records consumed from a record batch, the batch's max timestamp
+	// (in millis) and number of records. Zero otherwise.
+	batchMaxTimestamp int64
+	batchNumRecords   int32
+}
+
+// BatchMaxTimestamp returns the max timestamp of the record batch this record
+// was consumed from, which is the broker's append time if the topic uses
+// LogAppendTime. This returns the zero time if the record was not consumed, or
+// if it was consumed from an old message set (Kafka < 0.11) that has no batch.
+//
+// The batch's producer ID, producer epoch, and attributes (including whether
+// the batch is transactional) are already on the record itself.
+func (r *Record) BatchMaxTimestamp() time.Time {
+	if r.batchNumRecords == 0 {
+		return time.Time{}
+	}
+	return timeFromMillis(r.batchMaxTimestamp)
+}
+
+// BatchRange returns the first offset and number of records of the record
+// batch this record was consumed from. Compaction can remove records from a
+// batch, so the batch may span more offsets than it has records. This returns
+// 0, 0 if the record was not consumed, or if it was consumed from an old
+// message set (Kafka < 0.11) that has no batch.
+func (r *Record) BatchRange() (firstOffset int64, numRecords int32) {
+	if r.batchNumRecords == 0 {
+		return 0, 0
+	}
+	return r.Offset - int64(r.batchOffsetDelta), r.batchNumRecords
+}
+
+// RecordBatchInfo contains the batch level fields of a record batch, as
+// returned in RawBatch.
+type RecordBatchInfo struct {
+	// FirstOffset is the offset of the first record in the batch.
+	FirstOffset int64
+	// LastOffsetDelta is the offset delta of the last record in the batch.
+	// Compaction can remove records, so this may be more than the number
+	// of records in the batch.
+	LastOffsetDelta int32
+	// FirstTimestamp is the timestamp of the first record in the batch.
+	FirstTimestamp time.Time
+	// MaxTimestamp is the largest timestamp in the batch, or the broker's
+	// append time if the topic uses LogAppendTime.
+	MaxTimestamp time.Time
+	// ProducerID is the ID of the producer that wrote the batch, or -1.
+	ProducerID int64
+	// ProducerEpoch is the epoch of the producer that wrote the batch, or
+	// -1.
+	ProducerEpoch int16
+	// Attrs are the batch attributes, which also contain whether the
+	// batch is transactional or a control batch.
+	Attrs RecordAttrs
+	// NumRecords is the number of records in the batch.
+	NumRecords int32
+}
+
+// RawBatch is an undecoded record batch, returned in FetchPartition.RawBatches
+// when consuming with ConsumeRawBatches.
+type RawBatch struct {
+	RecordBatchInfo
+
+	// LeaderEpoch is the partition leader epoch the batch was written in.
+	LeaderEpoch int32
+
+	// Batch is the full batch as it was read from the broker, including
+	// the batch header, with the records still compressed. The slice
+	// points into the fetch response and must not be modified.
+	Batch []byte
+}
+
+// NextOffset returns the offset just past the last record in the batch, which
+// is the offset to resume consuming from after this batch.
+func (b *RawBatch) NextOffset() int64 {
+	return b.FirstOffset + int64(b.LastOffsetDelta) + 1
 }
 
 func (r *Record) userSize() int64 {
@@ -261,6 +342,10 @@ type FetchPartition struct {
 	LogStartOffset int64
 	// Records contains feched records for this partition.
 	Records []*Record
+	// RawBatches contains undecoded record batches for this partition if
+	// the client is consuming with ConsumeRawBatches. Records is then
+	// only used for batches from old message sets (Kafka < 0.11).
+	RawBatches []RawBatch
 }
 
 // EachRecord calls fn for each record in the partition.
@@ -384,7 +469,7 @@ func (f Fetch) hasErrorsOrRecords() bool {
 		t := &f.Topics[i]
 		for j := range t.Partitions {
 			p := &t.Partitions[j]
-			if p.Err != nil || len(p.Records) > 0 {
+			if p.Err != nil || len(p.Records) > 0 || len(p.RawBatches) > 0 {
 				return true
 			}
 		}
@@ -0,0 +1,104 @@
+package kgo
+
+import "time"
+
+// retryBudgetHistory is how many recent errors a retryBudget keeps.
+const retryBudgetHistory = 8
+
+type retryBudgetAction uint8
+
+const (
+	retryBudgetOK retryBudgetAction = iota
+	retryBudgetEscalate
+	retryBudgetExhausted
+)
+
+// retryBudget tracks how long a partition has been failing with only
+// retriable errors; see RetriableErrorBudget. The produce side uses this under
+// the recBuf mutex, and the fetch side uses this while processing a fetch
+// response, which is never concurrent for a single cursor.
+type retryBudget struct {
+	since     time.Time
+	escalated time.Time
+	errs      []error
+}
+
+// fail records a retriable failure and returns what the client should do.
+func (b *retryBudget) fail(budget time.Duration, err error, now time.Time) retryBudgetAction {
+	if budget <= 0 {
+		return retryBudgetOK
+	}
+	if len(b.errs) == retryBudgetHistory {
+		copy(b.errs, b.errs[1:])
+		b.errs = b.errs[:len(b.errs)-1]
+	}
+	b.errs = append(b.errs, err)
+
+	switch {
+	case b.since.IsZero():
+		b.since = now
+	case b.escalated.IsZero():
+		if now.Sub(b.since) >= budget {
+			b.escalated = now
+			return retryBudgetEscalate
+		}
+	case now.Sub(b.escalated) >= budget:
+		return retryBudgetExhausted
+	}
+	return retryBudgetOK
+}
+
+// reset clears the budget after a success, or after the budget is exhausted
+// and the error is returned to the user.
+func (b *retryBudget) reset() {
+	*b = retryBudget{}
+}
+
+// retryBudgetFail records a retriable failure for a partition against its
+// budget, escalating as necessary. This returns a non-nil error if the budget
+// is exhausted and the client should stop retrying the partition.
+func (cl *Client) retryBudgetFail(b *retryBudget, topic string, partition, node int32, err error) error {
+	action := b.fail(cl.cfg.retryBudget, err, time.Now())
+	if action == retryBudgetOK {
+		return nil
+	}
+
+	exhausted := action == retryBudgetExhausted
+	errs := append([]error(nil), b.errs...)
+	cl.cfg.hooks.each(func(h Hook) {
+		if h, ok := h.(HookRetriableErrorBudget); ok {
+			h.OnRetriableErrorBudget(topic, partition, exhausted, errs)
+		}
+	})
+
+	if exhausted {
+		cl.cfg.logger.Log(LogLevelError, "partition exhausted its retriable error budget, no longer retrying internally",
+			"broker", logID(node),
+			"topic", topic,
+			"partition", partition,
+			"failing_since", b.since,
+			"err", err,
+		)
+		rerr := &ErrRetriableErrorBudget{
+			Topic:     topic,
+			Partition: partition,
+			Since:     b.since,
+			Err:       err,
+		}
+		b.reset()
+		return rerr
+	}
+
+	cl.cfg.logger.Log(LogLevelWarn, "partition exceeded its retriable error budget, reconnecting to the broker and refreshing metadata",
+		"broker", logID(node),
+		"topic", topic,
+		"partition", partition,
+		"failing_since", b.since,
+		"err", err,
+	)
+	if br, _ := cl.brokerOrErr(nil, node, errUnknownBroker); br != nil {
+		br.killConnections()
+	}
+	cl.triggerUpdateMetadataNow("retriable error budget exceeded")
+	return nil
+}
@@ -0,0 +1,51 @@
+package kgo
+
+import (
+	"testing"
+	"time"
+
+	"github.com/twmb/franz-go/pkg/kerr"
+)
+
+func TestRetryBudget(t *testing.T) {
+	var (
+		b      retryBudget
+		budget = time.Second
+		start  = time.Now()
+		err    = kerr.NotLeaderForPartition
+	)
+	for _, step := range []struct {
+		at  time.Duration
+		exp retryBudgetAction
+	}{
+		{0, retryBudgetOK},
+		{500 * time.Millisecond, retryBudgetOK},
+		{time.Second, retryBudgetEscalate},
+		{1500 * time.Millisecond, retryBudgetOK},
+		{2 * time.Second, retryBudgetExhausted},
+	} {
+		if got := b.fail(budget, err, start.Add(step.at)); got != step.exp {
+			t.Fatalf("at %v: got %v != exp %v", step.at, got, step.exp)
+		}
+	}
+	if len(b.errs) != 5 {
+		t.Errorf("got %d errs != exp 5", len(b.errs))
+	}
+
+	for i := 0; i < 2*retryBudgetHistory; i++ {
+		b.fail(budget, err, start)
+	}
+	if len(b.errs) != retryBudgetHistory {
+		t.Errorf("got %d errs != exp %d", len(b.errs), retryBudgetHistory)
+	}
+
+	b.reset()
+	if got := b.fail(budget, err, start.Add(time.Hour)); got != retryBudgetOK {
+		t.Errorf("after reset: got %v != exp ok", got)
+	}
+
+	var disabled retryBudget
+	if got := disabled.fail(0, err, start); got != retryBudgetOK || len(disabled.errs) != 0 {
+		t.Errorf("disabled budget: got %v with %d errs", got, len(disabled.errs))
+	}
+}
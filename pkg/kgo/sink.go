@@ -461,6 +461,7 @@ func (s *sink) produce(sem <-chan struct{}) bool {
 	produced = true
 
 	batches := req.batches.sliced()
+	req.issued = time.Now()
 	s.doSequenced(req, func(br *broker, resp kmsg.Response, err error) {
 		s.handleReqResp(br, req, resp, err)
 		s.cl.producer.decInflight()
@@ -630,6 +631,8 @@ func (s *sink) firstRespCheck(idempotent bool, version int16) {
 // handleReqClientErr is called when the client errors before receiving a
 // produce response.
 func (s *sink) handleReqClientErr(req *produceRequest, err error) {
+	req.batches.each(func(batch seqRecBatch) { batch.owner.unhealthy.Store(true) })
+
 	switch {
 	default:
 		s.cl.cfg.logger.Log(LogLevelWarn, "random error while producing, requeueing unattempted request", "broker", logID(s.nodeID), "err", err)
@@ -746,10 +749,14 @@ func (s *sink) handleReqResp(br *broker, req *produceRequest, resp kmsg.Response
 				req.producerEpoch,
 			)
 			if retry {
+				batch.owner.unhealthy.Store(true)
 				reqRetry.addSeqBatch(topic, partition, batch)
 			}
 			if !didProduce {
 				delete(tmetrics, partition)
+			} else {
+				batch.owner.unhealthy.Store(false)
+				batch.owner.observeAckLatency(time.Since(req.issued))
 			}
 		}
 
@@ -836,9 +843,17 @@ func (s *sink) handleReqRespBatch(
 
 	err := kerr.ErrorForCode(rp.ErrorCode)
 	failUnknown := batch.owner.checkUnknownFailLimit(err)
+	var budgetExhausted bool
+	if kerr.IsRetriable(err) {
+		if budgetErr := s.cl.retryBudgetFail(&batch.owner.retryBudget, topic, rp.Partition, s.nodeID, err); budgetErr != nil {
+			err = budgetErr
+			budgetExhausted = true
+		}
+	}
 	switch {
 	case kerr.IsRetriable(err) &&
 		!failUnknown &&
+		!budgetExhausted &&
 		err != kerr.CorruptMessage &&
 		batch.tries < s.cl.cfg.recordRetries:
 
@@ -907,6 +922,10 @@ func (s *sink) handleReqRespBatch(
 				"partition", rp.Partition,
 				"producer_id", producerID,
 				"producer_epoch", producerEpoch,
+				"first_unacked_seq", batch.owner.batch0Seq,
+				"next_seq", batch.owner.seq,
+				"last_acked_offset", batch.owner.lastAckedOffset,
+				"inflight", batch.owner.inflight,
 				"err", err,
 			)
 			s.cl.failProducerID(producerID, producerEpoch, errReloadProducerID)
@@ -923,6 +942,10 @@ func (s *sink) handleReqRespBatch(
 				"partition", rp.Partition,
 				"producer_id", producerID,
 				"producer_epoch", producerEpoch,
+				"first_unacked_seq", batch.owner.batch0Seq,
+				"next_seq", batch.owner.seq,
+				"last_acked_offset", batch.owner.lastAckedOffset,
+				"inflight", batch.owner.inflight,
 				"err", err,
 			)
 			s.cl.failProducerID(producerID, producerEpoch, err)
@@ -953,6 +976,10 @@ func (s *sink) handleReqRespBatch(
 			"partition", rp.Partition,
 			"producer_id", producerID,
 			"producer_epoch", producerEpoch,
+			"first_unacked_seq", batch.owner.batch0Seq,
+			"next_seq", batch.owner.seq,
+			"last_acked_offset", batch.owner.lastAckedOffset,
+			"inflight", batch.owner.inflight,
 			"err", err,
 		)
 
@@ -967,12 +994,34 @@ func (s *sink) handleReqRespBatch(
 		return true, false
 
 	case err == kerr.DuplicateSequenceNumber: // ignorable, but we should not get
+		// A duplicate means a prior attempt of this batch was
+		// written, so the batch is successful. Newer brokers return
+		// the original offset for recent duplicates; older ones may
+		// return -1, in which case the record offsets are unknown.
 		s.cl.cfg.logger.Log(LogLevelInfo, "received unexpected duplicate sequence number, ignoring and treating batch as successful",
 			"broker", logID(s.nodeID),
 			"topic", topic,
 			"partition", rp.Partition,
+			"base_offset", rp.BaseOffset,
 		)
 		err = nil
+		if rp.BaseOffset < 0 {
+			// We do not know where the batch landed, but it
+			// directly follows our last ack, so advancing by the
+			// record count keeps the last acked offset a safe
+			// lower bound.
+			batch.owner.okOnSink = true
+			if batch.owner.lastAckedOffset >= 0 {
+				batch.owner.lastAckedOffset += int64(len(batch.records))
+			}
+			batch.owner.retryBudget.reset()
+			s.cl.finishBatch(batch.recBatch, producerID, producerEpoch, rp.Partition, rp.BaseOffset, nil)
+			didProduce = true
+			if debug {
+				fmt.Fprintf(b, "dup@%d,%d}, ", rp.BaseOffset, nrec)
+			}
+			return false, didProduce
+		}
 		fallthrough
 	default:
 		if err != nil {
@@ -987,6 +1036,7 @@ func (s *sink) handleReqRespBatch(
 		} else {
 			batch.owner.okOnSink = true
 			batch.owner.lastAckedOffset = rp.BaseOffset + int64(len(batch.records))
+			batch.owner.retryBudget.reset()
 		}
 		s.cl.finishBatch(batch.recBatch, producerID, producerEpoch, rp.Partition, rp.BaseOffset, err)
 		didProduce = err == nil
@@ -1031,6 +1081,12 @@ func (cl *Client) finishBatch(batch *recBatch, producerID int64, producerEpoch i
 	batch.records = nil
 	batch.mu.Unlock()
 
+	var finishedBytes int64
+	for _, pr := range records {
+		finishedBytes += pr.userSize()
+	}
+	recBuf.bufferedBytes.Add(-finishedBytes)
+
 	cl.producer.promiseBatch(batchPromise{
 		baseOffset: baseOffset,
 		pid:        producerID,
@@ -1217,6 +1273,13 @@ type recBuf struct {
 	// of records buffered in total on this recBuf.
 	buffered atomicI64
 
+	// For TopicLoadPartitioner partitioning; the following atomically
+	// track the bytes buffered on this recBuf, whether the last produce
+	// including this recBuf failed, and an EWMA of ack latency (nanos).
+	bufferedBytes atomicI64
+	unhealthy     atomicBool
+	ackLatency    atomicI64
+
 	mu sync.Mutex // guards r/w access to all fields below
 
 	// sink is who is currently draining us. This can be modified
@@ -1260,6 +1323,8 @@ type recBuf struct {
 
 	lastAckedOffset int64 // last ProduceResponse's BaseOffset + how many records we produced
 
+	retryBudget retryBudget // see RetriableErrorBudget
+
 	topicPartitionData // updated in metadata migrateProductionTo (same spot sink is updated)
 
 	// seq is used for the seq in each record batch. It is incremented when
@@ -1321,6 +1386,28 @@ type recBuf struct {
 	purged bool
 }
 
+// load returns the current load of this buffer for TopicLoadPartitioner.
+func (recBuf *recBuf) load() PartitionLoad {
+	return PartitionLoad{
+		BufferedRecords: recBuf.buffered.Load(),
+		BufferedBytes:   recBuf.bufferedBytes.Load(),
+		LeaderHealthy:   !recBuf.unhealthy.Load(),
+		AckLatency:      time.Duration(recBuf.ackLatency.Load()),
+	}
+}
+
+// observeAckLatency folds a new ack latency into our moving average. Responses
+// for a recBuf are handled serially, so we do not need to worry about
+// concurrent updates.
+func (recBuf *recBuf) observeAckLatency(latency time.Duration) {
+	prior := recBuf.ackLatency.Load()
+	if prior == 0 {
+		recBuf.ackLatency.Store(int64(latency))
+		return
+	}
+	recBuf.ackLatency.Store(prior + (int64(latency)-prior)/8)
+}
+
 // bufferRecord usually buffers a record, but does not if abortOnNewBatch is
 // true and if this function would create a new batch.
 //
@@ -1329,7 +1416,50 @@ type recBuf struct {
 func (recBuf *recBuf) bufferRecord(pr promisedRec, abortOnNewBatch bool) bool {
 	recBuf.mu.Lock()
 	defer recBuf.mu.Unlock()
+	return recBuf.lockedBufferRecord(pr, abortOnNewBatch)
+}
+
+// bufferRecords buffers all records back to back while holding the recBuf
+// lock, ensuring no other record is interleaved and no batch containing only
+// some of the records is drained before all are buffered. If any record is
+// too large to ever be produced, all records are failed.
+//
+// As with bufferRecord, if abortOnNewBatch is true and the first record would
+// create a new batch, nothing is buffered and this returns false.
+func (recBuf *recBuf) bufferRecords(prs []promisedRec, abortOnNewBatch bool) bool {
+	recBuf.mu.Lock()
+	defer recBuf.mu.Unlock()
+
+	produceVersion := recBuf.sink.produceVersion.Load()
+	for _, pr := range prs {
+		if pr.Timestamp.IsZero() {
+			pr.Timestamp = time.Now()
+		}
+		pr.Timestamp = pr.Timestamp.Truncate(time.Millisecond)
+
+		// An abort from an empty batch means the record would
+		// have been appended; anything else is too large.
+		probe := recBatch{wireLength: recordBatchOverhead}
+		if _, fits := probe.tryBuffer(pr, produceVersion, recBuf.maxRecordBatchBytes, true); !fits {
+			recBuf.cl.producer.promiseBatch(batchPromise{
+				partition: recBuf.partition,
+				recs:      prs,
+				err:       kerr.MessageTooLarge,
+			})
+			return true
+		}
+	}
 
+	if !recBuf.lockedBufferRecord(prs[0], abortOnNewBatch) {
+		return false
+	}
+	for _, pr := range prs[1:] {
+		recBuf.lockedBufferRecord(pr, false)
+	}
+	return true
+}
+
+func (recBuf *recBuf) lockedBufferRecord(pr promisedRec, abortOnNewBatch bool) bool {
 	// We truncate to milliseconds to avoid some accumulated rounding error
 	// problems (see IBM/sarama#1455)
 	if pr.Timestamp.IsZero() {
@@ -1389,6 +1519,7 @@ func (recBuf *recBuf) bufferRecord(pr promisedRec, abortOnNewBatch bool) bool {
 	}
 
 	recBuf.buffered.Add(1)
+	recBuf.bufferedBytes.Add(pr.userSize())
 
 	if recBuf.cl.producer.hooks != nil && len(recBuf.cl.producer.hooks.partitioned) > 0 {
 		for _, h := range recBuf.cl.producer.hooks.partitioned {
@@ -1528,6 +1659,7 @@ func (recBuf *recBuf) failAllRecords(err error) {
 	}
 	recBuf.resetBatchDrainIdx()
 	recBuf.buffered.Store(0)
+	recBuf.bufferedBytes.Store(0)
 	recBuf.batches = nil
 }
 
@@ -1646,20 +1778,6 @@ func (b *recBatch) appendRecord(pr promisedRec, nums recordNumbers) {
 
 // newRecordBatch returns a new record batch for a topic and partition.
 func (recBuf *recBuf) newRecordBatch() *recBatch {
-	const recordBatchOverhead = 4 + // array len
-		8 + // firstOffset
-		4 + // batchLength
-		4 + // partitionLeaderEpoch
-		1 + // magic
-		4 + // crc
-		2 + // attributes
-		4 + // lastOffsetDelta
-		8 + // firstTimestamp
-		8 + // maxTimestamp
-		8 + // producerID
-		2 + // producerEpoch
-		4 + // seq
-		4 // record array length
 	return &recBatch{
 		owner:      recBuf,
 		records:    recBuf.cl.prsPool.get()[:0],
@@ -1669,6 +1787,22 @@ func (recBuf *recBuf) newRecordBatch() *recBatch {
 	}
 }
 
+// recordBatchOverhead is the wire length of an empty record batch.
+const recordBatchOverhead = 4 + // array len
+	8 + // firstOffset
+	4 + // batchLength
+	4 + // partitionLeaderEpoch
+	1 + // magic
+	4 + // crc
+	2 + // attributes
+	4 + // lastOffsetDelta
+	8 + // firstTimestamp
+	8 + // maxTimestamp
+	8 + // producerID
+	2 + // producerEpoch
+	4 + // seq
+	4 // record array length
+
 type prsPool struct{ p *sync.Pool }
 
 func newPrsPool() prsPool {
@@ -1740,6 +1874,10 @@ type produceRequest struct {
 	producerID    int64
 	producerEpoch int16
 
+	// issued is set just before the request is issued and is used to
+	// track per-partition ack latency.
+	issued time.Time
+
 	// Initialized in AppendTo, metrics tracks uncompressed & compressed
 	// sizes (in byteS) of each batch.
 	//
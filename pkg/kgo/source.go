@@ -43,6 +43,77 @@ type source struct {
 	cursorsMu    sync.Mutex
 	cursors      []*cursor // contains all partitions being consumed on this source
 	cursorsStart int       // incremented every fetch req to ensure all partitions are fetched
+
+	// stateMu guards the following fields, which exist only for
+	// FetchRequestStates.
+	stateMu       sync.Mutex
+	inflightSince time.Time   // zero if no request is in flight
+	inflightUsed  usedOffsets // what the in flight request is for; read only while in flight
+	lastResp      time.Time   // when we last received a response
+}
+
+// FetchState is the state of fetching from a single broker; see
+// FetchRequestStates.
+type FetchState struct {
+	// Broker is the node ID of the broker being fetched from.
+	Broker int32
+
+	// InFlight is whether a fetch request is currently in flight to the
+	// broker, and InFlightSince is when that request was issued.
+	InFlight      bool
+	InFlightSince time.Time
+
+	// Partitions are the partitions the in flight request is fetching.
+	// This is nil if no request is in flight.
+	Partitions map[string][]int32
+
+	// LastResponse is when a response was last received from the broker,
+	// or the zero time if no response has been received.
+	LastResponse time.Time
+}
+
+// FetchRequestStates returns the state of fetching from every broker the
+// client has fetched from, ordered by broker. Fetches are long polls, so it is
+// normal for a request to be in flight for up to the FetchMaxWait; a request
+// that has been in flight for much longer, or a broker that has not responded
+// in a long time while partitions are assigned to it, can indicate where
+// consuming is stalled.
+func (cl *Client) FetchRequestStates() []FetchState {
+	cl.sinksAndSourcesMu.Lock()
+	sources := make([]*source, 0, len(cl.sinksAndSources))
+	for _, sns := range cl.sinksAndSources {
+		sources = append(sources, sns.source)
+	}
+	cl.sinksAndSourcesMu.Unlock()
+
+	states := make([]FetchState, 0, len(sources))
+	for _, s := range sources {
+		s.stateMu.Lock()
+		if s.inflightSince.IsZero() && s.lastResp.IsZero() {
+			s.stateMu.Unlock()
+			continue
+		}
+		var partitions map[string][]int32
+		if s.inflightUsed != nil {
+			partitions = make(map[string][]int32, len(s.inflightUsed))
+			for t, ps := range s.inflightUsed {
+				for p := range ps {
+					partitions[t] = append(partitions[t], p)
+				}
+				slices.Sort(partitions[t])
+			}
+		}
+		states = append(states, FetchState{
+			Broker:        s.nodeID,
+			InFlight:      !s.inflightSince.IsZero(),
+			InFlightSince: s.inflightSince,
+			Partitions:    partitions,
+			LastResponse:  s.lastResp,
+		})
+		s.stateMu.Unlock()
+	}
+	sort.Slice(states, func(i, j int) bool { return states[i].Broker < states[j].Broker })
+	return states
 }
 
 func (cl *Client) newSource(nodeID int32) *source {
@@ -100,6 +171,15 @@ type cursor struct {
 
 	unknownIDFails atomicI32
 
+	retryBudget retryBudget // see RetriableErrorBudget
+
+	// The most recent end offset seen in a fetch response for this cursor,
+	// and the unix nano time it was seen. The end offset is the high
+	// watermark, or the last stable offset if reading committed. These
+	// are atomics so that they can be read at any time by Lag.
+	observedEnd   atomicI64
+	observedEndAt atomicI64 // monoNow
+
 	keepControl bool // whether to keep control records
 
 	cursorsIdx int // updated under source mutex
@@ -481,6 +561,64 @@ func (s *source) discardBuffered() {
 	s.takeBufferedFn(false, usedOffsets.finishUsingAll)
 }
 
+// discardBufferedMatching discards only the partitions in the buffered fetch
+// that are in discard, keeping the rest of the fetch pollable with its offsets
+// intact. If nothing would remain, the entire fetch is discarded. This returns
+// whether the fetch is still buffered.
+func (s *source) discardBufferedMatching(discard map[string]map[int32]Offset) bool {
+	b := &s.buffered
+
+	// We must drop every matching used offset, even for partitions that
+	// have no records in the fetch: taking the fetch later would
+	// otherwise set the offset and re-allow fetching the partition.
+	for t, dps := range discard {
+		tCursors := b.usedOffsets[t]
+		for p := range dps {
+			if pCursor, ok := tCursors[p]; ok {
+				pCursor.from.allowUsable()
+				delete(tCursors, p)
+			}
+		}
+		if tCursors != nil && len(tCursors) == 0 {
+			delete(b.usedOffsets, t)
+		}
+	}
+
+	var stripped Fetch
+	keep := b.fetch.Topics[:0]
+	for _, t := range b.fetch.Topics {
+		dps, ok := discard[t.Topic]
+		if !ok {
+			keep = append(keep, t)
+			continue
+		}
+		st := FetchTopic{Topic: t.Topic, TopicID: t.TopicID}
+		keepp := t.Partitions[:0]
+		for _, p := range t.Partitions {
+			if _, ok := dps[p.Partition]; ok {
+				st.Partitions = append(st.Partitions, p)
+				continue
+			}
+			keepp = append(keepp, p)
+		}
+		if len(st.Partitions) > 0 {
+			stripped.Topics = append(stripped.Topics, st)
+		}
+		if len(keepp) > 0 {
+			t.Partitions = keepp
+			keep = append(keep, t)
+		}
+	}
+	b.fetch.Topics = keep
+
+	s.hook(&stripped, false, false) // unbuffered, not polled
+	if len(keep) == 0 {
+		s.discardBuffered()
+		return false
+	}
+	return true
+}
+
 // takeNBuffered takes a limited amount of records from a buffered fetch,
 // updating offsets in each partition per records taken.
 //
@@ -793,6 +931,14 @@ func (s *source) fetch(consumerSession *consumerSession, doneFetch chan<- struct
 	if err != nil {
 		close(requested)
 	} else {
+		// The request's offsets are not modified until we handle
+		// the response, so FetchRequestStates can build the
+		// partitions from them on demand.
+		s.stateMu.Lock()
+		s.inflightSince = time.Now()
+		s.inflightUsed = req.usedOffsets
+		s.stateMu.Unlock()
+
 		br.do(ctx, req, func(k kmsg.Response, e error) {
 			kresp, err = k, e
 			close(requested)
@@ -803,6 +949,15 @@ func (s *source) fetch(consumerSession *consumerSession, doneFetch chan<- struct
 	case <-requested:
 		fetched = true
 	case <-ctx.Done():
+	}
+	s.stateMu.Lock()
+	s.inflightSince = time.Time{}
+	s.inflightUsed = nil
+	if fetched && err == nil {
+		s.lastResp = time.Now()
+	}
+	s.stateMu.Unlock()
+	if !fetched {
 		return
 	}
 
@@ -1078,12 +1233,20 @@ func (s *source) handleReqResp(br *broker, req *fetchRequest, resp *kmsg.FetchRe
 				updateWhy.add(topic, partition, fp.Err)
 			}
 
+			var budgetExhausted bool
+			if kerr.IsRetriable(fp.Err) {
+				if budgetErr := s.cl.retryBudgetFail(&partOffset.from.retryBudget, topic, partition, s.nodeID, fp.Err); budgetErr != nil {
+					fp.Err = budgetErr
+					budgetExhausted = true
+				}
+			}
+
 			// We only keep the partition if it has no error, or an
 			// error we do not internally retry.
 			var keep bool
 			switch fp.Err {
 			default:
-				if kerr.IsRetriable(fp.Err) && !s.cl.cfg.keepRetryableFetchErrors {
+				if kerr.IsRetriable(fp.Err) && !budgetExhausted && !s.cl.cfg.keepRetryableFetchErrors {
 					// UnknownLeaderEpoch: our meta is newer than the broker we fetched from
 					// OffsetNotAvailable: fetched from out of sync replica or a behind in-sync one (KIP-392 case 1 and case 2)
 					// UnknownTopicID: kafka has not synced the state on all brokers
@@ -1100,6 +1263,7 @@ func (s *source) handleReqResp(br *broker, req *fetchRequest, resp *kmsg.FetchRe
 
 			case nil:
 				partOffset.from.unknownIDFails.Store(0)
+				partOffset.from.retryBudget.reset()
 				keep = true
 
 			case kerr.UnknownTopicID:
@@ -1256,6 +1420,12 @@ func (o *cursorOffsetNext) processRespPartition(br *broker, rp *kmsg.FetchRespon
 	}
 	if rp.ErrorCode == 0 {
 		o.hwm = rp.HighWatermark
+		end := rp.HighWatermark
+		if br.cl.cfg.isolationLevel == 1 {
+			end = rp.LastStableOffset
+		}
+		o.from.observedEnd.Store(end)
+		o.from.observedEndAt.Store(monoNow())
 	}
 
 	var aborter aborter
@@ -1360,6 +1530,7 @@ func (o *cursorOffsetNext) processRespPartition(br *broker, rp *kmsg.FetchRespon
 			break
 		}
 
+		raw := in[:length]
 		in = in[length:]
 
 		var m FetchBatchMetrics
@@ -1378,7 +1549,11 @@ func (o *cursorOffsetNext) processRespPartition(br *broker, rp *kmsg.FetchRespon
 		case *kmsg.RecordBatch:
 			m.CompressedBytes = len(t.Records) // for record batches, we only track the record batch length
 			m.CompressionType = uint8(t.Attributes) & 0b0000_0111
-			m.NumRecords, m.UncompressedBytes = o.processRecordBatch(&fp, t, aborter, decompressor)
+			if br.cl.cfg.rawBatches {
+				m.NumRecords = o.processRawBatch(&fp, t, raw, aborter)
+			} else {
+				m.NumRecords, m.UncompressedBytes = o.processRecordBatch(&fp, t, aborter, decompressor)
+			}
 		}
 
 		if m.UncompressedBytes == 0 {
@@ -1525,6 +1700,61 @@ func (o *cursorOffsetNext) processRecordBatch(
 	return len(krecords), uncompressedBytes
 }
 
+// processRawBatch keeps a record batch undecoded for ConsumeRawBatches. Our
+// offset advances past the whole batch. Aborted and control batches are
+// dropped the same as their records would be; control batches are never
+// compressed, so tracking aborts does not require decompressing anything.
+func (o *cursorOffsetNext) processRawBatch(
+	fp *FetchPartition,
+	batch *kmsg.RecordBatch,
+	raw []byte,
+	aborter aborter,
+) int {
+	if batch.Magic != 2 {
+		fp.Err = fmt.Errorf("unknown batch magic %d", batch.Magic)
+		return 0
+	}
+	nextAskOffset := batch.FirstOffset + int64(batch.LastOffsetDelta) + 1
+	if nextAskOffset <= o.offset {
+		return 0
+	}
+
+	abortBatch := aborter.shouldAbortBatch(batch)
+	control := batch.Attributes&0b0010_0000 != 0
+	if control && abortBatch {
+		for _, r := range readRawRecords(int(batch.NumRecords), batch.Records) {
+			if key := r.Key; len(key) >= 4 && key[2] == 0 && key[3] == 0 {
+				aborter.trackAbortedPID(batch.ProducerID)
+			}
+		}
+	}
+	if control {
+		abortBatch = !o.from.keepControl
+	}
+
+	if !abortBatch {
+		fp.RawBatches = append(fp.RawBatches, RawBatch{
+			RecordBatchInfo: RecordBatchInfo{
+				FirstOffset:     batch.FirstOffset,
+				LastOffsetDelta: batch.LastOffsetDelta,
+				FirstTimestamp:  timeFromMillis(batch.FirstTimestamp),
+				MaxTimestamp:    timeFromMillis(batch.MaxTimestamp),
+				ProducerID:      batch.ProducerID,
+				ProducerEpoch:   batch.ProducerEpoch,
+				Attrs:           RecordAttrs{uint8(batch.Attributes)},
+				NumRecords:      batch.NumRecords,
+			},
+			LeaderEpoch: batch.PartitionLeaderEpoch,
+			Batch:       raw,
+		})
+	}
+
+	o.offset = nextAskOffset
+	o.lastConsumedEpoch = batch.PartitionLeaderEpoch
+	o.lastConsumedTime = timeFromMillis(batch.MaxTimestamp)
+	return int(batch.NumRecords)
+}
+
 // Processes an outer v1 message. There could be no inner message, which makes
 // this easy, but if not, we decompress and process each inner message as
 // either v0 or v1. We only expect the inner message to be v1, but technically
@@ -1774,6 +2004,10 @@ func recordToRecord(
 		ProducerEpoch: batch.ProducerEpoch,
 		LeaderEpoch:   batch.PartitionLeaderEpoch,
 		Offset:        batch.FirstOffset + int64(record.OffsetDelta),
+
+		batchOffsetDelta:  record.OffsetDelta,
+		batchMaxTimestamp: batch.MaxTimestamp,
+		batchNumRecords:   batch.NumRecords,
 	}
 	if r.Attrs.TimestampType() == 0 {
 		r.Timestamp = timeFromMillis(batch.FirstTimestamp + record.TimestampDelta64)
@@ -1,6 +1,7 @@
 package kgo
 
 import (
+	"errors"
 	"fmt"
 	"sort"
 	"strings"
@@ -254,7 +255,8 @@ type topicPartitions struct {
 
 	partsMu     sync.Mutex
 	partitioner TopicPartitioner
-	lb          *leastBackupInput // for partitioning if the partitioner is a LoadTopicPartitioner
+	lb          *leastBackupInput   // for partitioning if the partitioner is a LoadTopicPartitioner
+	ld          *partitionLoadInput // for partitioning if the partitioner is a TopicLoadPartitioner
 }
 
 func (t *topicPartitions) load() *topicPartitionsData { return t.v.Load().(*topicPartitionsData) }
@@ -406,8 +408,13 @@ func (cl *Client) storePartitionsUpdate(topic string, l *topicPartitions, lv *to
 			err:  lv.loadErr,
 		})
 	} else {
-		for _, pr := range unknown.buffered {
-			cl.doPartitionRecord(l, lv, pr)
+		for i := 0; i < len(unknown.buffered); i++ {
+			if n := unknown.together[i]; n > 0 {
+				cl.doPartitionRecords(l, lv, unknown.buffered[i:i+n])
+				i += n - 1
+				continue
+			}
+			cl.doPartitionRecord(l, lv, unknown.buffered[i])
 		}
 	}
 }
@@ -482,6 +489,22 @@ type topicPartitionsData struct {
 	when               int64
 }
 
+// livePartitions returns the number of partitions the latest metadata
+// response contained. Partitions missing from the latest response are kept
+// for safety with errMissingMetadataPartition, and a topic that no longer
+// exists keeps its stale partitions with an UnknownTopicOrPartition load
+// error; neither are counted.
+func (d *topicPartitionsData) livePartitions() int {
+	if errors.Is(d.loadErr, kerr.UnknownTopicOrPartition) {
+		return 0
+	}
+	n := len(d.partitions)
+	for n > 0 && d.partitions[n-1].loadErr == errMissingMetadataPartition {
+		n--
+	}
+	return n
+}
+
 // topicPartition contains all information from Kafka for a topic's partition,
 // as well as what a client is producing to it or info about consuming from it.
 type topicPartition struct {
@@ -907,7 +930,7 @@ func (css *consumerSessionStopper) stop() {
 		return
 	}
 	css.stopped = true
-	loads, tps := css.cl.consumer.stopSession()
+	loads, tps := css.cl.consumer.stopSession(nil)
 	css.reloadOffsets.mergeFrom(loads)
 	css.tpsPrior = tps
 }
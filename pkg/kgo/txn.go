@@ -396,6 +396,23 @@ func (s *GroupTransactSession) End(ctx context.Context, commit TransactionEndTry
 	tryCommit := !s.failed() && commitErr == nil && !hasAbortableCommitErr && okHeartbeat
 	willTryCommit := wantCommit && tryCommit
 
+	if wantCommit && !willTryCommit {
+		var reason string
+		switch {
+		case s.failed():
+			reason = "partitions were revoked or lost during the transaction"
+		case commitErr != nil:
+			reason = commitErr.Error()
+		case hasAbortableCommitErr:
+			reason = "committing offsets failed with an abortable error"
+		default:
+			reason = "heartbeat after committing offsets failed"
+		}
+		s.cl.producer.txnMu.Lock()
+		s.cl.producer.txnAbortReason = reason
+		s.cl.producer.txnMu.Unlock()
+	}
+
 	s.cl.cfg.logger.Log(LogLevelInfo, "transaction session ending",
 		"was_failed", s.failed(),
 		"want_commit", wantCommit,
@@ -419,11 +436,17 @@ retry:
 		case errors.Is(endTxnErr, kerr.OperationNotAttempted):
 			s.cl.cfg.logger.Log(LogLevelInfo, "end transaction with commit not attempted; retrying as abort")
 			willTryCommit = false
+			s.cl.producer.txnMu.Lock()
+			s.cl.producer.txnAbortReason = "commit was not attempted due to a producer ID error"
+			s.cl.producer.txnMu.Unlock()
 			goto retry
 
 		case errors.Is(endTxnErr, kerr.TransactionAbortable):
 			s.cl.cfg.logger.Log(LogLevelInfo, "end transaction returned TransactionAbortable; retrying as abort")
 			willTryCommit = false
+			s.cl.producer.txnMu.Lock()
+			s.cl.producer.txnAbortReason = "ending the transaction returned TransactionAbortable"
+			s.cl.producer.txnMu.Unlock()
 			goto retry
 
 		case errors.Is(endTxnErr, kerr.UnknownServerError):
@@ -496,6 +519,7 @@ func (cl *Client) BeginTransaction() error {
 
 	cl.producer.inTxn = true
 	cl.producer.producingTxn.Store(true) // allow produces for txns now
+	cl.producer.beginTxnSummary()
 	cl.cfg.logger.Log(LogLevelInfo, "beginning transaction", "transactional_id", *cl.cfg.txnID)
 
 	return nil
@@ -584,6 +608,7 @@ func (cl *Client) EndAndBeginTransaction(
 				return
 			}
 			cl.producer.inTxn = true
+			cl.producer.beginTxnSummary()
 			cl.cfg.logger.Log(LogLevelInfo, "beginning transaction", "transactional_id", *cl.cfg.txnID)
 		}
 	}()
@@ -618,6 +643,7 @@ func (cl *Client) EndAndBeginTransaction(
 
 	var anyAdded bool
 	var readd map[string][]int32
+	added := make(map[string][]int32)
 	for topic, parts := range cl.producer.topics.load() {
 		for i, part := range parts.load().partitions {
 			if part.records.addedToTxn.Swap(false) {
@@ -627,6 +653,7 @@ func (cl *Client) EndAndBeginTransaction(
 					}
 					readd[topic] = append(readd[topic], int32(i))
 				}
+				added[topic] = append(added[topic], int32(i))
 				anyAdded = true
 			}
 		}
@@ -695,6 +722,7 @@ func (cl *Client) EndAndBeginTransaction(
 		}
 		return kerr.ErrorForCode(resp.ErrorCode)
 	})
+	cl.endTxnSummary(id, epoch, bool(commit), err, added, "", "")
 	var ke *kerr.Error
 	if errors.As(err, &ke) && !ke.Retriable {
 		cl.failProducerID(id, epoch, err)
@@ -870,12 +898,14 @@ func (cl *Client) EndTransaction(ctx context.Context, commit TransactionEndTry)
 	// partition to the transaction. Thus, if we added offsets, then we
 	// also produced.
 	var anyAdded bool
+	var offsetsGroup string
 	if g := cl.consumer.g; g != nil {
 		// We do not lock because we expect commitTransactionOffsets to
 		// be called *before* ending a transaction.
 		if g.offsetsAddedToTxn {
 			g.offsetsAddedToTxn = false
 			anyAdded = true
+			offsetsGroup = g.cfg.group
 		}
 	} else {
 		cl.cfg.logger.Log(LogLevelDebug, "transaction ending, no group loaded; this must be a producer-only transaction, not consume-modify-produce EOS")
@@ -883,11 +913,17 @@ func (cl *Client) EndTransaction(ctx context.Context, commit TransactionEndTry)
 
 	// After the flush, no records are being produced to, and we can set
 	// addedToTxn to false outside of any mutex.
-	for _, parts := range cl.producer.topics.load() {
-		for _, part := range parts.load().partitions {
-			anyAdded = part.records.addedToTxn.Swap(false) || anyAdded
+	added := make(map[string][]int32)
+	for topic, parts := range cl.producer.topics.load() {
+		for i, part := range parts.load().partitions {
+			if part.records.addedToTxn.Swap(false) {
+				added[topic] = append(added[topic], int32(i))
+				anyAdded = true
+			}
 		}
 	}
+	abortReason := cl.producer.txnAbortReason
+	cl.producer.txnAbortReason = ""
 
 	// If the user previously used EndAndBeginTransaction with
 	// EndBeginTxnUnsafe, we may have to end a transaction even though
@@ -939,6 +975,7 @@ func (cl *Client) EndTransaction(ctx context.Context, commit TransactionEndTry)
 		}
 		return kerr.ErrorForCode(resp.ErrorCode)
 	})
+	cl.endTxnSummary(id, epoch, bool(commit), err, added, offsetsGroup, abortReason)
 
 	// If the returned error is still a Kafka error, this is fatal and we
 	// need to fail our producer ID we loaded above.
@@ -992,6 +1029,39 @@ func (cl *Client) maybeRecoverProducerID(ctx context.Context) (necessary, did bo
 	return true, true, nil
 }
 
+// beginTxnSummary resets the per-transaction bookkeeping that is reported in
+// HookTransactionEnd. This must be called with txnMu held.
+func (p *producer) beginTxnSummary() {
+	p.txnStart = time.Now()
+	p.txnRecords.Store(0)
+	p.txnAbortReason = ""
+}
+
+// endTxnSummary calls HookTransactionEnd after an EndTxn request. This must be
+// called with txnMu held.
+func (cl *Client) endTxnSummary(id int64, epoch int16, commit bool, err error, added map[string][]int32, offsetsGroup, abortReason string) {
+	var summary *TransactionSummary
+	cl.cfg.hooks.each(func(h Hook) {
+		if h, ok := h.(HookTransactionEnd); ok {
+			if summary == nil {
+				summary = &TransactionSummary{
+					TransactionalID: *cl.cfg.txnID,
+					ProducerID:      id,
+					ProducerEpoch:   epoch,
+					Commit:          commit,
+					Err:             err,
+					AbortReason:     abortReason,
+					Partitions:      added,
+					Records:         cl.producer.txnRecords.Load(),
+					OffsetsGroup:    offsetsGroup,
+					Duration:        time.Since(cl.producer.txnStart),
+				}
+			}
+			h.OnTransactionEnd(*summary)
+		}
+	})
+}
+
 // If a transaction is begun too quickly after finishing an old transaction,
 // Kafka may still be finalizing its commit / abort and will return a
 // concurrent transactions error. We handle that by retrying for a bit.
@@ -1261,7 +1331,7 @@ func (g *groupConsumer) prepareTxnOffsetCommit(ctx context.Context, uncommitted
 			reqPartition.Partition = partition
 			reqPartition.Offset = eo.Offset
 			reqPartition.LeaderEpoch = eo.Epoch
-			reqPartition.Metadata = &req.MemberID
+			reqPartition.Metadata = g.commitMetadata(&req.MemberID, topic, partition, eo)
 			reqTopic.Partitions = append(reqTopic.Partitions, reqPartition)
 		}
 		req.Topics = append(req.Topics, reqTopic)
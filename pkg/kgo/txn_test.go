@@ -7,8 +7,11 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"sync"
 	"testing"
 	"time"
+
+	"github.com/twmb/franz-go/pkg/kmsg"
 )
 
 // This test is identical to TestGroupETL but based around transactions.
@@ -261,3 +264,77 @@ func (c *testConsumer) transact(txnsBeforeQuit int) {
 		c.mu.Unlock()
 	}
 }
+
+type txnEndHook struct {
+	mu        sync.Mutex
+	summaries []TransactionSummary
+}
+
+func (h *txnEndHook) OnTransactionEnd(s TransactionSummary) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.summaries = append(h.summaries, s)
+}
+
+func TestHookTransactionEnd(t *testing.T) {
+	b := newFakeBroker(t, func(req kmsg.Request) kmsg.Response {
+		switch req := req.(type) {
+		case *kmsg.InitProducerIDRequest:
+			resp := req.ResponseKind().(*kmsg.InitProducerIDResponse)
+			resp.ProducerID, resp.ProducerEpoch = 5, 1
+			return resp
+		case *kmsg.EndTxnRequest:
+			return req.ResponseKind()
+		}
+		return nil
+	})
+	defer b.close()
+
+	hook := new(txnEndHook)
+	cl, err := NewClient(SeedBrokers(b.addr()), TransactionalID("txn"), WithHooks(hook))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer cl.Close()
+
+	for _, commit := range []bool{true, false} {
+		if err := cl.BeginTransaction(); err != nil {
+			t.Fatal(err)
+		}
+		// Nothing is produced; readded forces the EndTxn request as if
+		// this transaction was begun with EndBeginTxnUnsafe.
+		cl.producer.readded = true
+		if err := cl.EndTransaction(context.Background(), TransactionEndTry(commit)); err != nil {
+			t.Fatalf("commit %v: %v", commit, err)
+		}
+	}
+
+	// An empty transaction does not issue EndTxn and is not summarized.
+	if err := cl.BeginTransaction(); err != nil {
+		t.Fatal(err)
+	}
+	if err := cl.EndTransaction(context.Background(), TryCommit); err != nil {
+		t.Fatal(err)
+	}
+
+	hook.mu.Lock()
+	defer hook.mu.Unlock()
+	if len(hook.summaries) != 2 {
+		t.Fatalf("got %d summaries, exp 2", len(hook.summaries))
+	}
+	for i, commit := range []bool{true, false} {
+		s := hook.summaries[i]
+		if s.TransactionalID != "txn" || s.ProducerID != 5 || s.ProducerEpoch != 1 {
+			t.Errorf("summary %d: got id %q %d/%d, exp \"txn\" 5/1", i, s.TransactionalID, s.ProducerID, s.ProducerEpoch)
+		}
+		if s.Commit != commit || s.Err != nil {
+			t.Errorf("summary %d: got commit %v err %v, exp commit %v and no error", i, s.Commit, s.Err, commit)
+		}
+		if len(s.Partitions) != 0 || s.Records != 0 || s.OffsetsGroup != "" || s.AbortReason != "" {
+			t.Errorf("summary %d: unexpected transaction contents %+v", i, s)
+		}
+		if s.Duration <= 0 {
+			t.Errorf("summary %d: got non-positive duration %v", i, s.Duration)
+		}
+	}
+}
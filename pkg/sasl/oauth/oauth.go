@@ -5,6 +5,7 @@ package oauth
 import (
 	"context"
 	"errors"
+	"fmt"
 	"sort"
 
 	"github.com/twmb/franz-go/pkg/sasl"
@@ -93,8 +94,11 @@ func (fn oauth) Authenticate(ctx context.Context, _ string) (sasl.Session, []byt
 type session struct{}
 
 func (session) Challenge(resp []byte) (bool, []byte, error) {
+	// Per RFC7628 section 3.2.2, a failed authentication is answered
+	// with a JSON error status challenge. We surface it as is so that
+	// users can see why their token was rejected.
 	if len(resp) != 0 {
-		return false, nil, errors.New("unexpected data in oauth response")
+		return false, nil, fmt.Errorf("oauth authentication failed, server error: %s", resp)
 	}
 	return true, nil, nil
 }
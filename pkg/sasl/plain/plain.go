@@ -4,6 +4,7 @@ package plain
 import (
 	"context"
 	"errors"
+	"fmt"
 
 	"github.com/twmb/franz-go/pkg/sasl"
 )
@@ -55,6 +56,11 @@ func (fn plain) Authenticate(ctx context.Context, _ string) (sasl.Session, []byt
 
 type session struct{}
 
-func (session) Challenge([]byte) (bool, []byte, error) {
+func (session) Challenge(resp []byte) (bool, []byte, error) {
+	// A successful PLAIN authentication has an empty server response;
+	// anything else is the server telling us why we failed.
+	if len(resp) != 0 {
+		return false, nil, fmt.Errorf("plain authentication failed, server error: %s", resp)
+	}
 	return true, nil, nil
 }